@@ -0,0 +1,288 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Privileged actions recorded in the audit log
+const (
+	ActionDeployContract    = "deploy_contract"
+	ActionExecuteContract   = "execute_contract"
+	ActionAddActivity       = "add_activity"
+	ActionTransferReward    = "transfer_reward"
+	ActionReloadConfig      = "reload_config"
+	ActionCreateActivity    = "create_activity"
+	ActionUpdateActivity    = "update_activity"
+	ActionDeleteActivity    = "delete_activity"
+	ActionCheckIn           = "check_in"
+	ActionConfirmAttendance = "confirm_attendance"
+	ActionRejectAttendance  = "reject_attendance"
+	ActionResolveTransfer   = "resolve_transfer"
+)
+
+// Outcomes of an audited action
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Hash the first entry chains to
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// Entry is one audited action. Hash covers every other field, including the previous
+// entry's hash, so editing, removing or reordering entries breaks the chain. With a key
+// the hash is an HMAC, so rewriting the whole chain also takes the key.
+type Entry struct {
+	Seq            uint64    `json:"seq"`
+	Time           time.Time `json:"time"`
+	Actor          string    `json:"actor"`
+	AuthMethod     string    `json:"auth_method"`
+	DID            string    `json:"did,omitempty"`
+	Branch         string    `json:"branch,omitempty"`
+	Action         string    `json:"action"`
+	Contract       string    `json:"contract,omitempty"`
+	PayloadSHA256  string    `json:"payload_sha256"`
+	RubixRequestID string    `json:"rubix_request_id,omitempty"`
+	Result         string    `json:"result"`
+	Error          string    `json:"error,omitempty"`
+	RequestID      string    `json:"request_id,omitempty"`
+	PrevHash       string    `json:"prev_hash"`
+	Hash           string    `json:"hash"`
+}
+
+// computeHash hashes the entry with its Hash field cleared, keyed with HMAC-SHA256 when key isn't nil
+func (e Entry) computeHash(key []byte) (string, error) {
+	e.Hash = ""
+	encoded, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	if key != nil {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(encoded)
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// HashPayload returns the hex SHA-256 of a request payload's JSON encoding
+func HashPayload(payload interface{}) string {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// Log is an append-only, hash-chained JSON Lines audit file
+type Log struct {
+	mu       sync.Mutex
+	path     string
+	key      []byte
+	lastSeq  uint64
+	lastHash string
+}
+
+// Open opens the audit log at path, creating it if needed, and resumes its chain.
+// Entries are keyed with key, nil for a plain hash chain. A log written with another
+// key, or none, is refused rather than continued with a chain Verify would reject.
+func Open(path string, key []byte) (*Log, error) {
+	log := &Log{path: path, key: key, lastHash: genesisHash}
+	var last *Entry
+	err := readEntries(path, func(entry Entry) error {
+		last = &entry
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if last != nil {
+		hash, err := last.computeHash(key)
+		if err != nil || hash != last.Hash {
+			return nil, fmt.Errorf("audit log %s was not written with the configured key, start a new log to change keys", path)
+		}
+		log.lastSeq = last.Seq
+		log.lastHash = last.Hash
+	}
+	return log, nil
+}
+
+// Append chains the entry to the log and writes it, filling in Seq, Time, PrevHash and Hash
+func (l *Log) Append(entry Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.Seq = l.lastSeq + 1
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	entry.PrevHash = l.lastHash
+	hash, err := entry.computeHash(l.key)
+	if err != nil {
+		return entry, fmt.Errorf("failed to hash audit entry: %w", err)
+	}
+	entry.Hash = hash
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return entry, fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return entry, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return entry, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return entry, fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	l.lastSeq = entry.Seq
+	l.lastHash = entry.Hash
+	return entry, nil
+}
+
+// Filter selects audit entries; zero fields match everything
+type Filter struct {
+	Actor    string
+	DID      string
+	Branch   string
+	Branches []string // Only entries for one of these branches, nil for every branch
+	Action   string
+	Result   string
+	Since    time.Time
+	Until    time.Time
+	Limit    int // Most recent entries returned, 0 for all
+}
+
+func (f Filter) matches(entry Entry) bool {
+	return (f.Actor == "" || entry.Actor == f.Actor) &&
+		(f.DID == "" || entry.DID == f.DID) &&
+		(f.Branch == "" || entry.Branch == f.Branch) &&
+		(f.Branches == nil || slices.Contains(f.Branches, entry.Branch)) &&
+		(f.Action == "" || entry.Action == f.Action) &&
+		(f.Result == "" || entry.Result == f.Result) &&
+		(f.Since.IsZero() || !entry.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || entry.Time.Before(f.Until))
+}
+
+// Query returns the entries matching the filter, oldest first
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := []Entry{}
+	err := readEntries(l.path, func(entry Entry) error {
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return entries, nil
+}
+
+// VerifyReport is the outcome of checking an audit log's hash chain
+type VerifyReport struct {
+	Path      string `json:"path"`
+	Entries   uint64 `json:"entries"`
+	Keyed     bool   `json:"keyed"` // Whether entry hashes were checked as HMACs under a key
+	Valid     bool   `json:"valid"`
+	BrokenAt  uint64 `json:"broken_at,omitempty"` // Line number of the first entry failing the check
+	Problem   string `json:"problem,omitempty"`
+	FinalHash string `json:"final_hash,omitempty"`
+}
+
+// Verify recomputes the hash chain of the audit log at path. Logs written with a key
+// only verify with the same key.
+func Verify(path string, key []byte) (*VerifyReport, error) {
+	report := &VerifyReport{Path: path, Keyed: key != nil, Valid: true}
+	prevHash := genesisHash
+	var line uint64
+	err := readEntries(path, func(entry Entry) error {
+		line++
+		problem := ""
+		hash, err := entry.computeHash(key)
+		switch {
+		case err != nil:
+			problem = err.Error()
+		case entry.Seq != line:
+			problem = fmt.Sprintf("sequence number %d out of order", entry.Seq)
+		case entry.PrevHash != prevHash:
+			problem = "previous hash does not match, an entry was removed or reordered"
+		case entry.Hash != hash:
+			problem = "entry hash does not match its contents, the entry was modified or hashed with another key"
+		}
+		if problem != "" {
+			report.Valid = false
+			report.BrokenAt = line
+			report.Problem = problem
+			return errStopReading
+		}
+		prevHash = entry.Hash
+		return nil
+	})
+	report.Entries = line
+	if err != nil && !errors.Is(err, errStopReading) {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			report.Valid = false
+			report.BrokenAt = line + 1
+			report.Problem = "entry is not valid JSON"
+			return report, nil
+		}
+		return nil, err
+	}
+	if report.Valid {
+		report.FinalHash = prevHash
+	}
+	return report, nil
+}
+
+var errStopReading = errors.New("stop reading")
+
+// readEntries calls fn for every entry of the log in order
+func readEntries(path string, fn func(Entry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var entry Entry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				return err
+			}
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
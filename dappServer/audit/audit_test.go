@@ -0,0 +1,243 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeLog appends n entries to a new log and returns its path
+func writeLog(t *testing.T, key []byte, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if _, err := log.Append(Entry{Actor: "alice", Action: ActionExecuteContract, Result: ResultSuccess, Branch: "north"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+// editLines rewrites the log's lines with edit
+func editLines(t *testing.T, path string, edit func(lines [][]byte) [][]byte) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	for i := range lines {
+		lines[i] = bytes.TrimSuffix(lines[i], []byte("\n"))
+	}
+	lines = edit(lines)
+	if err := os.WriteFile(path, append(bytes.Join(lines, []byte("\n")), '\n'), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// editEntry decodes line i, changes it and encodes it again
+func editEntry(t *testing.T, lines [][]byte, i int, change func(*Entry)) [][]byte {
+	t.Helper()
+	var entry Entry
+	if err := json.Unmarshal(lines[i], &entry); err != nil {
+		t.Fatal(err)
+	}
+	change(&entry)
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines[i] = encoded
+	return lines
+}
+
+func TestVerify(t *testing.T) {
+	key := []byte("audit-key")
+	tests := []struct {
+		name       string
+		writeKey   []byte
+		verifyKey  []byte
+		edit       func(t *testing.T, lines [][]byte) [][]byte
+		wantValid  bool
+		wantBroken uint64
+	}{
+		{name: "untouched", wantValid: true},
+		{name: "untouched keyed", writeKey: key, verifyKey: key, wantValid: true},
+		{
+			name: "modified entry",
+			edit: func(t *testing.T, lines [][]byte) [][]byte {
+				return editEntry(t, lines, 1, func(e *Entry) { e.Actor = "mallory" })
+			},
+			wantBroken: 2,
+		},
+		{
+			// The rehashed entry checks out on its own, the next one no longer chains to it
+			name: "modified entry with its hash recomputed",
+			edit: func(t *testing.T, lines [][]byte) [][]byte {
+				return editEntry(t, lines, 2, func(e *Entry) {
+					e.Result = ResultFailure
+					e.Hash, _ = e.computeHash(nil)
+				})
+			},
+			wantBroken: 4,
+		},
+		{
+			name:      "rehashed without the key",
+			writeKey:  key,
+			verifyKey: key,
+			edit: func(t *testing.T, lines [][]byte) [][]byte {
+				return editEntry(t, lines, 2, func(e *Entry) {
+					e.Result = ResultFailure
+					e.Hash, _ = e.computeHash(nil)
+				})
+			},
+			wantBroken: 3,
+		},
+		{name: "verified with the wrong key", writeKey: key, verifyKey: []byte("other"), wantBroken: 1},
+		{name: "keyed log verified without a key", writeKey: key, wantBroken: 1},
+		{
+			name: "removed entry",
+			edit: func(t *testing.T, lines [][]byte) [][]byte {
+				return append(lines[:1], lines[2:]...)
+			},
+			wantBroken: 2,
+		},
+		{
+			name: "reordered entries",
+			edit: func(t *testing.T, lines [][]byte) [][]byte {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			wantBroken: 2,
+		},
+		{
+			name: "truncated line",
+			edit: func(t *testing.T, lines [][]byte) [][]byte {
+				lines[3] = lines[3][:len(lines[3])/2]
+				return lines
+			},
+			wantBroken: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeLog(t, tt.writeKey, 4)
+			if tt.edit != nil {
+				editLines(t, path, func(lines [][]byte) [][]byte { return tt.edit(t, lines) })
+			}
+			report, err := Verify(path, tt.verifyKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Valid != tt.wantValid || report.BrokenAt != tt.wantBroken {
+				t.Fatalf("Verify() = valid %v broken at %d (%s), want valid %v broken at %d",
+					report.Valid, report.BrokenAt, report.Problem, tt.wantValid, tt.wantBroken)
+			}
+			if report.Valid && report.FinalHash == "" {
+				t.Fatal("valid report has no final hash")
+			}
+		})
+	}
+}
+
+func TestOpenResumesChain(t *testing.T) {
+	key := []byte("audit-key")
+	tests := []struct {
+		name     string
+		writeKey []byte
+		openKey  []byte
+		wantErr  bool
+	}{
+		{name: "plain", wantErr: false},
+		{name: "same key", writeKey: key, openKey: key, wantErr: false},
+		{name: "key added to a plain log", openKey: key, wantErr: true},
+		{name: "other key", writeKey: key, openKey: []byte("other"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeLog(t, tt.writeKey, 2)
+			log, err := Open(path, tt.openKey)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Open() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			entry, err := log.Append(Entry{Actor: "bob", Action: ActionReloadConfig, Result: ResultSuccess})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Seq != 3 {
+				t.Fatalf("resumed entry has seq %d, want 3", entry.Seq)
+			}
+			report, err := Verify(path, tt.openKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.Valid || report.Entries != 3 {
+				t.Fatalf("Verify() after resuming = %+v, want 3 valid entries", report)
+			}
+		})
+	}
+}
+
+func TestQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []Entry{
+		{Actor: "alice", Branch: "north", Action: ActionAddActivity, Result: ResultSuccess},
+		{Actor: "bob", Branch: "south", Action: ActionAddActivity, Result: ResultFailure},
+		{Actor: "alice", Branch: "south", Action: ActionTransferReward, Result: ResultSuccess},
+		{Actor: "admin", Action: ActionReloadConfig, Result: ResultSuccess},
+	} {
+		if _, err := log.Append(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		filter  Filter
+		wantSeq []uint64
+	}{
+		{name: "everything", filter: Filter{}, wantSeq: []uint64{1, 2, 3, 4}},
+		{name: "by actor", filter: Filter{Actor: "alice"}, wantSeq: []uint64{1, 3}},
+		{name: "by branch", filter: Filter{Branch: "south"}, wantSeq: []uint64{2, 3}},
+		{name: "by branches", filter: Filter{Branches: []string{"north"}}, wantSeq: []uint64{1}},
+		{name: "no branches", filter: Filter{Branches: []string{}}, wantSeq: []uint64{}},
+		{name: "by result", filter: Filter{Result: ResultFailure}, wantSeq: []uint64{2}},
+		{name: "latest", filter: Filter{Limit: 2}, wantSeq: []uint64{3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := log.Query(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			seqs := []uint64{}
+			for _, entry := range entries {
+				seqs = append(seqs, entry.Seq)
+			}
+			if len(seqs) != len(tt.wantSeq) {
+				t.Fatalf("Query() = %v, want %v", seqs, tt.wantSeq)
+			}
+			for i := range seqs {
+				if seqs[i] != tt.wantSeq[i] {
+					t.Fatalf("Query() = %v, want %v", seqs, tt.wantSeq)
+				}
+			}
+		})
+	}
+}
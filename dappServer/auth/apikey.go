@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"dapp-server/config"
+)
+
+// APIKeyHeader carries a kiosk's static API key
+const APIKeyHeader = "X-API-Key"
+
+type apiKeyEntry struct {
+	name     string
+	digest   []byte
+	roles    []string
+	branches []string
+}
+
+// APIKeyAuthenticator accepts the static keys listed in the config
+type APIKeyAuthenticator struct {
+	keys []apiKeyEntry
+}
+
+func NewAPIKeyAuthenticator(keys []config.APIKey) (*APIKeyAuthenticator, error) {
+	authenticator := &APIKeyAuthenticator{}
+	for _, key := range keys {
+		digest, err := hex.DecodeString(strings.TrimSpace(key.KeySHA256))
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("api key %q: key_sha256 must be a hex SHA-256 digest", key.Name)
+		}
+		authenticator.keys = append(authenticator.keys, apiKeyEntry{name: key.Name, digest: digest, roles: key.Roles, branches: key.Branches})
+	}
+	return authenticator, nil
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	digest := sha256.Sum256([]byte(key))
+	for _, entry := range a.keys {
+		if subtle.ConstantTimeCompare(digest[:], entry.digest) == 1 {
+			return &Principal{Subject: entry.name, Method: MethodAPIKey, Roles: entry.roles, Branches: entry.branches}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown API key")
+}
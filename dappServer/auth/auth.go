@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"dapp-server/config"
+	"dapp-server/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Authentication methods recorded on a Principal
+const (
+	MethodAPIKey      = "api_key"
+	MethodJWT         = "jwt"
+	MethodStreamToken = "stream_token" // Short-lived token issued for one event stream
+	MethodAnonymous   = "anonymous"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries none of its credentials,
+// so the next authenticator gets a chance
+var ErrNoCredentials = errors.New("no credentials")
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Subject  string   `json:"subject"`
+	Method   string   `json:"method"`
+	Roles    []string `json:"roles,omitempty"`
+	DIDs     []string `json:"dids,omitempty"`     // DIDs the caller may sign with or, for members, owns
+	Branches []string `json:"branches,omitempty"` // Branches the caller works for, none means every branch for admins
+}
+
+// Authenticator checks one kind of credential on a request
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Key the principal is stored under in the gin context
+const principalKey = "auth.principal"
+
+type principalContextKey struct{}
+
+// NewAuthenticators builds the authenticators enabled in the config
+func NewAuthenticators(cfg config.AuthConfig) ([]Authenticator, error) {
+	var authenticators []Authenticator
+	if len(cfg.APIKeys) > 0 {
+		apiKeys, err := NewAPIKeyAuthenticator(cfg.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, apiKeys)
+	}
+	if cfg.JWT.HMACSecretEnv != "" || cfg.JWT.JWKSFile != "" {
+		jwtAuth, err := NewJWTAuthenticator(cfg.JWT)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, jwtAuth)
+	}
+	if cfg.Enabled && len(authenticators) == 0 {
+		return nil, fmt.Errorf("auth is enabled but no API keys or JWT settings are configured")
+	}
+	return authenticators, nil
+}
+
+// Middleware rejects requests no authenticator accepts and attaches the principal of the rest.
+// With enabled false every request passes through as anonymous.
+func Middleware(enabled bool, authenticators ...Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !enabled {
+			setPrincipal(c, &Principal{Subject: "anonymous", Method: MethodAnonymous})
+			c.Next()
+			return
+		}
+		for _, authenticator := range authenticators {
+			principal, err := authenticator.Authenticate(c.Request)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			if err != nil {
+				logger.FromContext(c.Request.Context()).Warn("authentication failed", "error", err)
+				unauthorized(c, "invalid credentials")
+				return
+			}
+			setPrincipal(c, principal)
+			c.Next()
+			return
+		}
+		unauthorized(c, "authentication required")
+	}
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="dapp-server"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+func setPrincipal(c *gin.Context, principal *Principal) {
+	c.Set(principalKey, principal)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), principalContextKey{}, principal))
+}
+
+// GetPrincipal returns the caller attached to the gin context by Middleware
+func GetPrincipal(c *gin.Context) (*Principal, bool) {
+	value, exists := c.Get(principalKey)
+	if !exists {
+		return nil, false
+	}
+	principal, ok := value.(*Principal)
+	return principal, ok
+}
+
+// PrincipalFromContext returns the caller attached to a request context by Middleware
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return principal, ok
+}
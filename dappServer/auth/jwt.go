@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"dapp-server/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultRolesClaim = "roles"
+	defaultDIDsClaim  = "dids"
+
+	defaultBranchesClaim = "branches"
+)
+
+// JWTAuthenticator accepts bearer tokens signed with the configured HMAC secret or a key from the JWKS file
+type JWTAuthenticator struct {
+	hmacSecret    []byte
+	keys          map[string]interface{} // JWKS public keys by kid
+	parser        *jwt.Parser
+	rolesClaim    string
+	didsClaim     string
+	branchesClaim string
+}
+
+func NewJWTAuthenticator(cfg config.JWTConfig) (*JWTAuthenticator, error) {
+	authenticator := &JWTAuthenticator{rolesClaim: cfg.RolesClaim, didsClaim: cfg.DIDsClaim, branchesClaim: cfg.BranchesClaim}
+	if authenticator.rolesClaim == "" {
+		authenticator.rolesClaim = defaultRolesClaim
+	}
+	if authenticator.didsClaim == "" {
+		authenticator.didsClaim = defaultDIDsClaim
+	}
+	if authenticator.branchesClaim == "" {
+		authenticator.branchesClaim = defaultBranchesClaim
+	}
+
+	var methods []string
+	if cfg.HMACSecretEnv != "" {
+		secret := os.Getenv(cfg.HMACSecretEnv)
+		if secret == "" {
+			return nil, fmt.Errorf("jwt: %s is not set", cfg.HMACSecretEnv)
+		}
+		authenticator.hmacSecret = []byte(secret)
+		methods = append(methods, "HS256", "HS384", "HS512")
+	}
+	if cfg.JWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: %w", err)
+		}
+		authenticator.keys = keys
+		methods = append(methods, "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512")
+	}
+
+	options := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired()}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	authenticator.parser = jwt.NewParser(options...)
+	return authenticator, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	header := r.Header.Get("Authorization")
+	tokenString, found := strings.CutPrefix(header, "Bearer ")
+	if !found || tokenString == "" {
+		return nil, ErrNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := a.parser.ParseWithClaims(tokenString, claims, a.keyFor); err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+	return &Principal{
+		Subject:  subject,
+		Method:   MethodJWT,
+		Roles:    claimStrings(claims[a.rolesClaim]),
+		DIDs:     claimStrings(claims[a.didsClaim]),
+		Branches: claimStrings(claims[a.branchesClaim]),
+	}, nil
+}
+
+// keyFor picks the verification key matching the token's algorithm and kid
+func (a *JWTAuthenticator) keyFor(token *jwt.Token) (interface{}, error) {
+	if _, isHMAC := token.Method.(*jwt.SigningMethodHMAC); isHMAC {
+		if a.hmacSecret == nil {
+			return nil, fmt.Errorf("HMAC tokens are not accepted")
+		}
+		return a.hmacSecret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, exists := a.keys[kid]
+	if !exists {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// claimStrings reads a claim holding either a single string or a list of strings
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// loadJWKS reads the RSA and EC signing keys of a JWKS file
+func loadJWKS(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS file: %w", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		var key interface{}
+		switch jwk.Kty {
+		case "RSA":
+			key, err = jwk.rsaPublicKey()
+		case "EC":
+			key, err = jwk.ecdsaPublicKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no RSA or EC signing keys in %s", path)
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+func (k jsonWebKey) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x coordinate: %w", err)
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y coordinate: %w", err)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"dapp-server/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-hmac-secret"
+
+// writeJWKS writes a JWKS file holding the public halves of the given keys
+func writeJWKS(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) string {
+	t.Helper()
+	encode := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+	jwks := map[string][]jsonWebKey{"keys": {
+		{Kty: "RSA", Kid: "rsa-1", Use: "sig", N: encode(rsaKey.N), E: encode(big.NewInt(int64(rsaKey.E)))},
+		{Kty: "EC", Kid: "ec-1", Crv: "P-256", X: encode(ecKey.X), Y: encode(ecKey.Y)},
+		{Kty: "RSA", Kid: "enc-1", Use: "enc", N: encode(rsaKey.N), E: encode(big.NewInt(int64(rsaKey.E)))},
+	}}
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_JWT_SECRET", testSecret)
+	authenticator, err := NewJWTAuthenticator(config.JWTConfig{
+		HMACSecretEnv: "TEST_JWT_SECRET",
+		JWKSFile:      writeJWKS(t, rsaKey, ecKey),
+		Issuer:        "staff-app",
+		Audience:      "dapp-server",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":      "alice",
+			"iss":      "staff-app",
+			"aud":      "dapp-server",
+			"exp":      time.Now().Add(time.Hour).Unix(),
+			"roles":    []string{"staff"},
+			"dids":     "did:a did:b",
+			"branches": []string{"north"},
+		}
+	}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	with := func(change func(jwt.MapClaims)) jwt.MapClaims {
+		claims := valid()
+		change(claims)
+		return claims
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		want   *Principal
+		err    error // ErrNoCredentials, or nil for any other error when want is nil
+	}{
+		{
+			name:   "hmac token",
+			header: "Bearer " + sign(jwt.SigningMethodHS256, "", []byte(testSecret), valid()),
+			want:   &Principal{Subject: "alice", Method: MethodJWT, Roles: []string{"staff"}, DIDs: []string{"did:a", "did:b"}, Branches: []string{"north"}},
+		},
+		{
+			name:   "rsa token from jwks",
+			header: "Bearer " + sign(jwt.SigningMethodRS256, "rsa-1", rsaKey, valid()),
+			want:   &Principal{Subject: "alice", Method: MethodJWT, Roles: []string{"staff"}, DIDs: []string{"did:a", "did:b"}, Branches: []string{"north"}},
+		},
+		{
+			name:   "ec token from jwks",
+			header: "Bearer " + sign(jwt.SigningMethodES256, "ec-1", ecKey, valid()),
+			want:   &Principal{Subject: "alice", Method: MethodJWT, Roles: []string{"staff"}, DIDs: []string{"did:a", "did:b"}, Branches: []string{"north"}},
+		},
+		{name: "no header", header: "", err: ErrNoCredentials},
+		{name: "other scheme", header: "Basic YWxpY2U6c2VjcmV0", err: ErrNoCredentials},
+		{name: "wrong hmac secret", header: "Bearer " + sign(jwt.SigningMethodHS256, "", []byte("other"), valid())},
+		{name: "unknown kid", header: "Bearer " + sign(jwt.SigningMethodRS256, "rsa-2", rsaKey, valid())},
+		{name: "encryption key not used for signatures", header: "Bearer " + sign(jwt.SigningMethodRS256, "enc-1", rsaKey, valid())},
+		{name: "expired", header: "Bearer " + sign(jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c jwt.MapClaims) {
+			c["exp"] = time.Now().Add(-time.Minute).Unix()
+		}))},
+		{name: "no expiry", header: "Bearer " + sign(jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c jwt.MapClaims) {
+			delete(c, "exp")
+		}))},
+		{name: "wrong issuer", header: "Bearer " + sign(jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c jwt.MapClaims) {
+			c["iss"] = "someone-else"
+		}))},
+		{name: "wrong audience", header: "Bearer " + sign(jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c jwt.MapClaims) {
+			c["aud"] = "another-api"
+		}))},
+		{name: "no subject", header: "Bearer " + sign(jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c jwt.MapClaims) {
+			delete(c, "sub")
+		}))},
+		{name: "unsigned", header: "Bearer " + sign(jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, valid())},
+		{name: "garbage", header: "Bearer not.a.token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/nodes", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			principal, err := authenticator.Authenticate(r)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("Authenticate() = %+v, want an error", principal)
+				}
+				if tt.err != nil && !errors.Is(err, tt.err) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, tt.err)
+				}
+				if tt.err == nil && errors.Is(err, ErrNoCredentials) {
+					t.Fatalf("Authenticate() error = %v, want the token refused", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if principal.Subject != tt.want.Subject || principal.Method != tt.want.Method ||
+				!slices.Equal(principal.Roles, tt.want.Roles) || !slices.Equal(principal.DIDs, tt.want.DIDs) ||
+				!slices.Equal(principal.Branches, tt.want.Branches) {
+				t.Fatalf("Authenticate() = %+v, want %+v", principal, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewJWTAuthenticatorErrors(t *testing.T) {
+	dir := t.TempDir()
+	noKeys := filepath.Join(dir, "empty.json")
+	if err := os.WriteFile(noKeys, []byte(`{"keys":[{"kty":"oct","kid":"k"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	badCurve := filepath.Join(dir, "curve.json")
+	if err := os.WriteFile(badCurve, []byte(`{"keys":[{"kty":"EC","kid":"k","crv":"P-192","x":"AA","y":"AA"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  config.JWTConfig
+	}{
+		{name: "secret variable unset", cfg: config.JWTConfig{HMACSecretEnv: "TEST_JWT_UNSET"}},
+		{name: "missing jwks file", cfg: config.JWTConfig{JWKSFile: filepath.Join(dir, "missing.json")}},
+		{name: "jwks without signing keys", cfg: config.JWTConfig{JWKSFile: noKeys}},
+		{name: "unsupported curve", cfg: config.JWTConfig{JWKSFile: badCurve}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewJWTAuthenticator(tt.cfg); err == nil {
+				t.Fatal("NewJWTAuthenticator() succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"dapp-server/config"
+	"dapp-server/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Roles a principal can hold
+const (
+	RoleAdmin  = "admin"
+	RoleStaff  = "staff"
+	RoleMember = "member"
+	RoleKiosk  = "kiosk"
+)
+
+// Permission is an action guarded by the policy table
+type Permission string
+
+const (
+	PermDeploy            Permission = "deploy"
+	PermExecute           Permission = "execute"
+	PermAddActivity       Permission = "add_activity"
+	PermViewActivities    Permission = "view_activities"
+	PermTransferReward    Permission = "transfer_reward"
+	PermRedeem            Permission = "redeem"
+	PermViewReports       Permission = "view_reports"
+	PermViewWallet        Permission = "view_wallet"
+	PermViewAudit         Permission = "view_audit"
+	PermManageConfig      Permission = "manage_config"
+	PermCheckIn           Permission = "check_in"
+	PermConfirmAttendance Permission = "confirm_attendance"
+)
+
+// defaultPolicy lists the roles allowed each permission unless the config replaces them
+var defaultPolicy = map[Permission][]string{
+	PermDeploy:            {RoleAdmin},
+	PermExecute:           {RoleAdmin, RoleStaff},
+	PermAddActivity:       {RoleAdmin, RoleStaff},
+	PermViewActivities:    {RoleAdmin, RoleStaff, RoleMember, RoleKiosk},
+	PermTransferReward:    {RoleAdmin, RoleStaff},
+	PermRedeem:            {RoleAdmin, RoleStaff, RoleMember, RoleKiosk},
+	PermViewReports:       {RoleAdmin, RoleStaff},
+	PermViewWallet:        {RoleAdmin, RoleStaff, RoleMember, RoleKiosk},
+	PermViewAudit:         {RoleAdmin},
+	PermManageConfig:      {RoleAdmin},
+	PermCheckIn:           {RoleAdmin, RoleStaff, RoleMember, RoleKiosk},
+	PermConfirmAttendance: {RoleAdmin, RoleStaff},
+}
+
+// Policy decides what an authenticated principal may do
+type Policy struct {
+	roles    map[Permission][]string
+	bindings map[string][]string
+}
+
+// NewPolicy builds the policy table from the defaults and the config overrides
+func NewPolicy(cfg config.AuthConfig) (*Policy, error) {
+	policy := &Policy{roles: make(map[Permission][]string), bindings: cfg.Bindings}
+	for permission, roles := range defaultPolicy {
+		policy.roles[permission] = roles
+	}
+	for name, roles := range cfg.Policy {
+		permission := Permission(name)
+		if _, known := defaultPolicy[permission]; !known {
+			return nil, fmt.Errorf("policy: unknown permission %q", name)
+		}
+		policy.roles[permission] = roles
+	}
+	return policy, nil
+}
+
+// Allows reports whether the principal holds a role granted the permission.
+// Anonymous principals only exist with authentication disabled and are allowed everything.
+func (p *Policy) Allows(principal *Principal, permission Permission) bool {
+	if principal.Method == MethodAnonymous {
+		return true
+	}
+	for _, role := range principal.Roles {
+		if slices.Contains(p.roles[permission], role) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanActAs reports whether the principal may have a node sign with did.
+// Admins may use any DID, everyone else only the DIDs bound to them.
+func (p *Policy) CanActAs(principal *Principal, did string) bool {
+	if principal.Method == MethodAnonymous || slices.Contains(principal.Roles, RoleAdmin) {
+		return true
+	}
+	return slices.Contains(p.didsOf(principal), did)
+}
+
+// CanViewWallet reports whether the principal may read the wallet of did.
+// Members are limited to their own wallets.
+func (p *Policy) CanViewWallet(principal *Principal, did string) bool {
+	if !p.Allows(principal, PermViewWallet) {
+		return false
+	}
+	if isOnlyMember(principal) {
+		return slices.Contains(p.didsOf(principal), did)
+	}
+	return true
+}
+
+// CanRedeemFor reports whether the principal may redeem rewards held by did.
+// Members are limited to their own redemptions.
+func (p *Policy) CanRedeemFor(principal *Principal, did string) bool {
+	if !p.Allows(principal, PermRedeem) {
+		return false
+	}
+	if isOnlyMember(principal) {
+		return slices.Contains(p.didsOf(principal), did)
+	}
+	return true
+}
+
+// CanCheckIn reports whether the principal may check did in or read its check-ins.
+// Members are limited to their own check-ins.
+func (p *Policy) CanCheckIn(principal *Principal, did string) bool {
+	if !p.Allows(principal, PermCheckIn) {
+		return false
+	}
+	if isOnlyMember(principal) {
+		return slices.Contains(p.didsOf(principal), did)
+	}
+	return true
+}
+
+// CanAccessBranch reports whether the principal may act for or report on a branch.
+// Admins not tied to any branch work for the whole association; everyone else only
+// for their own branches. The shared branch of a server without branches is open to all.
+func (p *Policy) CanAccessBranch(principal *Principal, branch string) bool {
+	if principal.Method == MethodAnonymous || branch == "" {
+		return true
+	}
+	if len(principal.Branches) == 0 && slices.Contains(principal.Roles, RoleAdmin) {
+		return true
+	}
+	return slices.Contains(principal.Branches, branch)
+}
+
+// didsOf returns the DIDs carried by the principal's credentials plus those bound in the config
+func (p *Policy) didsOf(principal *Principal) []string {
+	return append(slices.Clone(principal.DIDs), p.bindings[principal.Subject]...)
+}
+
+func isOnlyMember(principal *Principal) bool {
+	if principal.Method == MethodAnonymous {
+		return false
+	}
+	for _, role := range principal.Roles {
+		if role != RoleMember {
+			return false
+		}
+	}
+	return true
+}
+
+// Require aborts with 403 unless the caller's roles grant the permission
+func Require(policy *Policy, permission Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, exists := GetPrincipal(c)
+		if !exists || !policy.Allows(principal, permission) {
+			Forbid(c, fmt.Sprintf("%s permission required", permission))
+			return
+		}
+		c.Next()
+	}
+}
+
+// Forbid aborts the request with 403 and logs who was refused
+func Forbid(c *gin.Context, message string) {
+	principal, _ := GetPrincipal(c)
+	subject := ""
+	if principal != nil {
+		subject = principal.Subject
+	}
+	logger.FromContext(c.Request.Context()).Warn("request forbidden", "subject", subject, "reason", message)
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": message})
+}
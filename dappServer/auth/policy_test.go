@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"testing"
+
+	"dapp-server/config"
+)
+
+var (
+	anonymous   = &Principal{Subject: "anonymous", Method: MethodAnonymous}
+	admin       = &Principal{Subject: "root", Method: MethodJWT, Roles: []string{RoleAdmin}}
+	branchAdmin = &Principal{Subject: "north-admin", Method: MethodJWT, Roles: []string{RoleAdmin}, Branches: []string{"north"}}
+	staff       = &Principal{Subject: "carol", Method: MethodJWT, Roles: []string{RoleStaff}, DIDs: []string{"did:carol"}, Branches: []string{"north", "south"}}
+	member      = &Principal{Subject: "alice", Method: MethodJWT, Roles: []string{RoleMember}, DIDs: []string{"did:alice"}}
+	kiosk       = &Principal{Subject: "front-desk", Method: MethodAPIKey, Roles: []string{RoleKiosk}, Branches: []string{"north"}}
+	nobody      = &Principal{Subject: "dave", Method: MethodAPIKey}
+)
+
+func newTestPolicy(t *testing.T) *Policy {
+	t.Helper()
+	policy, err := NewPolicy(config.AuthConfig{
+		Policy:   map[string][]string{string(PermViewReports): {RoleAdmin}},
+		Bindings: map[string][]string{"alice": {"did:alice-2"}, "front-desk": {"did:kiosk"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func TestNewPolicyUnknownPermission(t *testing.T) {
+	if _, err := NewPolicy(config.AuthConfig{Policy: map[string][]string{"refund": {RoleMember}}}); err == nil {
+		t.Fatal("NewPolicy() accepted an unknown permission")
+	}
+}
+
+func TestPolicyAllows(t *testing.T) {
+	policy := newTestPolicy(t)
+	tests := []struct {
+		name       string
+		principal  *Principal
+		permission Permission
+		want       bool
+	}{
+		{name: "anonymous deploys", principal: anonymous, permission: PermDeploy, want: true},
+		{name: "admin deploys", principal: admin, permission: PermDeploy, want: true},
+		{name: "staff can't deploy", principal: staff, permission: PermDeploy, want: false},
+		{name: "staff executes", principal: staff, permission: PermExecute, want: true},
+		{name: "staff reports replaced by config", principal: staff, permission: PermViewReports, want: false},
+		{name: "admin reports", principal: admin, permission: PermViewReports, want: true},
+		{name: "member checks in", principal: member, permission: PermCheckIn, want: true},
+		{name: "member can't confirm", principal: member, permission: PermConfirmAttendance, want: false},
+		{name: "kiosk can't transfer", principal: kiosk, permission: PermTransferReward, want: false},
+		{name: "kiosk redeems", principal: kiosk, permission: PermRedeem, want: true},
+		{name: "member redeems", principal: member, permission: PermRedeem, want: true},
+		{name: "kiosk can't view audit", principal: kiosk, permission: PermViewAudit, want: false},
+		{name: "no roles", principal: nobody, permission: PermViewActivities, want: false},
+		{name: "unknown permission", principal: admin, permission: Permission("refund"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Allows(tt.principal, tt.permission); got != tt.want {
+				t.Fatalf("Allows(%s, %s) = %v, want %v", tt.principal.Subject, tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyDIDs(t *testing.T) {
+	policy := newTestPolicy(t)
+	tests := []struct {
+		name        string
+		principal   *Principal
+		did         string
+		wantActAs   bool
+		wantWallet  bool
+		wantCheckIn bool
+		wantRedeem  bool
+	}{
+		{name: "anonymous", principal: anonymous, did: "did:anyone", wantActAs: true, wantWallet: true, wantCheckIn: true, wantRedeem: true},
+		{name: "admin", principal: admin, did: "did:anyone", wantActAs: true, wantWallet: true, wantCheckIn: true, wantRedeem: true},
+		{name: "staff own did", principal: staff, did: "did:carol", wantActAs: true, wantWallet: true, wantCheckIn: true, wantRedeem: true},
+		{name: "staff other did", principal: staff, did: "did:alice", wantActAs: false, wantWallet: true, wantCheckIn: true, wantRedeem: true},
+		{name: "member own did", principal: member, did: "did:alice", wantActAs: true, wantWallet: true, wantCheckIn: true, wantRedeem: true},
+		{name: "member bound did", principal: member, did: "did:alice-2", wantActAs: true, wantWallet: true, wantCheckIn: true, wantRedeem: true},
+		{name: "member other did", principal: member, did: "did:bob", wantActAs: false, wantWallet: false, wantCheckIn: false, wantRedeem: false},
+		{name: "kiosk bound did", principal: kiosk, did: "did:kiosk", wantActAs: true, wantWallet: true, wantCheckIn: true, wantRedeem: true},
+		{name: "kiosk member did", principal: kiosk, did: "did:alice", wantActAs: false, wantWallet: true, wantCheckIn: true, wantRedeem: true},
+		{name: "no roles", principal: nobody, did: "did:alice", wantActAs: false, wantWallet: false, wantCheckIn: false, wantRedeem: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.CanActAs(tt.principal, tt.did); got != tt.wantActAs {
+				t.Errorf("CanActAs() = %v, want %v", got, tt.wantActAs)
+			}
+			if got := policy.CanViewWallet(tt.principal, tt.did); got != tt.wantWallet {
+				t.Errorf("CanViewWallet() = %v, want %v", got, tt.wantWallet)
+			}
+			if got := policy.CanCheckIn(tt.principal, tt.did); got != tt.wantCheckIn {
+				t.Errorf("CanCheckIn() = %v, want %v", got, tt.wantCheckIn)
+			}
+			if got := policy.CanRedeemFor(tt.principal, tt.did); got != tt.wantRedeem {
+				t.Errorf("CanRedeemFor() = %v, want %v", got, tt.wantRedeem)
+			}
+		})
+	}
+}
+
+func TestPolicyCanAccessBranch(t *testing.T) {
+	policy := newTestPolicy(t)
+	tests := []struct {
+		name      string
+		principal *Principal
+		branch    string
+		want      bool
+	}{
+		{name: "anonymous", principal: anonymous, branch: "north", want: true},
+		{name: "association admin", principal: admin, branch: "south", want: true},
+		{name: "branch admin own branch", principal: branchAdmin, branch: "north", want: true},
+		{name: "branch admin other branch", principal: branchAdmin, branch: "south", want: false},
+		{name: "staff listed branch", principal: staff, branch: "south", want: true},
+		{name: "staff unlisted branch", principal: staff, branch: "east", want: false},
+		{name: "member without branches", principal: member, branch: "north", want: false},
+		{name: "shared branch", principal: member, branch: "", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.CanAccessBranch(tt.principal, tt.branch); got != tt.want {
+				t.Fatalf("CanAccessBranch(%s, %q) = %v, want %v", tt.principal.Subject, tt.branch, got, tt.want)
+			}
+		})
+	}
+}
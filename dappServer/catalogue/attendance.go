@@ -0,0 +1,402 @@
+package catalogue
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// How a member was checked in
+const (
+	MethodMemberID = "member_id" // Staff typed in the member's ID
+	MethodQR       = "qr"        // The member's QR code was scanned
+	MethodKiosk    = "kiosk"     // The member identified themselves at a kiosk
+)
+
+// Lifecycle of a check-in
+const (
+	AttendanceCheckedIn = "checked_in" // Waiting for staff or the automatic rule
+	AttendanceConfirmed = "confirmed"  // Attended, a reward transfer is linked
+	AttendanceRejected  = "rejected"   // Didn't attend, no reward
+)
+
+// Lifecycle of a check-in's reward transfer
+const (
+	TransferQueued      = "queued"
+	TransferSending     = "sending" // The transfer contract may be running, saved before it is called
+	TransferTransferred = "transferred"
+	TransferFailed      = "failed"      // Failed before the contract ran, confirming again retries it
+	TransferUnconfirmed = "unconfirmed" // The contract may have run; staff check the chain and resolve it
+)
+
+// ErrCheckInNotFound is returned for check-ins missing from the attendance log
+var ErrCheckInNotFound = errors.New("check-in not found")
+
+// ErrSessionFull is returned when a session has no places left
+var ErrSessionFull = errors.New("session is full")
+
+// CheckIn records a member turning up to an activity session
+type CheckIn struct {
+	ID          string     `json:"id"`
+	Branch      string     `json:"branch,omitempty"`
+	ActivityID  string     `json:"activity_id"`
+	Session     Session    `json:"session"`
+	UserDID     string     `json:"user_did"`
+	MemberID    string     `json:"member_id,omitempty"`
+	Method      string     `json:"method"`
+	CheckedInBy string     `json:"checked_in_by,omitempty"` // Subject of the caller that made the check-in
+	CheckedInAt time.Time  `json:"checked_in_at"`
+	Status      string     `json:"status"`
+	ConfirmedBy string     `json:"confirmed_by,omitempty"` // Subject of the staff member, or the automatic rule
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+	Reason      string     `json:"reason,omitempty"` // Why attendance was rejected
+	Transfer    *Transfer  `json:"transfer,omitempty"`
+}
+
+// Transfer is the reward transfer a confirmed check-in leads to
+type Transfer struct {
+	Status         string     `json:"status"`
+	AdminDID       string     `json:"admin_did"`                  // DID whose node signs the transfer
+	RubixRequestID string     `json:"rubix_request_id,omitempty"` // Transfer contract execution, also in the audit log
+	RewardAmount   float64    `json:"reward_amount,omitempty"`
+	Attempts       int        `json:"attempts"`
+	Error          string     `json:"error,omitempty"`
+	QueuedAt       time.Time  `json:"queued_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
+
+// AttendanceFilter selects check-ins; zero fields match everything
+type AttendanceFilter struct {
+	Branch     string
+	ActivityID string
+	Session    *int
+	UserDID    string
+	Status     string
+}
+
+func (f AttendanceFilter) matches(checkIn CheckIn) bool {
+	return checkIn.Branch == f.Branch &&
+		(f.ActivityID == "" || checkIn.ActivityID == f.ActivityID) &&
+		(f.Session == nil || checkIn.Session.Index == *f.Session) &&
+		(f.UserDID == "" || checkIn.UserDID == f.UserDID) &&
+		(f.Status == "" || checkIn.Status == f.Status)
+}
+
+// Attendance keeps check-ins and their transfers in a JSON file, rewritten on every change.
+// Queued transfers survive restarts because the file is the queue.
+type Attendance struct {
+	mu       sync.Mutex
+	path     string
+	checkIns map[string]CheckIn // By ID
+}
+
+// OpenAttendance loads the check-ins at path, starting empty if the file doesn't exist yet
+func OpenAttendance(path string) (*Attendance, error) {
+	attendance := &Attendance{path: path, checkIns: make(map[string]CheckIn)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return attendance, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var checkIns []CheckIn
+	if err := json.Unmarshal(data, &checkIns); err != nil {
+		return nil, fmt.Errorf("failed to parse attendance %s: %w", path, err)
+	}
+	for _, checkIn := range checkIns {
+		attendance.checkIns[checkIn.ID] = checkIn
+	}
+	return attendance, nil
+}
+
+// CheckIn records a member at a session. A member checks in once per session, and
+// sessions with a capacity take that many members at most.
+func (a *Attendance) CheckIn(checkIn CheckIn, capacity int) (CheckIn, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	taken := 0
+	for _, other := range a.checkIns {
+		if other.Branch != checkIn.Branch || other.ActivityID != checkIn.ActivityID ||
+			other.Session.Index != checkIn.Session.Index || other.Status == AttendanceRejected {
+			continue
+		}
+		if other.UserDID == checkIn.UserDID {
+			return CheckIn{}, fmt.Errorf("%w: %s is already checked in to session %d as %s", ErrConflict, checkIn.UserDID, checkIn.Session.Index, other.ID)
+		}
+		taken++
+	}
+	if capacity > 0 && taken >= capacity {
+		return CheckIn{}, fmt.Errorf("%w: all %d places are taken", ErrSessionFull, capacity)
+	}
+	id, err := newCheckInID()
+	if err != nil {
+		return CheckIn{}, err
+	}
+	checkIn.ID = id
+	checkIn.Status = AttendanceCheckedIn
+	checkIn.CheckedInAt = time.Now().UTC()
+	checkIn.ConfirmedBy, checkIn.ConfirmedAt, checkIn.Reason, checkIn.Transfer = "", nil, "", nil
+	return checkIn, a.put(checkIn)
+}
+
+func newCheckInID() (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// Get returns one of a branch's check-ins
+func (a *Attendance) Get(branch string, id string) (CheckIn, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	checkIn, exists := a.checkIns[id]
+	if !exists || checkIn.Branch != branch {
+		return CheckIn{}, ErrCheckInNotFound
+	}
+	return checkIn, nil
+}
+
+// List returns the check-ins matching the filter, oldest first
+func (a *Attendance) List(filter AttendanceFilter) []CheckIn {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	checkIns := []CheckIn{}
+	for _, checkIn := range a.checkIns {
+		if filter.matches(checkIn) {
+			checkIns = append(checkIns, checkIn)
+		}
+	}
+	sortCheckIns(checkIns)
+	return checkIns
+}
+
+// Confirm marks attendance and queues the reward transfer adminDID's node will sign.
+// A check-in whose transfer failed before the contract ran can be confirmed again to retry it.
+func (a *Attendance) Confirm(branch string, id string, confirmedBy string, adminDID string) (CheckIn, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	checkIn, exists := a.checkIns[id]
+	if !exists || checkIn.Branch != branch {
+		return CheckIn{}, ErrCheckInNotFound
+	}
+	retry := checkIn.Status == AttendanceConfirmed && checkIn.Transfer != nil && checkIn.Transfer.Status == TransferFailed
+	// A failure with a Rubix request ID came after the contract ran, so running it again could pay twice
+	if retry && checkIn.Transfer.RubixRequestID != "" {
+		return CheckIn{}, fmt.Errorf("%w: the transfer contract already ran as %s, check the chain and resolve the transfer instead",
+			ErrConflict, checkIn.Transfer.RubixRequestID)
+	}
+	if checkIn.Status != AttendanceCheckedIn && !retry {
+		if checkIn.Transfer != nil && checkIn.Transfer.Status == TransferUnconfirmed {
+			return CheckIn{}, fmt.Errorf("%w: the transfer of check-in %s may have run, check the chain and resolve it instead", ErrConflict, id)
+		}
+		return CheckIn{}, fmt.Errorf("%w: check-in %s is %s", ErrConflict, id, checkIn.Status)
+	}
+	now := time.Now().UTC()
+	if !retry {
+		checkIn.Status = AttendanceConfirmed
+		checkIn.ConfirmedBy = confirmedBy
+		checkIn.ConfirmedAt = &now
+	}
+	transfer := Transfer{Status: TransferQueued, AdminDID: adminDID, QueuedAt: now}
+	if checkIn.Transfer != nil {
+		transfer.Attempts = checkIn.Transfer.Attempts
+	}
+	checkIn.Transfer = &transfer
+	return checkIn, a.put(checkIn)
+}
+
+// Reject records that a checked in member didn't attend
+func (a *Attendance) Reject(branch string, id string, rejectedBy string, reason string) (CheckIn, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	checkIn, exists := a.checkIns[id]
+	if !exists || checkIn.Branch != branch {
+		return CheckIn{}, ErrCheckInNotFound
+	}
+	if checkIn.Status != AttendanceCheckedIn {
+		return CheckIn{}, fmt.Errorf("%w: check-in %s is %s", ErrConflict, id, checkIn.Status)
+	}
+	now := time.Now().UTC()
+	checkIn.Status = AttendanceRejected
+	checkIn.ConfirmedBy = rejectedBy
+	checkIn.ConfirmedAt = &now
+	checkIn.Reason = reason
+	return checkIn, a.put(checkIn)
+}
+
+// Ended returns the check-ins still waiting for confirmation whose session ended by t, across all branches
+func (a *Attendance) Ended(t time.Time) []CheckIn {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	checkIns := []CheckIn{}
+	for _, checkIn := range a.checkIns {
+		if checkIn.Status == AttendanceCheckedIn && !checkIn.Session.End.After(t) {
+			checkIns = append(checkIns, checkIn)
+		}
+	}
+	sortCheckIns(checkIns)
+	return checkIns
+}
+
+// Queued returns the check-ins whose reward transfer is waiting to run, across all branches
+func (a *Attendance) Queued() []CheckIn {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	checkIns := []CheckIn{}
+	for _, checkIn := range a.checkIns {
+		if checkIn.Transfer != nil && checkIn.Transfer.Status == TransferQueued {
+			checkIns = append(checkIns, checkIn)
+		}
+	}
+	sort.Slice(checkIns, func(i, j int) bool { return checkIns[i].Transfer.QueuedAt.Before(checkIns[j].Transfer.QueuedAt) })
+	return checkIns
+}
+
+// StartTransfer marks a queued transfer as sending. It is saved before the transfer
+// contract is called, so a crash while the contract runs can't lead to paying twice.
+func (a *Attendance) StartTransfer(id string) (CheckIn, error) {
+	return a.updateTransfer(id, func(transfer *Transfer) error {
+		if transfer.Status != TransferQueued {
+			return fmt.Errorf("%w: transfer of check-in %s is %s", ErrConflict, id, transfer.Status)
+		}
+		transfer.Status = TransferSending
+		transfer.Attempts++
+		return nil
+	})
+}
+
+// RecordTransferRequest saves the Rubix request ID of a sending transfer as soon as the contract has run
+func (a *Attendance) RecordTransferRequest(id string, rubixRequestID string) (CheckIn, error) {
+	return a.updateTransfer(id, func(transfer *Transfer) error {
+		if transfer.Status != TransferSending {
+			return fmt.Errorf("%w: transfer of check-in %s is %s", ErrConflict, id, transfer.Status)
+		}
+		transfer.RubixRequestID = rubixRequestID
+		return nil
+	})
+}
+
+// FinishTransfer records the outcome of a sending transfer. A failure after the contract
+// ran leaves it unconfirmed, since the tokens may have moved anyway.
+func (a *Attendance) FinishTransfer(id string, rubixRequestID string, rewardAmount float64, transferErr error) (CheckIn, error) {
+	return a.updateTransfer(id, func(transfer *Transfer) error {
+		if transfer.Status != TransferSending {
+			return fmt.Errorf("%w: transfer of check-in %s is %s", ErrConflict, id, transfer.Status)
+		}
+		now := time.Now().UTC()
+		transfer.CompletedAt = &now
+		if rubixRequestID != "" {
+			transfer.RubixRequestID = rubixRequestID
+		}
+		switch {
+		case transferErr == nil:
+			transfer.Status = TransferTransferred
+			transfer.RewardAmount = rewardAmount
+			transfer.Error = ""
+		case transfer.RubixRequestID != "":
+			transfer.Status = TransferUnconfirmed
+			transfer.Error = transferErr.Error()
+		default:
+			transfer.Status = TransferFailed
+			transfer.Error = transferErr.Error()
+		}
+		return nil
+	})
+}
+
+// RecoverInterrupted marks transfers left sending by a previous run as unconfirmed,
+// for staff to check on chain rather than running them again. It returns them.
+func (a *Attendance) RecoverInterrupted() ([]CheckIn, error) {
+	a.mu.Lock()
+	ids := []string{}
+	for id, checkIn := range a.checkIns {
+		if checkIn.Transfer != nil && checkIn.Transfer.Status == TransferSending {
+			ids = append(ids, id)
+		}
+	}
+	a.mu.Unlock()
+	recovered := []CheckIn{}
+	for _, id := range ids {
+		checkIn, err := a.updateTransfer(id, func(transfer *Transfer) error {
+			transfer.Status = TransferUnconfirmed
+			transfer.Error = "interrupted while sending, check the chain before resolving"
+			return nil
+		})
+		if err != nil {
+			return recovered, err
+		}
+		recovered = append(recovered, checkIn)
+	}
+	return recovered, nil
+}
+
+// ResolveTransfer settles an unconfirmed transfer once staff have checked the chain:
+// transferred if the tokens moved, otherwise failed so confirming again retries it
+func (a *Attendance) ResolveTransfer(branch string, id string, transferred bool) (CheckIn, error) {
+	if checkIn, err := a.Get(branch, id); err != nil {
+		return checkIn, err
+	}
+	return a.updateTransfer(id, func(transfer *Transfer) error {
+		if transfer.Status != TransferUnconfirmed {
+			return fmt.Errorf("%w: transfer of check-in %s is %s", ErrConflict, id, transfer.Status)
+		}
+		if transferred {
+			transfer.Status = TransferTransferred
+			transfer.Error = ""
+		} else {
+			transfer.Status = TransferFailed
+			transfer.Error = fmt.Sprintf("checked on chain, request %s didn't transfer", transfer.RubixRequestID)
+			transfer.RubixRequestID = ""
+		}
+		return nil
+	})
+}
+
+// updateTransfer applies change to a check-in's transfer and saves it
+func (a *Attendance) updateTransfer(id string, change func(*Transfer) error) (CheckIn, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	checkIn, exists := a.checkIns[id]
+	if !exists || checkIn.Transfer == nil {
+		return CheckIn{}, ErrCheckInNotFound
+	}
+	transfer := *checkIn.Transfer
+	if err := change(&transfer); err != nil {
+		return CheckIn{}, err
+	}
+	checkIn.Transfer = &transfer
+	return checkIn, a.put(checkIn)
+}
+
+func sortCheckIns(checkIns []CheckIn) {
+	sort.Slice(checkIns, func(i, j int) bool { return checkIns[i].CheckedInAt.Before(checkIns[j].CheckedInAt) })
+}
+
+// put stores the check-in and saves the log, leaving it unchanged if saving fails
+func (a *Attendance) put(checkIn CheckIn) error {
+	previous, existed := a.checkIns[checkIn.ID]
+	a.checkIns[checkIn.ID] = checkIn
+	checkIns := make([]CheckIn, 0, len(a.checkIns))
+	for _, checkIn := range a.checkIns {
+		checkIns = append(checkIns, checkIn)
+	}
+	sortCheckIns(checkIns)
+	if err := writeJSON(a.path, checkIns); err != nil {
+		if existed {
+			a.checkIns[checkIn.ID] = previous
+		} else {
+			delete(a.checkIns, checkIn.ID)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+package catalogue
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var errContract = errors.New("transfer contract failed")
+
+// openTestAttendance opens an empty attendance log with one member checked in to a session that has ended
+func openTestAttendance(t *testing.T) (*Attendance, CheckIn) {
+	t.Helper()
+	attendance, err := OpenAttendance(filepath.Join(t.TempDir(), "attendance.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkIn, err := attendance.CheckIn(CheckIn{
+		Branch:     "north",
+		ActivityID: "yoga",
+		Session:    Session{Index: 0, Start: time.Now().Add(-time.Hour), End: time.Now().Add(-15 * time.Minute)},
+		UserDID:    "did:alice",
+		Method:     MethodQR,
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return attendance, checkIn
+}
+
+type attendanceStep struct {
+	name         string
+	do           func(a *Attendance, id string) (CheckIn, error)
+	wantErr      error  // Checked with errors.Is
+	wantStatus   string // Attendance status after the step
+	wantTransfer string // Transfer status after the step, empty for no transfer
+	wantAttempts int
+}
+
+var (
+	stepConfirm = func(a *Attendance, id string) (CheckIn, error) {
+		return a.Confirm("north", id, "carol", "did:admin")
+	}
+	stepReject = func(a *Attendance, id string) (CheckIn, error) {
+		return a.Reject("north", id, "carol", "didn't show up")
+	}
+	stepStart = func(a *Attendance, id string) (CheckIn, error) {
+		return a.StartTransfer(id)
+	}
+	stepRecord = func(a *Attendance, id string) (CheckIn, error) {
+		return a.RecordTransferRequest(id, "req-1")
+	}
+	stepSucceed = func(a *Attendance, id string) (CheckIn, error) {
+		return a.FinishTransfer(id, "req-1", 10, nil)
+	}
+	stepFail = func(a *Attendance, id string) (CheckIn, error) {
+		return a.FinishTransfer(id, "", 0, errContract)
+	}
+	stepResolve = func(transferred bool) func(a *Attendance, id string) (CheckIn, error) {
+		return func(a *Attendance, id string) (CheckIn, error) {
+			return a.ResolveTransfer("north", id, transferred)
+		}
+	}
+)
+
+func TestAttendanceLifecycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []attendanceStep
+	}{
+		{
+			name: "confirmed and transferred",
+			steps: []attendanceStep{
+				{name: "confirm", do: stepConfirm, wantStatus: AttendanceConfirmed, wantTransfer: TransferQueued},
+				{name: "start", do: stepStart, wantStatus: AttendanceConfirmed, wantTransfer: TransferSending, wantAttempts: 1},
+				{name: "record", do: stepRecord, wantStatus: AttendanceConfirmed, wantTransfer: TransferSending, wantAttempts: 1},
+				{name: "finish", do: stepSucceed, wantStatus: AttendanceConfirmed, wantTransfer: TransferTransferred, wantAttempts: 1},
+				{name: "confirm again", do: stepConfirm, wantErr: ErrConflict, wantStatus: AttendanceConfirmed, wantTransfer: TransferTransferred, wantAttempts: 1},
+			},
+		},
+		{
+			name: "rejected",
+			steps: []attendanceStep{
+				{name: "reject", do: stepReject, wantStatus: AttendanceRejected},
+				{name: "confirm", do: stepConfirm, wantErr: ErrConflict, wantStatus: AttendanceRejected},
+				{name: "reject again", do: stepReject, wantErr: ErrConflict, wantStatus: AttendanceRejected},
+			},
+		},
+		{
+			name: "confirmed can't be rejected",
+			steps: []attendanceStep{
+				{name: "confirm", do: stepConfirm, wantStatus: AttendanceConfirmed, wantTransfer: TransferQueued},
+				{name: "reject", do: stepReject, wantErr: ErrConflict, wantStatus: AttendanceConfirmed, wantTransfer: TransferQueued},
+			},
+		},
+		{
+			name: "failed before the contract ran is retried",
+			steps: []attendanceStep{
+				{name: "confirm", do: stepConfirm, wantStatus: AttendanceConfirmed, wantTransfer: TransferQueued},
+				{name: "start", do: stepStart, wantStatus: AttendanceConfirmed, wantTransfer: TransferSending, wantAttempts: 1},
+				{name: "fail", do: stepFail, wantStatus: AttendanceConfirmed, wantTransfer: TransferFailed, wantAttempts: 1},
+				{name: "confirm again", do: stepConfirm, wantStatus: AttendanceConfirmed, wantTransfer: TransferQueued, wantAttempts: 1},
+				{name: "start again", do: stepStart, wantStatus: AttendanceConfirmed, wantTransfer: TransferSending, wantAttempts: 2},
+			},
+		},
+		{
+			name: "failed after the contract ran needs resolving",
+			steps: []attendanceStep{
+				{name: "confirm", do: stepConfirm, wantStatus: AttendanceConfirmed, wantTransfer: TransferQueued},
+				{name: "start", do: stepStart, wantStatus: AttendanceConfirmed, wantTransfer: TransferSending, wantAttempts: 1},
+				{name: "record", do: stepRecord, wantStatus: AttendanceConfirmed, wantTransfer: TransferSending, wantAttempts: 1},
+				{name: "fail", do: stepFail, wantStatus: AttendanceConfirmed, wantTransfer: TransferUnconfirmed, wantAttempts: 1},
+				{name: "confirm", do: stepConfirm, wantErr: ErrConflict, wantStatus: AttendanceConfirmed, wantTransfer: TransferUnconfirmed, wantAttempts: 1},
+				{name: "resolve as not transferred", do: stepResolve(false), wantStatus: AttendanceConfirmed, wantTransfer: TransferFailed, wantAttempts: 1},
+				{name: "confirm again", do: stepConfirm, wantStatus: AttendanceConfirmed, wantTransfer: TransferQueued, wantAttempts: 1},
+			},
+		},
+		{
+			name: "resolved as transferred",
+			steps: []attendanceStep{
+				{name: "confirm", do: stepConfirm, wantStatus: AttendanceConfirmed, wantTransfer: TransferQueued},
+				{name: "start", do: stepStart, wantStatus: AttendanceConfirmed, wantTransfer: TransferSending, wantAttempts: 1},
+				{name: "record", do: stepRecord, wantStatus: AttendanceConfirmed, wantTransfer: TransferSending, wantAttempts: 1},
+				{name: "fail", do: stepFail, wantStatus: AttendanceConfirmed, wantTransfer: TransferUnconfirmed, wantAttempts: 1},
+				{name: "resolve", do: stepResolve(true), wantStatus: AttendanceConfirmed, wantTransfer: TransferTransferred, wantAttempts: 1},
+				{name: "resolve again", do: stepResolve(true), wantErr: ErrConflict, wantStatus: AttendanceConfirmed, wantTransfer: TransferTransferred, wantAttempts: 1},
+			},
+		},
+		{
+			name: "out of order transfer steps",
+			steps: []attendanceStep{
+				{name: "start unconfirmed", do: stepStart, wantErr: ErrCheckInNotFound, wantStatus: AttendanceCheckedIn},
+				{name: "confirm", do: stepConfirm, wantStatus: AttendanceConfirmed, wantTransfer: TransferQueued},
+				{name: "record queued", do: stepRecord, wantErr: ErrConflict, wantStatus: AttendanceConfirmed, wantTransfer: TransferQueued},
+				{name: "finish queued", do: stepSucceed, wantErr: ErrConflict, wantStatus: AttendanceConfirmed, wantTransfer: TransferQueued},
+				{name: "resolve queued", do: stepResolve(true), wantErr: ErrConflict, wantStatus: AttendanceConfirmed, wantTransfer: TransferQueued},
+				{name: "start", do: stepStart, wantStatus: AttendanceConfirmed, wantTransfer: TransferSending, wantAttempts: 1},
+				{name: "start twice", do: stepStart, wantErr: ErrConflict, wantStatus: AttendanceConfirmed, wantTransfer: TransferSending, wantAttempts: 1},
+			},
+		},
+		{
+			name: "other branch",
+			steps: []attendanceStep{
+				{name: "confirm", do: func(a *Attendance, id string) (CheckIn, error) {
+					return a.Confirm("south", id, "carol", "did:admin")
+				}, wantErr: ErrCheckInNotFound, wantStatus: AttendanceCheckedIn},
+				{name: "reject", do: func(a *Attendance, id string) (CheckIn, error) {
+					return a.Reject("south", id, "carol", "")
+				}, wantErr: ErrCheckInNotFound, wantStatus: AttendanceCheckedIn},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attendance, checkIn := openTestAttendance(t)
+			for _, step := range tt.steps {
+				_, err := step.do(attendance, checkIn.ID)
+				if !errors.Is(err, step.wantErr) {
+					t.Fatalf("%s: error = %v, want %v", step.name, err, step.wantErr)
+				}
+				current, err := attendance.Get("north", checkIn.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkAttendance(t, step, current)
+			}
+
+			// The log on disk holds the same state
+			reopened, err := OpenAttendance(attendance.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved, err := reopened.Get("north", checkIn.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkAttendance(t, tt.steps[len(tt.steps)-1], saved)
+		})
+	}
+}
+
+func checkAttendance(t *testing.T, step attendanceStep, checkIn CheckIn) {
+	t.Helper()
+	transfer, attempts := "", 0
+	if checkIn.Transfer != nil {
+		transfer, attempts = checkIn.Transfer.Status, checkIn.Transfer.Attempts
+	}
+	if checkIn.Status != step.wantStatus || transfer != step.wantTransfer || attempts != step.wantAttempts {
+		t.Fatalf("%s: check-in is %s, transfer %q after %d attempts, want %s, transfer %q after %d attempts",
+			step.name, checkIn.Status, transfer, attempts, step.wantStatus, step.wantTransfer, step.wantAttempts)
+	}
+}
+
+func TestAttendanceRefusesRetryAfterContractRan(t *testing.T) {
+	attendance, checkIn := openTestAttendance(t)
+	// A failed transfer keeping its request ID, as written by an older server
+	now := time.Now().UTC()
+	checkIn.Status = AttendanceConfirmed
+	checkIn.Transfer = &Transfer{Status: TransferFailed, AdminDID: "did:admin", RubixRequestID: "req-1", Attempts: 1, QueuedAt: now}
+	if err := attendance.put(checkIn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stepConfirm(attendance, checkIn.ID); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Confirm() error = %v, want %v", err, ErrConflict)
+	}
+	if queued := attendance.Queued(); len(queued) != 0 {
+		t.Fatalf("Queued() = %d check-ins, want none", len(queued))
+	}
+}
+
+func TestAttendanceRecoverInterrupted(t *testing.T) {
+	attendance, sending := openTestAttendance(t)
+	queued, err := attendance.CheckIn(CheckIn{Branch: "north", ActivityID: "yoga", UserDID: "did:bob"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []struct {
+		id string
+		do func(a *Attendance, id string) (CheckIn, error)
+	}{{sending.ID, stepConfirm}, {sending.ID, stepStart}, {queued.ID, stepConfirm}} {
+		if _, err := step.do(attendance, step.id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A new run reads the log the previous one left behind
+	restarted, err := OpenAttendance(attendance.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := restarted.RecoverInterrupted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recovered) != 1 || recovered[0].ID != sending.ID || recovered[0].Transfer.Status != TransferUnconfirmed {
+		t.Fatalf("RecoverInterrupted() = %+v, want only %s unconfirmed", recovered, sending.ID)
+	}
+	if waiting := restarted.Queued(); len(waiting) != 1 || waiting[0].ID != queued.ID {
+		t.Fatalf("Queued() after recovery = %+v, want only %s", waiting, queued.ID)
+	}
+	if again, err := restarted.RecoverInterrupted(); err != nil || len(again) != 0 {
+		t.Fatalf("second RecoverInterrupted() = %d, %v, want nothing", len(again), err)
+	}
+}
+
+func TestAttendanceCheckIn(t *testing.T) {
+	session := func(index int) Session { return Session{Index: index} }
+	tests := []struct {
+		name     string
+		existing []CheckIn
+		rejected bool // Reject the first existing check-in
+		checkIn  CheckIn
+		capacity int
+		wantErr  error
+	}{
+		{
+			name:    "first check-in",
+			checkIn: CheckIn{Branch: "north", ActivityID: "yoga", Session: session(0), UserDID: "did:alice"},
+		},
+		{
+			name:     "same member twice",
+			existing: []CheckIn{{Branch: "north", ActivityID: "yoga", Session: session(0), UserDID: "did:alice"}},
+			checkIn:  CheckIn{Branch: "north", ActivityID: "yoga", Session: session(0), UserDID: "did:alice"},
+			wantErr:  ErrConflict,
+		},
+		{
+			name:     "same member next session",
+			existing: []CheckIn{{Branch: "north", ActivityID: "yoga", Session: session(0), UserDID: "did:alice"}},
+			checkIn:  CheckIn{Branch: "north", ActivityID: "yoga", Session: session(1), UserDID: "did:alice"},
+		},
+		{
+			name:     "same member after rejection",
+			existing: []CheckIn{{Branch: "north", ActivityID: "yoga", Session: session(0), UserDID: "did:alice"}},
+			rejected: true,
+			checkIn:  CheckIn{Branch: "north", ActivityID: "yoga", Session: session(0), UserDID: "did:alice"},
+		},
+		{
+			name: "session full",
+			existing: []CheckIn{
+				{Branch: "north", ActivityID: "yoga", Session: session(0), UserDID: "did:alice"},
+				{Branch: "north", ActivityID: "yoga", Session: session(0), UserDID: "did:bob"},
+			},
+			checkIn:  CheckIn{Branch: "north", ActivityID: "yoga", Session: session(0), UserDID: "did:carol"},
+			capacity: 2,
+			wantErr:  ErrSessionFull,
+		},
+		{
+			name: "place freed by rejection",
+			existing: []CheckIn{
+				{Branch: "north", ActivityID: "yoga", Session: session(0), UserDID: "did:alice"},
+				{Branch: "north", ActivityID: "yoga", Session: session(0), UserDID: "did:bob"},
+			},
+			rejected: true,
+			checkIn:  CheckIn{Branch: "north", ActivityID: "yoga", Session: session(0), UserDID: "did:carol"},
+			capacity: 2,
+		},
+		{
+			name:     "other branch doesn't count",
+			existing: []CheckIn{{Branch: "south", ActivityID: "yoga", Session: session(0), UserDID: "did:alice"}},
+			checkIn:  CheckIn{Branch: "north", ActivityID: "yoga", Session: session(0), UserDID: "did:alice"},
+			capacity: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attendance, err := OpenAttendance(filepath.Join(t.TempDir(), "attendance.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, existing := range tt.existing {
+				added, err := attendance.CheckIn(existing, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i == 0 && tt.rejected {
+					if _, err := attendance.Reject(added.Branch, added.ID, "carol", ""); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			// Status and transfer sent by the caller are ignored
+			tt.checkIn.Status = AttendanceConfirmed
+			tt.checkIn.Transfer = &Transfer{Status: TransferTransferred}
+			added, err := attendance.CheckIn(tt.checkIn, tt.capacity)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CheckIn() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (added.ID == "" || added.Status != AttendanceCheckedIn || added.Transfer != nil) {
+				t.Fatalf("CheckIn() = %+v, want a new checked in record", added)
+			}
+		})
+	}
+}
+
+func TestAttendanceEnded(t *testing.T) {
+	attendance, ended := openTestAttendance(t)
+	running, err := attendance.CheckIn(CheckIn{
+		Branch:     "north",
+		ActivityID: "yoga",
+		Session:    Session{Index: 1, Start: time.Now(), End: time.Now().Add(time.Hour)},
+		UserDID:    "did:bob",
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if waiting := attendance.Ended(time.Now()); len(waiting) != 1 || waiting[0].ID != ended.ID {
+		t.Fatalf("Ended() = %+v, want only %s", waiting, ended.ID)
+	}
+	if _, err := stepConfirm(attendance, ended.ID); err != nil {
+		t.Fatal(err)
+	}
+	if waiting := attendance.Ended(time.Now().Add(2 * time.Hour)); len(waiting) != 1 || waiting[0].ID != running.ID {
+		t.Fatalf("Ended() later = %+v, want only %s", waiting, running.ID)
+	}
+}
@@ -0,0 +1,311 @@
+package catalogue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Lifecycle of a catalogue activity
+const (
+	StatusDraft      = "draft"      // Editable, not on chain yet
+	StatusPublishing = "publishing" // The add-activity contract is recording it
+	StatusPublished  = "published"  // Recorded by the add-activity contract, reward points are fixed
+	StatusArchived   = "archived"   // Withdrawn after publishing, kept because the chain still has it
+)
+
+// ErrNotFound is returned for activities missing from the catalogue
+var ErrNotFound = errors.New("activity not found")
+
+// ErrConflict is returned for changes the current status doesn't allow
+var ErrConflict = errors.New("not allowed in the current status")
+
+// Activity IDs end up in contract input and the activity store, so they are kept plain
+var validID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// Activity is a catalogue entry describing something members earn rewards for
+type Activity struct {
+	ID             string     `json:"id"`
+	Branch         string     `json:"branch,omitempty"`
+	Title          string     `json:"title"`
+	Description    string     `json:"description,omitempty"`
+	Category       string     `json:"category"`
+	Instructor     string     `json:"instructor,omitempty"`
+	Location       string     `json:"location,omitempty"`
+	Schedule       Schedule   `json:"schedule"`
+	Capacity       int        `json:"capacity,omitempty"` // Places per session, 0 for no limit
+	RewardPoints   int        `json:"reward_points"`
+	ActiveFrom     *time.Time `json:"active_from,omitempty"`  // Rewards are only earned from this time
+	ActiveUntil    *time.Time `json:"active_until,omitempty"` // and until this one
+	Status         string     `json:"status"`
+	RubixRequestID string     `json:"rubix_request_id,omitempty"` // Contract execution that published the activity
+	PublishedAt    *time.Time `json:"published_at,omitempty"`
+	CreatedBy      string     `json:"created_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// IsActive reports whether rewards can be earned for the activity at t
+func (a Activity) IsActive(t time.Time) bool {
+	return a.Status == StatusPublished &&
+		(a.ActiveFrom == nil || !t.Before(*a.ActiveFrom)) &&
+		(a.ActiveUntil == nil || t.Before(*a.ActiveUntil))
+}
+
+// Validate checks the activity's fields, categories lists the allowed categories
+func (a Activity) Validate(categories []string) error {
+	var errs []error
+	if !validID.MatchString(a.ID) {
+		errs = append(errs, fmt.Errorf("id %q must be 1 to 64 letters, digits, '.', '_' or '-'", a.ID))
+	}
+	if a.Title == "" {
+		errs = append(errs, errors.New("title is required"))
+	}
+	if !slices.Contains(categories, a.Category) {
+		errs = append(errs, fmt.Errorf("category %q is not one of %v", a.Category, categories))
+	}
+	if a.RewardPoints <= 0 {
+		errs = append(errs, errors.New("reward_points must be positive"))
+	}
+	if a.Capacity < 0 {
+		errs = append(errs, errors.New("capacity can't be negative"))
+	}
+	if a.ActiveFrom != nil && a.ActiveUntil != nil && !a.ActiveUntil.After(*a.ActiveFrom) {
+		errs = append(errs, errors.New("active_until must be after active_from"))
+	}
+	if err := a.Schedule.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Filter selects catalogue activities; zero fields match everything
+type Filter struct {
+	Branch   string
+	Category string
+	Status   string
+	ActiveAt time.Time // Only activities earning rewards at this time
+}
+
+func (f Filter) matches(activity Activity) bool {
+	return activity.Branch == f.Branch &&
+		(f.Category == "" || activity.Category == f.Category) &&
+		(f.Status == "" || activity.Status == f.Status) &&
+		(f.ActiveAt.IsZero() || activity.IsActive(f.ActiveAt))
+}
+
+// Store keeps the catalogue in a JSON file, rewritten on every change
+type Store struct {
+	mu         sync.Mutex
+	path       string
+	activities map[string]Activity // By branch and ID
+}
+
+// Open loads the catalogue at path, starting empty if the file doesn't exist yet
+func Open(path string) (*Store, error) {
+	store := &Store{path: path, activities: make(map[string]Activity)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var activities []Activity
+	if err := json.Unmarshal(data, &activities); err != nil {
+		return nil, fmt.Errorf("failed to parse catalogue %s: %w", path, err)
+	}
+	for _, activity := range activities {
+		store.activities[key(activity.Branch, activity.ID)] = activity
+	}
+	return store, nil
+}
+
+func key(branch string, id string) string {
+	return branch + "/" + id
+}
+
+// List returns the activities matching the filter, sorted by ID
+func (s *Store) List(filter Filter) []Activity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activities := []Activity{}
+	for _, activity := range s.activities {
+		if filter.matches(activity) {
+			activities = append(activities, activity)
+		}
+	}
+	sort.Slice(activities, func(i, j int) bool { return activities[i].ID < activities[j].ID })
+	return activities
+}
+
+// Get returns one of a branch's activities
+func (s *Store) Get(branch string, id string) (Activity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activity, exists := s.activities[key(branch, id)]
+	if !exists {
+		return Activity{}, ErrNotFound
+	}
+	return activity, nil
+}
+
+// Create adds a draft activity
+func (s *Store) Create(activity Activity) (Activity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.activities[key(activity.Branch, activity.ID)]; exists {
+		return Activity{}, fmt.Errorf("%w: activity %s already exists", ErrConflict, activity.ID)
+	}
+	now := time.Now().UTC()
+	activity.Status = StatusDraft
+	activity.CreatedAt = now
+	activity.UpdatedAt = now
+	activity.RubixRequestID = ""
+	activity.PublishedAt = nil
+	return activity, s.put(activity)
+}
+
+// Update applies change to an activity and saves it. The ID, branch, status and
+// timestamps are kept whatever change does to them.
+func (s *Store) Update(branch string, id string, change func(*Activity) error) (Activity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, exists := s.activities[key(branch, id)]
+	if !exists {
+		return Activity{}, ErrNotFound
+	}
+	updated := current
+	if err := change(&updated); err != nil {
+		return Activity{}, err
+	}
+	updated.ID, updated.Branch, updated.Status = current.ID, current.Branch, current.Status
+	updated.RubixRequestID, updated.PublishedAt = current.RubixRequestID, current.PublishedAt
+	updated.CreatedBy, updated.CreatedAt = current.CreatedBy, current.CreatedAt
+	updated.UpdatedAt = time.Now().UTC()
+	return updated, s.put(updated)
+}
+
+// StartPublishing claims a draft for publishing, so only one request runs the add-activity contract for it
+func (s *Store) StartPublishing(branch string, id string) (Activity, error) {
+	return s.setStatus(branch, id, StatusDraft, StatusPublishing, nil)
+}
+
+// AbortPublishing returns an activity to draft after the add-activity contract failed
+func (s *Store) AbortPublishing(branch string, id string) (Activity, error) {
+	return s.setStatus(branch, id, StatusPublishing, StatusDraft, nil)
+}
+
+// MarkPublished records that the add-activity contract now holds the activity
+func (s *Store) MarkPublished(branch string, id string, rubixRequestID string) (Activity, error) {
+	return s.setStatus(branch, id, StatusPublishing, StatusPublished, func(activity *Activity) {
+		now := time.Now().UTC()
+		activity.RubixRequestID = rubixRequestID
+		activity.PublishedAt = &now
+	})
+}
+
+// Delete removes a draft. Published activities are archived instead, the chain keeps them anyway.
+func (s *Store) Delete(branch string, id string) (Activity, error) {
+	activity, err := s.setStatus(branch, id, StatusPublished, StatusArchived, nil)
+	if !errors.Is(err, ErrConflict) {
+		return activity, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activity, exists := s.activities[key(branch, id)]
+	if !exists {
+		return Activity{}, ErrNotFound
+	}
+	if activity.Status != StatusDraft {
+		return Activity{}, fmt.Errorf("%w: activity %s is already %s", ErrConflict, id, activity.Status)
+	}
+	delete(s.activities, key(branch, id))
+	if err := s.save(); err != nil {
+		s.activities[key(branch, id)] = activity
+		return Activity{}, err
+	}
+	return activity, nil
+}
+
+func (s *Store) setStatus(branch string, id string, from string, to string, change func(*Activity)) (Activity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activity, exists := s.activities[key(branch, id)]
+	if !exists {
+		return Activity{}, ErrNotFound
+	}
+	if activity.Status != from {
+		return Activity{}, fmt.Errorf("%w: activity %s is %s", ErrConflict, id, activity.Status)
+	}
+	activity.Status = to
+	activity.UpdatedAt = time.Now().UTC()
+	if change != nil {
+		change(&activity)
+	}
+	return activity, s.put(activity)
+}
+
+// put stores the activity and saves the catalogue, leaving the store unchanged if saving fails
+func (s *Store) put(activity Activity) error {
+	k := key(activity.Branch, activity.ID)
+	previous, existed := s.activities[k]
+	s.activities[k] = activity
+	if err := s.save(); err != nil {
+		if existed {
+			s.activities[k] = previous
+		} else {
+			delete(s.activities, k)
+		}
+		return err
+	}
+	return nil
+}
+
+// save writes the whole catalogue to its file
+func (s *Store) save() error {
+	activities := make([]Activity, 0, len(s.activities))
+	for _, activity := range s.activities {
+		activities = append(activities, activity)
+	}
+	sort.Slice(activities, func(i, j int) bool {
+		return key(activities[i].Branch, activities[i].ID) < key(activities[j].Branch, activities[j].ID)
+	})
+	return writeJSON(s.path, activities)
+}
+
+// writeJSON writes v to a temporary file and renames it over path,
+// so a crash never leaves a half written file
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package catalogue
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// How often a schedule repeats
+const (
+	RepeatNone    = ""
+	RepeatDaily   = "daily"
+	RepeatWeekly  = "weekly"
+	RepeatMonthly = "monthly"
+)
+
+// Most sessions listed for one query, so open-ended schedules stay bounded
+const maxSessions = 500
+
+// Schedule describes when an activity's sessions take place
+type Schedule struct {
+	Start    time.Time  `json:"start"`              // First session
+	Duration string     `json:"duration"`           // Length of each session, e.g. "45m"
+	Repeat   string     `json:"repeat,omitempty"`   // daily, weekly, monthly or empty for a single session
+	Interval int        `json:"interval,omitempty"` // Repeat every Interval days, weeks or months, defaults to 1
+	Until    *time.Time `json:"until,omitempty"`    // No session starts after this
+	Count    int        `json:"count,omitempty"`    // Number of sessions, 0 for no limit
+}
+
+// Session is one occurrence of a scheduled activity
+type Session struct {
+	Index int       `json:"index"` // Position in the schedule, the first session is 0
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (s Schedule) validate() error {
+	var errs []error
+	if s.Start.IsZero() {
+		errs = append(errs, errors.New("schedule.start is required"))
+	}
+	if duration, err := time.ParseDuration(s.Duration); err != nil || duration <= 0 {
+		errs = append(errs, fmt.Errorf("schedule.duration %q is not a positive duration such as \"45m\"", s.Duration))
+	}
+	switch s.Repeat {
+	case RepeatNone, RepeatDaily, RepeatWeekly, RepeatMonthly:
+	default:
+		errs = append(errs, fmt.Errorf("schedule.repeat %q is not one of daily, weekly or monthly", s.Repeat))
+	}
+	if s.Interval < 0 || s.Count < 0 {
+		errs = append(errs, errors.New("schedule.interval and schedule.count can't be negative"))
+	}
+	if s.Until != nil && s.Until.Before(s.Start) {
+		errs = append(errs, errors.New("schedule.until is before schedule.start"))
+	}
+	return errors.Join(errs...)
+}
+
+// nth returns the start of session n
+func (s Schedule) nth(n int) time.Time {
+	interval := s.Interval
+	if interval == 0 {
+		interval = 1
+	}
+	switch s.Repeat {
+	case RepeatDaily:
+		return s.Start.AddDate(0, 0, n*interval)
+	case RepeatWeekly:
+		return s.Start.AddDate(0, 0, 7*n*interval)
+	case RepeatMonthly:
+		return s.Start.AddDate(0, n*interval, 0)
+	}
+	return s.Start
+}
+
+// period returns the nominal time between sessions, 0 for a single session.
+// Months are taken at their average length.
+func (s Schedule) period() time.Duration {
+	interval := time.Duration(s.Interval)
+	if interval == 0 {
+		interval = 1
+	}
+	switch s.Repeat {
+	case RepeatDaily:
+		return interval * 24 * time.Hour
+	case RepeatWeekly:
+		return interval * 7 * 24 * time.Hour
+	case RepeatMonthly:
+		return interval*730*time.Hour + interval*30*time.Minute
+	}
+	return 0
+}
+
+// firstEndingAfter returns the index of the first session ending after from. It is estimated
+// from the period, then corrected for daylight saving and month lengths by stepping.
+func (s Schedule) firstEndingAfter(from time.Time, duration time.Duration) int {
+	period := s.period()
+	if period == 0 || !from.After(s.Start) {
+		return 0
+	}
+	n := int(from.Sub(s.Start) / period)
+	for n > 0 && s.nth(n-1).Add(duration).After(from) {
+		n--
+	}
+	for !s.nth(n).Add(duration).After(from) {
+		n++
+	}
+	return n
+}
+
+// Sessions lists the sessions overlapping [from, to), oldest first
+func (s Schedule) Sessions(from time.Time, to time.Time) []Session {
+	duration, err := time.ParseDuration(s.Duration)
+	if err != nil {
+		return nil
+	}
+	sessions := []Session{}
+	for n := s.firstEndingAfter(from, duration); len(sessions) < maxSessions; n++ {
+		if s.Count > 0 && n >= s.Count || s.Repeat == RepeatNone && n > 0 {
+			break
+		}
+		start := s.nth(n)
+		if !start.Before(to) || s.Until != nil && start.After(*s.Until) {
+			break
+		}
+		if end := start.Add(duration); end.After(from) {
+			sessions = append(sessions, Session{Index: n, Start: start, End: end})
+		}
+	}
+	return sessions
+}
+
+// Session returns session n, if the schedule has one
+func (s Schedule) Session(n int) (Session, bool) {
+	duration, err := time.ParseDuration(s.Duration)
+	if err != nil || n < 0 || s.Count > 0 && n >= s.Count || s.Repeat == RepeatNone && n > 0 {
+		return Session{}, false
+	}
+	start := s.nth(n)
+	if s.Until != nil && start.After(*s.Until) {
+		return Session{}, false
+	}
+	return Session{Index: n, Start: start, End: start.Add(duration)}, true
+}
+
+// Current returns the session open for check-in at t: one that has started, or
+// starts within lead, and hasn't ended yet
+func (s Schedule) Current(t time.Time, lead time.Duration) (Session, bool) {
+	sessions := s.Sessions(t, t.Add(lead+time.Nanosecond))
+	if len(sessions) == 0 {
+		return Session{}, false
+	}
+	return sessions[0], true
+}
@@ -0,0 +1,289 @@
+package catalogue
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+var scheduleStart = time.Date(2026, time.January, 15, 9, 0, 0, 0, time.UTC)
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func indices(sessions []Session) []int {
+	list := []int{}
+	for _, session := range sessions {
+		list = append(list, session.Index)
+	}
+	return list
+}
+
+func TestScheduleValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule Schedule
+		wantErr  bool
+	}{
+		{name: "single", schedule: Schedule{Start: scheduleStart, Duration: "45m"}},
+		{name: "weekly", schedule: Schedule{Start: scheduleStart, Duration: "1h", Repeat: RepeatWeekly, Interval: 2, Count: 10}},
+		{name: "no start", schedule: Schedule{Duration: "45m"}, wantErr: true},
+		{name: "bad duration", schedule: Schedule{Start: scheduleStart, Duration: "an hour"}, wantErr: true},
+		{name: "zero duration", schedule: Schedule{Start: scheduleStart, Duration: "0s"}, wantErr: true},
+		{name: "unknown repeat", schedule: Schedule{Start: scheduleStart, Duration: "45m", Repeat: "yearly"}, wantErr: true},
+		{name: "negative interval", schedule: Schedule{Start: scheduleStart, Duration: "45m", Repeat: RepeatDaily, Interval: -1}, wantErr: true},
+		{name: "negative count", schedule: Schedule{Start: scheduleStart, Duration: "45m", Repeat: RepeatDaily, Count: -1}, wantErr: true},
+		{name: "until before start", schedule: Schedule{Start: scheduleStart, Duration: "45m", Repeat: RepeatDaily, Until: timePtr(scheduleStart.Add(-time.Hour))}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.schedule.validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScheduleSessions(t *testing.T) {
+	day := 24 * time.Hour
+	daily := Schedule{Start: scheduleStart, Duration: "45m", Repeat: RepeatDaily}
+	tests := []struct {
+		name        string
+		schedule    Schedule
+		from        time.Time
+		to          time.Time
+		wantIndices []int
+		wantStarts  []time.Time // Checked when set
+	}{
+		{
+			name:        "single session in range",
+			schedule:    Schedule{Start: scheduleStart, Duration: "45m"},
+			from:        scheduleStart.Add(-day),
+			to:          scheduleStart.Add(day),
+			wantIndices: []int{0},
+		},
+		{
+			name:        "single session over",
+			schedule:    Schedule{Start: scheduleStart, Duration: "45m"},
+			from:        scheduleStart.Add(45 * time.Minute),
+			to:          scheduleStart.Add(day),
+			wantIndices: []int{},
+		},
+		{
+			name:        "daily window, end exclusive",
+			schedule:    daily,
+			from:        scheduleStart.Add(3 * day),
+			to:          scheduleStart.Add(5 * day),
+			wantIndices: []int{3, 4},
+		},
+		{
+			name:        "daily from inside a session",
+			schedule:    daily,
+			from:        scheduleStart.Add(3*day + 30*time.Minute),
+			to:          scheduleStart.Add(4*day + time.Minute),
+			wantIndices: []int{3, 4},
+		},
+		{
+			name:        "daily window before the start",
+			schedule:    daily,
+			from:        scheduleStart.Add(-10 * day),
+			to:          scheduleStart.Add(day),
+			wantIndices: []int{0},
+		},
+		{
+			name:        "daily years later",
+			schedule:    daily,
+			from:        scheduleStart.AddDate(3, 0, 0),
+			to:          scheduleStart.AddDate(3, 0, 2),
+			wantIndices: []int{1096, 1097},
+		},
+		{
+			name:        "every other week",
+			schedule:    Schedule{Start: scheduleStart, Duration: "1h", Repeat: RepeatWeekly, Interval: 2},
+			from:        scheduleStart.Add(day),
+			to:          scheduleStart.Add(43 * day),
+			wantIndices: []int{1, 2, 3},
+			wantStarts:  []time.Time{scheduleStart.Add(14 * day), scheduleStart.Add(28 * day), scheduleStart.Add(42 * day)},
+		},
+		{
+			name:        "monthly keeps the day of month",
+			schedule:    Schedule{Start: scheduleStart, Duration: "1h", Repeat: RepeatMonthly},
+			from:        time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC),
+			to:          time.Date(2026, time.May, 1, 0, 0, 0, 0, time.UTC),
+			wantIndices: []int{1, 2, 3},
+			wantStarts: []time.Time{
+				time.Date(2026, time.February, 15, 9, 0, 0, 0, time.UTC),
+				time.Date(2026, time.March, 15, 9, 0, 0, 0, time.UTC),
+				time.Date(2026, time.April, 15, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:        "quarterly years later",
+			schedule:    Schedule{Start: scheduleStart, Duration: "1h", Repeat: RepeatMonthly, Interval: 3},
+			from:        time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC),
+			to:          time.Date(2031, time.January, 1, 0, 0, 0, 0, time.UTC),
+			wantIndices: []int{16, 17, 18, 19},
+		},
+		{
+			name:        "count",
+			schedule:    Schedule{Start: scheduleStart, Duration: "45m", Repeat: RepeatDaily, Count: 3},
+			from:        scheduleStart.Add(day),
+			to:          scheduleStart.Add(10 * day),
+			wantIndices: []int{1, 2},
+		},
+		{
+			name:        "until",
+			schedule:    Schedule{Start: scheduleStart, Duration: "45m", Repeat: RepeatDaily, Until: timePtr(scheduleStart.Add(2 * day))},
+			from:        scheduleStart,
+			to:          scheduleStart.Add(10 * day),
+			wantIndices: []int{0, 1, 2},
+		},
+		{
+			name:        "bad duration",
+			schedule:    Schedule{Start: scheduleStart, Duration: "soon", Repeat: RepeatDaily},
+			from:        scheduleStart,
+			to:          scheduleStart.Add(10 * day),
+			wantIndices: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := tt.schedule.Sessions(tt.from, tt.to)
+			if got := indices(sessions); !slices.Equal(got, tt.wantIndices) && !(tt.wantIndices == nil && sessions == nil) {
+				t.Fatalf("Sessions() = %v, want %v", got, tt.wantIndices)
+			}
+			for i, start := range tt.wantStarts {
+				if !sessions[i].Start.Equal(start) {
+					t.Fatalf("session %d starts %s, want %s", sessions[i].Index, sessions[i].Start, start)
+				}
+			}
+		})
+	}
+}
+
+func TestScheduleSessionsBounded(t *testing.T) {
+	schedule := Schedule{Start: scheduleStart, Duration: "45m", Repeat: RepeatDaily}
+	if sessions := schedule.Sessions(scheduleStart, scheduleStart.AddDate(10, 0, 0)); len(sessions) != maxSessions {
+		t.Fatalf("Sessions() over ten years listed %d sessions, want %d", len(sessions), maxSessions)
+	}
+}
+
+func TestScheduleDaylightSaving(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+	tests := []struct {
+		name     string
+		schedule Schedule
+	}{
+		{name: "daily across spring", schedule: Schedule{Start: time.Date(2026, time.March, 25, 9, 0, 0, 0, amsterdam), Duration: "45m", Repeat: RepeatDaily}},
+		{name: "weekly across autumn", schedule: Schedule{Start: time.Date(2026, time.October, 6, 18, 30, 0, 0, amsterdam), Duration: "1h", Repeat: RepeatWeekly}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := tt.schedule.Sessions(tt.schedule.Start, tt.schedule.Start.AddDate(0, 0, 28))
+			if len(sessions) < 4 {
+				t.Fatalf("Sessions() listed %d sessions, want at least 4", len(sessions))
+			}
+			for _, session := range sessions {
+				if session.Start.Hour() != tt.schedule.Start.Hour() || session.Start.Minute() != tt.schedule.Start.Minute() {
+					t.Fatalf("session %d starts %s, want the same wall clock time as %s", session.Index, session.Start, tt.schedule.Start)
+				}
+			}
+			// Looking up from the middle of the range must agree with listing from the start
+			middle := sessions[len(sessions)/2]
+			later := tt.schedule.Sessions(middle.Start, middle.End)
+			if len(later) != 1 || later[0].Index != middle.Index {
+				t.Fatalf("Sessions() from session %d = %v", middle.Index, indices(later))
+			}
+		})
+	}
+}
+
+func TestScheduleFirstEndingAfter(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		amsterdam = time.UTC
+	}
+	start := time.Date(2026, time.January, 31, 23, 30, 0, 0, amsterdam)
+	duration := 90 * time.Minute
+	schedules := []Schedule{
+		{Start: start, Repeat: RepeatDaily},
+		{Start: start, Repeat: RepeatDaily, Interval: 3},
+		{Start: start, Repeat: RepeatWeekly},
+		{Start: start, Repeat: RepeatMonthly},
+		{Start: start, Repeat: RepeatMonthly, Interval: 5},
+	}
+	for _, schedule := range schedules {
+		// The answer found by stepping from the first session
+		want := 0
+		for from := start.Add(-time.Hour); from.Before(start.AddDate(2, 0, 0)); from = from.Add(7 * time.Hour) {
+			for !schedule.nth(want).Add(duration).After(from) {
+				want++
+			}
+			if got := schedule.firstEndingAfter(from, duration); got != want {
+				t.Fatalf("%s every %d: firstEndingAfter(%s) = %d, want %d", schedule.Repeat, schedule.Interval, from, got, want)
+			}
+		}
+	}
+}
+
+func TestScheduleSession(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule Schedule
+		n        int
+		want     bool
+	}{
+		{name: "single first", schedule: Schedule{Start: scheduleStart, Duration: "45m"}, n: 0, want: true},
+		{name: "single second", schedule: Schedule{Start: scheduleStart, Duration: "45m"}, n: 1, want: false},
+		{name: "negative", schedule: Schedule{Start: scheduleStart, Duration: "45m", Repeat: RepeatDaily}, n: -1, want: false},
+		{name: "open ended", schedule: Schedule{Start: scheduleStart, Duration: "45m", Repeat: RepeatDaily}, n: 1000, want: true},
+		{name: "last counted", schedule: Schedule{Start: scheduleStart, Duration: "45m", Repeat: RepeatDaily, Count: 3}, n: 2, want: true},
+		{name: "past count", schedule: Schedule{Start: scheduleStart, Duration: "45m", Repeat: RepeatDaily, Count: 3}, n: 3, want: false},
+		{name: "on until", schedule: Schedule{Start: scheduleStart, Duration: "45m", Repeat: RepeatDaily, Until: timePtr(scheduleStart.AddDate(0, 0, 2))}, n: 2, want: true},
+		{name: "past until", schedule: Schedule{Start: scheduleStart, Duration: "45m", Repeat: RepeatDaily, Until: timePtr(scheduleStart.AddDate(0, 0, 2))}, n: 3, want: false},
+		{name: "bad duration", schedule: Schedule{Start: scheduleStart, Duration: "soon"}, n: 0, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, exists := tt.schedule.Session(tt.n)
+			if exists != tt.want {
+				t.Fatalf("Session(%d) exists = %v, want %v", tt.n, exists, tt.want)
+			}
+			if exists && (session.Index != tt.n || !session.Start.Equal(tt.schedule.nth(tt.n)) || session.End.Sub(session.Start) != 45*time.Minute) {
+				t.Fatalf("Session(%d) = %+v", tt.n, session)
+			}
+		})
+	}
+}
+
+func TestScheduleCurrent(t *testing.T) {
+	lead := 15 * time.Minute
+	single := Schedule{Start: scheduleStart, Duration: "45m"}
+	daily := Schedule{Start: scheduleStart, Duration: "45m", Repeat: RepeatDaily}
+	tests := []struct {
+		name      string
+		schedule  Schedule
+		at        time.Time
+		wantIndex int // -1 when no session is open
+	}{
+		{name: "before check-in opens", schedule: single, at: scheduleStart.Add(-20 * time.Minute), wantIndex: -1},
+		{name: "check-in just opened", schedule: single, at: scheduleStart.Add(-lead), wantIndex: 0},
+		{name: "running", schedule: single, at: scheduleStart.Add(30 * time.Minute), wantIndex: 0},
+		{name: "just ended", schedule: single, at: scheduleStart.Add(45 * time.Minute), wantIndex: -1},
+		{name: "between daily sessions", schedule: daily, at: scheduleStart.Add(12 * time.Hour), wantIndex: -1},
+		{name: "next day opening", schedule: daily, at: scheduleStart.Add(24*time.Hour - 5*time.Minute), wantIndex: 1},
+		{name: "later day running", schedule: daily, at: scheduleStart.Add(10*24*time.Hour + time.Minute), wantIndex: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, exists := tt.schedule.Current(tt.at, lead)
+			if exists != (tt.wantIndex >= 0) || exists && session.Index != tt.wantIndex {
+				t.Fatalf("Current() = %d, %v, want %d", session.Index, exists, tt.wantIndex)
+			}
+		})
+	}
+}
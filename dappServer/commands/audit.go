@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"dapp-server/audit"
+	"dapp-server/config"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var verifyAuditCmd = &cobra.Command{
+	Use:   "verify-audit [audit log path]",
+	Short: "Check the audit log's hash chain for modified, removed or reordered entries, keyed with audit.key_env when set",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return err
+		}
+		path := config.GetAuditLogPath(cfg)
+		if len(args) == 1 {
+			path = args[0]
+		}
+
+		report, err := audit.Verify(path, config.GetAuditKey(cfg))
+		if err != nil {
+			return err
+		}
+		output, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(output))
+		if !report.Valid {
+			return fmt.Errorf("audit log %s has been tampered with at entry %d", path, report.BrokenAt)
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(verifyAuditCmd)
+}
@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"dapp-server/config"
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/cobra"
+)
+
+// AllowInvalidConfig starts the server even when the configuration fails validation
+var AllowInvalidConfig bool
+
+// Flags selecting the configuration, shared by every command
+var (
+	configPath      string
+	configProfile   string
+	configOverrides []string
+)
+
+// LoadOptions returns the configuration layers selected on the command line
+func LoadOptions() (config.LoadOptions, error) {
+	overrides := make(map[string]string, len(configOverrides))
+	for _, override := range configOverrides {
+		key, value, found := strings.Cut(override, "=")
+		if !found || key == "" {
+			return config.LoadOptions{}, fmt.Errorf("--set %q must look like key=value", override)
+		}
+		overrides[key] = value
+	}
+	return config.LoadOptions{Path: configPath, Profile: configProfile, Overrides: overrides}, nil
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the dapp server configuration",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration for missing, duplicate and malformed settings",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return err
+		}
+		if errs := config.Validate(cfg); len(errs) > 0 {
+			// The report is the output, don't repeat it as cobra's error
+			cmd.SilenceUsage = true
+			fmt.Fprintln(cmd.OutOrStdout(), errs.Error())
+			return fmt.Errorf("configuration is invalid")
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "configuration is valid")
+		return nil
+	},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration after every layer is applied",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "# files: %s\n", strings.Join(config.GetConfigFiles(), ", "))
+		if profile := config.GetProfile(); profile != "" {
+			fmt.Fprintf(cmd.OutOrStdout(), "# profile: %s\n", profile)
+		}
+		return toml.NewEncoder(cmd.OutOrStdout()).Encode(cfg)
+	},
+}
+
+func init() {
+	RootCmd.PersistentFlags().StringVar(&configPath, "config", config.DefaultConfigPath, "config file")
+	RootCmd.PersistentFlags().StringVar(&configProfile, "profile", "", "profile to layer over the config file from config.<profile>.toml, defaults to $"+config.ProfileEnv)
+	RootCmd.PersistentFlags().StringArrayVar(&configOverrides, "set", nil, "override a config key, e.g. --set server.listen_address=:8080 (repeatable)")
+	RootCmd.Flags().BoolVar(&AllowInvalidConfig, "allow-invalid-config", false, "start the server even if the configuration fails validation")
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configShowCmd)
+	RootCmd.AddCommand(configCmd)
+}
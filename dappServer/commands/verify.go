@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"dapp-server/config"
+	rubix "dapp-server/rubix-interaction"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var verifyContractCmd = &cobra.Command{
+	Use:   "verify-contract <contract name or hash>",
+	Short: "Compare a deployed contract's files on every node with the local wasm and lib.rs",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return err
+		}
+		contract, exists := config.GetContractByHash(cfg, args[0])
+		if !exists {
+			contract, exists = cfg.Contracts[args[0]]
+		}
+		if !exists {
+			return fmt.Errorf("contract %s is not in the contract registry", args[0])
+		}
+
+		verification, err := rubix.VerifyContract(cfg, contract)
+		if err != nil {
+			return err
+		}
+		report, err := json.MarshalIndent(verification, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(report))
+		if verification.Drifted() {
+			return fmt.Errorf("contract %s has drifted from its local sources", contract.Hash)
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(verifyContractCmd)
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"math"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// sharedBranch is the single unnamed branch of a server without branches configured
+func sharedBranch(config *Config) Branch {
+	return Branch{
+		AddActivityContract: config.Loyalty.AddActivityContract,
+		TransferContract:    config.Loyalty.TransferContract,
+		ActivityUpdatePath:  config.Storage.ActivityUpdatePath,
+	}
+}
+
+// GetBranch returns the branch with the given ID, or the default branch for an empty ID.
+// Without branches configured the empty ID is the shared branch using the loyalty and storage settings.
+func GetBranch(config *Config, id string) (Branch, bool) {
+	if id == "" {
+		if len(config.Branches) == 0 {
+			return sharedBranch(config), true
+		}
+		id = config.DefaultBranch
+	}
+	branch, exists := config.Branches[id]
+	if !exists {
+		return Branch{}, false
+	}
+	branch.ID = id
+	if branch.ActivityUpdatePath == "" {
+		branch.ActivityUpdatePath = branchStorePath(config.Storage.ActivityUpdatePath, id)
+	}
+	return branch, true
+}
+
+// ListBranches returns every branch sorted by ID, or only the shared branch when none are configured
+func ListBranches(config *Config) []Branch {
+	if len(config.Branches) == 0 {
+		return []Branch{sharedBranch(config)}
+	}
+	ids := make([]string, 0, len(config.Branches))
+	for id := range config.Branches {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	branches := make([]Branch, 0, len(ids))
+	for _, id := range ids {
+		branch, _ := GetBranch(config, id)
+		branches = append(branches, branch)
+	}
+	return branches
+}
+
+// GetBranchByContract returns the branch owning a deployed contract hash
+func GetBranchByContract(config *Config, hash string) (Branch, bool) {
+	for _, branch := range ListBranches(config) {
+		if branch.AddActivityContract == hash || branch.TransferContract == hash {
+			return branch, true
+		}
+		for _, key := range branch.Contracts {
+			if config.Contracts[key].Hash == hash {
+				return branch, true
+			}
+		}
+	}
+	return Branch{}, false
+}
+
+// GetBranchesByAdmin returns the branches listing did among their admins, sorted by ID
+func GetBranchesByAdmin(config *Config, did string) []Branch {
+	branches := []Branch{}
+	for _, branch := range ListBranches(config) {
+		if branch.ID != "" && slices.Contains(branch.AdminDIDs, did) {
+			branches = append(branches, branch)
+		}
+	}
+	return branches
+}
+
+// GetActivityStorePath returns the activity store a contract writes to: its branch's,
+// or the shared store for contracts no branch owns
+func GetActivityStorePath(config *Config, contractHash string) string {
+	if branch, exists := GetBranchByContract(config, contractHash); exists {
+		return branch.ActivityUpdatePath
+	}
+	return config.Storage.ActivityUpdatePath
+}
+
+// GetActivityStorePaths returns every activity store in use
+func GetActivityStorePaths(config *Config) []string {
+	paths := []string{}
+	for _, branch := range append(ListBranches(config), sharedBranch(config)) {
+		if branch.ActivityUpdatePath != "" && !slices.Contains(paths, branch.ActivityUpdatePath) {
+			paths = append(paths, branch.ActivityUpdatePath)
+		}
+	}
+	return paths
+}
+
+// branchStorePath namespaces the shared store for a branch, activities.json becoming activities.<branch>.json
+func branchStorePath(sharedPath string, id string) string {
+	if sharedPath == "" {
+		return ""
+	}
+	extension := filepath.Ext(sharedPath)
+	return strings.TrimSuffix(sharedPath, extension) + "." + id + extension
+}
+
+// IsBranchAdmin reports whether did administers the branch. The shared branch has no admin list.
+func IsBranchAdmin(branch Branch, did string) bool {
+	if branch.ID == "" {
+		return true
+	}
+	return slices.Contains(branch.AdminDIDs, did)
+}
+
+// GetRewardAmount applies the branch's reward rules to an activity's reward points
+func GetRewardAmount(rules RewardRules, rewardPoints int) float64 {
+	amount := float64(rewardPoints)
+	if rules.Multiplier > 0 {
+		amount *= rules.Multiplier
+	}
+	if rules.MaxPoints > 0 {
+		amount = math.Min(amount, rules.MaxPoints)
+	}
+	return amount
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGetRewardAmount(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  RewardRules
+		points int
+		want   float64
+	}{
+		{name: "no rules", rules: RewardRules{}, points: 10, want: 10},
+		{name: "multiplier", rules: RewardRules{Multiplier: 1.5}, points: 10, want: 15},
+		{name: "fractional multiplier", rules: RewardRules{Multiplier: 0.25}, points: 10, want: 2.5},
+		{name: "under the cap", rules: RewardRules{MaxPoints: 20}, points: 10, want: 10},
+		{name: "capped", rules: RewardRules{MaxPoints: 20}, points: 50, want: 20},
+		{name: "capped after multiplying", rules: RewardRules{Multiplier: 3, MaxPoints: 20}, points: 10, want: 20},
+		{name: "negative multiplier ignored", rules: RewardRules{Multiplier: -2}, points: 10, want: 10},
+		{name: "zero points", rules: RewardRules{Multiplier: 2, MaxPoints: 5}, points: 0, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetRewardAmount(tt.rules, tt.points); got != tt.want {
+				t.Fatalf("GetRewardAmount(%+v, %d) = %v, want %v", tt.rules, tt.points, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBranchLookups(t *testing.T) {
+	config := &Config{
+		DefaultBranch: "north",
+		Storage:       StorageConfig{ActivityUpdatePath: "data/activities.json"},
+		Contracts: map[string]Contract{
+			"north-add":   {Hash: "hash-north-add"},
+			"north-extra": {Hash: "hash-north-extra"},
+			"south-add":   {Hash: "hash-south-add"},
+		},
+		Branches: map[string]Branch{
+			"north": {AdminDIDs: []string{"did:ann", "did:bo"}, Contracts: []string{"north-add", "north-extra"}, AddActivityContract: "hash-north-add"},
+			"south": {AdminDIDs: []string{"did:bo"}, Contracts: []string{"south-add"}, AddActivityContract: "hash-south-add", ActivityUpdatePath: "south.json"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		lookup    func() (Branch, bool)
+		wantID    string
+		wantStore string
+	}{
+		{name: "by id", lookup: func() (Branch, bool) { return GetBranch(config, "south") }, wantID: "south", wantStore: "south.json"},
+		{name: "default", lookup: func() (Branch, bool) { return GetBranch(config, "") }, wantID: "north", wantStore: "data/activities.north.json"},
+		{name: "unknown", lookup: func() (Branch, bool) { return GetBranch(config, "east") }},
+		{name: "by activity contract", lookup: func() (Branch, bool) { return GetBranchByContract(config, "hash-south-add") }, wantID: "south", wantStore: "south.json"},
+		{name: "by listed contract", lookup: func() (Branch, bool) { return GetBranchByContract(config, "hash-north-extra") }, wantID: "north", wantStore: "data/activities.north.json"},
+		{name: "by unowned contract", lookup: func() (Branch, bool) { return GetBranchByContract(config, "hash-other") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			branch, exists := tt.lookup()
+			if exists != (tt.wantID != "") || branch.ID != tt.wantID || branch.ActivityUpdatePath != tt.wantStore {
+				t.Fatalf("lookup = %q (%s), %v, want %q (%s)", branch.ID, branch.ActivityUpdatePath, exists, tt.wantID, tt.wantStore)
+			}
+		})
+	}
+
+	for did, want := range map[string][]string{"did:ann": {"north"}, "did:bo": {"north", "south"}, "did:cy": {}} {
+		ids := []string{}
+		for _, branch := range GetBranchesByAdmin(config, did) {
+			ids = append(ids, branch.ID)
+		}
+		if !slices.Equal(ids, want) {
+			t.Errorf("GetBranchesByAdmin(%s) = %v, want %v", did, ids, want)
+		}
+	}
+	if got := GetActivityStorePath(config, "hash-other"); got != "data/activities.json" {
+		t.Errorf("GetActivityStorePath() for an unowned contract = %s, want the shared store", got)
+	}
+}
@@ -1,130 +1,596 @@
 package config
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"net"
+	"net/url"
 	"os"
-	"sync"
-
-	"github.com/BurntSushi/toml"
-	"github.com/joho/godotenv"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // Struct to represent each node
 type Node struct {
-	Name string `toml:"name"`
-	Port string `toml:"port"`
-	DID  string `toml:"did"`
-	Path string `toml:"path"` // Assuming Path is a field in the Node struct
+	Name        string `toml:"name"`
+	Port        string `toml:"port"`
+	DID         string `toml:"did"`
+	Path        string `toml:"path"`         // Directory holding the node's data, local or mounted
+	URL         string `toml:"url"`          // Base URL such as https://node1.example.org:20002, defaults to http://localhost:<port>
+	CACert      string `toml:"ca_cert"`      // PEM bundle used to verify the node's TLS certificate
+	ClientCert  string `toml:"client_cert"`  // PEM client certificate for nodes requiring mutual TLS
+	ClientKey   string `toml:"client_key"`   // PEM key for ClientCert
+	ArtifactURL string `toml:"artifact_url"` // URL serving a contract's wasm, with {hash} replaced by the contract hash
+	// Addresses or CIDRs the node's callbacks may come from, defaults to the addresses its URL resolves to
+	CallbackOrigins []string `toml:"callback_origins"`
+	DIDs            []string `toml:"dids"` // Further DIDs hosted on the node besides DID
 }
 
-// Struct to hold the configuration
-type Config struct {
-	Nodes map[string]Node `toml:"nodes"`
+// GetNodeURL returns the base URL the node's API is served on
+func GetNodeURL(node Node) string {
+	if node.URL != "" {
+		return strings.TrimSuffix(node.URL, "/")
+	}
+	return fmt.Sprintf("http://localhost:%s", node.Port)
+}
+
+// IsLocalNode reports whether the node runs on this host
+func IsLocalNode(node Node) bool {
+	if node.URL == "" {
+		return true
+	}
+	parsed, err := url.Parse(node.URL)
+	if err != nil {
+		return false
+	}
+	switch parsed.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+// Struct to represent a host function a contract may import
+type HostFunctionGrant struct {
+	Name  string   `toml:"name"`
+	Paths []string `toml:"paths"` // Files the host function may touch, empty means none
+}
+
+// Struct to represent a contract registry entry
+type Contract struct {
+	Name          string              `toml:"name"`
+	Hash          string              `toml:"hash"`
+	WasmPath      string              `toml:"wasm_path"`   // Local wasm the contract was deployed from
+	LibPath       string              `toml:"lib_path"`    // Local lib.rs the contract was deployed from
+	WasmSHA256    string              `toml:"wasm_sha256"` // Optional pinned digest of the deployed wasm
+	LibSHA256     string              `toml:"lib_sha256"`  // Optional pinned digest of the deployed lib.rs
+	HostFunctions []HostFunctionGrant `toml:"host_functions"`
+}
+
+// Struct to hold logging settings
+type LoggingConfig struct {
+	Level  string `toml:"level"`  // debug, info, warn or error
+	Format string `toml:"format"` // text or json
+}
+
+// Struct to hold tracing settings
+type TracingConfig struct {
+	Exporter    string  `toml:"exporter"`     // otlp, stdout or empty to disable tracing
+	Endpoint    string  `toml:"endpoint"`     // OTLP/HTTP collector host:port, defaults to localhost:4318
+	Insecure    bool    `toml:"insecure"`     // Send OTLP over plain HTTP
+	ServiceName string  `toml:"service_name"` // Defaults to dapp-server
+	SampleRatio float64 `toml:"sample_ratio"` // Fraction of new traces recorded, 0 means all
+}
+
+// Struct to hold the HTTP listener settings
+type ServerConfig struct {
+	ListenAddress   string   `toml:"listen_address"`   // Defaults to :9000
+	PublicURL       string   `toml:"public_url"`       // Base URL nodes reach the dapp server at for callbacks, defaults to localhost on the listen port
+	TLSCert         string   `toml:"tls_cert"`         // PEM certificate, serving HTTPS when set together with TLSKey
+	TLSKey          string   `toml:"tls_key"`          // PEM key for TLSCert
+	ReadTimeout     string   `toml:"read_timeout"`     // Time allowed to read a request, e.g. "30s"
+	WriteTimeout    string   `toml:"write_timeout"`    // Time allowed to write a response, unset means no limit
+	ShutdownTimeout string   `toml:"shutdown_timeout"` // How long shutdown waits for in-flight work, e.g. "30s"
+	TrustedProxies  []string `toml:"trusted_proxies"`  // Proxies whose X-Forwarded-For is believed, none by default
+}
+
+// Struct to represent a static API key, used by kiosks
+type APIKey struct {
+	Name      string   `toml:"name"`       // Identifies the key holder in logs and audit records
+	KeySHA256 string   `toml:"key_sha256"` // Hex SHA-256 of the key, the key itself is never stored
+	Roles     []string `toml:"roles"`
+	Branches  []string `toml:"branches"` // Branches the key works for, empty means every branch for admins
+}
+
+// Struct to hold the settings for verifying staff app JWTs
+type JWTConfig struct {
+	HMACSecretEnv string `toml:"hmac_secret_env"` // Environment variable holding the HS256/384/512 secret
+	JWKSFile      string `toml:"jwks_file"`       // Local JWKS file with the RSA or EC public keys
+	Issuer        string `toml:"issuer"`          // Required "iss" claim, if set
+	Audience      string `toml:"audience"`        // Required "aud" claim, if set
+	RolesClaim    string `toml:"roles_claim"`     // Claim listing the caller's roles, defaults to "roles"
+	DIDsClaim     string `toml:"dids_claim"`      // Claim listing the DIDs the caller may act as, defaults to "dids"
+	BranchesClaim string `toml:"branches_claim"`  // Claim listing the caller's branches, defaults to "branches"
+}
+
+// Struct to hold the API authentication settings
+type AuthConfig struct {
+	Enabled  bool                `toml:"enabled"` // When false every API request is served anonymously
+	APIKeys  []APIKey            `toml:"api_keys"`
+	JWT      JWTConfig           `toml:"jwt"`
+	Policy   map[string][]string `toml:"policy"`   // Roles allowed each permission, replacing the default for that permission
+	Bindings map[string][]string `toml:"bindings"` // DIDs each principal subject may act as, on top of any token claim
+}
+
+// Struct to hold the node callback settings
+type CallbackConfig struct {
+	SecretEnv string `toml:"secret_env"` // Environment variable holding the shared callback secret, unset disables the check
+}
+
+// GetCallbackSecret returns the shared callback secret, or nil when none is configured
+func GetCallbackSecret(config *Config) []byte {
+	if config.Callbacks.SecretEnv == "" {
+		return nil
+	}
+	secret := os.Getenv(config.Callbacks.SecretEnv)
+	if secret == "" {
+		return nil
+	}
+	return []byte(secret)
+}
+
+// GetAuditKey returns the audit log's HMAC key, or nil when none is configured
+func GetAuditKey(config *Config) []byte {
+	if config.Audit.KeyEnv == "" {
+		return nil
+	}
+	key := os.Getenv(config.Audit.KeyEnv)
+	if key == "" {
+		return nil
+	}
+	return []byte(key)
+}
+
+// Struct to hold the CORS settings, empty lists fall back to the defaults
+type CORSConfig struct {
+	AllowOrigins     []string `toml:"allow_origins"` // Defaults to every origin
+	AllowMethods     []string `toml:"allow_methods"`
+	AllowHeaders     []string `toml:"allow_headers"` // Authentication and request ID headers are always allowed
+	ExposeHeaders    []string `toml:"expose_headers"`
+	AllowCredentials bool     `toml:"allow_credentials"`
+	MaxAge           string   `toml:"max_age"` // How long browsers may cache preflight results, e.g. "10m"
+}
+
+// Struct to represent one rate limit, a token bucket per client
+type RateLimit struct {
+	RequestsPerMinute float64 `toml:"requests_per_minute"`
+	Burst             int     `toml:"burst"`
+}
+
+// Struct to hold the rate limits, per API key or JWT subject and otherwise per client IP
+type RateLimitConfig struct {
+	Enabled   bool      `toml:"enabled"`
+	Read      RateLimit `toml:"read"`      // Queries and event streams
+	Expensive RateLimit `toml:"expensive"` // Routes that deploy, execute contracts or move tokens
+	Client    RateLimit `toml:"client"`    // Every API request per client IP, counted before authentication so failed credentials are limited too
 }
 
 var (
-	instance *Config
-	once     sync.Once
+	defaultReadRateLimit      = RateLimit{RequestsPerMinute: 600, Burst: 60}
+	defaultExpensiveRateLimit = RateLimit{RequestsPerMinute: 30, Burst: 5}
+	defaultClientRateLimit    = RateLimit{RequestsPerMinute: 1200, Burst: 120}
 )
 
-// LoadConfig initializes the configuration (Singleton)
-func LoadConfig(filepath string) {
-	once.Do(func() {
-		instance = &Config{}
-		if _, err := toml.DecodeFile(filepath, instance); err != nil {
-			log.Fatalf("Error loading config file: %v", err)
-		}
-	})
+// GetReadRateLimit returns the limit for read routes, falling back to the default
+func GetReadRateLimit(config *Config) RateLimit {
+	return rateLimitOrDefault(config.RateLimit.Read, defaultReadRateLimit)
 }
 
-// GetConfig returns the global configuration instance
-func GetConfig() (*Config, error) {
-	if instance == nil {
-		// log.Fatal("Config not loaded. Call LoadConfig() first.")
-		return nil, fmt.Errorf("Config not loaded. Call LoadConfig() first")
+// GetExpensiveRateLimit returns the limit for expensive routes, falling back to the default
+func GetExpensiveRateLimit(config *Config) RateLimit {
+	return rateLimitOrDefault(config.RateLimit.Expensive, defaultExpensiveRateLimit)
+}
+
+// GetClientRateLimit returns the per IP limit checked before authentication, falling back to the default
+func GetClientRateLimit(config *Config) RateLimit {
+	return rateLimitOrDefault(config.RateLimit.Client, defaultClientRateLimit)
+}
+
+func rateLimitOrDefault(limit RateLimit, fallback RateLimit) RateLimit {
+	if limit.RequestsPerMinute <= 0 {
+		return fallback
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = 1
 	}
-	return instance, nil
+	return limit
 }
 
-// GetNodeNameByPort searches for a node by its port and returns its name
-func GetNodeNameByPort(config *Config, port string) (string, bool) {
-	for _, node := range config.Nodes {
-		if node.Port == port {
-			return node.Name, true
-		}
+// Struct to hold the idempotency key settings
+type IdempotencyConfig struct {
+	TTL string `toml:"ttl"` // How long a response is kept for replay, e.g. "24h"
+}
+
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// GetIdempotencyTTL returns how long idempotent responses are kept, falling back to the default
+func GetIdempotencyTTL(config *Config) time.Duration {
+	return parseDuration(config.Idempotency.TTL, defaultIdempotencyTTL)
+}
+
+// Struct to hold the audit log settings
+type AuditConfig struct {
+	Path   string `toml:"path"`    // Hash-chained JSON Lines file, defaults to audit.jsonl
+	KeyEnv string `toml:"key_env"` // Environment variable holding the HMAC key entries are chained with, unset for plain hashes
+}
+
+const defaultAuditLogPath = "audit.jsonl"
+
+// GetAuditLogPath returns the audit log file, falling back to the default
+func GetAuditLogPath(config *Config) string {
+	if config.Audit.Path == "" {
+		return defaultAuditLogPath
 	}
-	return "", false
+	return config.Audit.Path
 }
-func GetPathByPort(config *Config, port string) (string, bool) {
-	for _, node := range config.Nodes {
-		if node.Port == port {
-			return node.Path, true
-		}
+
+// Struct to hold the contracts the loyalty endpoints execute
+type LoyaltyConfig struct {
+	AddActivityContract string `toml:"add_activity_contract"` // Hash of the contract recording activities
+	TransferContract    string `toml:"transfer_contract"`     // Hash of the contract transferring rewards
+}
+
+// Struct to hold the rules turning an activity's reward points into tokens
+type RewardRules struct {
+	Multiplier float64 `toml:"multiplier"` // Scales an activity's reward points, 0 means 1
+	MaxPoints  float64 `toml:"max_points"` // Caps what one transfer awards, 0 means no cap
+}
+
+// Struct to represent a branch of the association, a tenant with its own admins, contracts and activity store
+type Branch struct {
+	ID                  string      `toml:"-"`
+	Name                string      `toml:"name"`
+	AdminDIDs           []string    `toml:"admin_dids"`            // DIDs that may add activities and transfer rewards for the branch
+	Contracts           []string    `toml:"contracts"`             // Keys of the contract registry entries belonging to the branch
+	AddActivityContract string      `toml:"add_activity_contract"` // Hash of the branch's activity contract
+	TransferContract    string      `toml:"transfer_contract"`     // Hash of the branch's reward contract
+	ActivityUpdatePath  string      `toml:"activity_update_path"`  // Defaults to storage.activity_update_path with the branch ID added to the file name
+	Rewards             RewardRules `toml:"rewards"`
+}
+
+// Struct to hold where the dapp keeps its local data
+type StorageConfig struct {
+	ActivityUpdatePath string `toml:"activity_update_path"` // JSON file of activities and their reward points
+	ArtifactCacheDir   string `toml:"artifact_cache_dir"`   // Directory contracts fetched from remote nodes are cached in, defaults to artifact-cache
+}
+
+const defaultArtifactCacheDir = "artifact-cache"
+
+// GetArtifactCacheDir returns the directory remote contract artifacts are cached in, falling back to the default
+func GetArtifactCacheDir(config *Config) string {
+	if config.Storage.ArtifactCacheDir == "" {
+		return defaultArtifactCacheDir
 	}
-	return "", false
+	return config.Storage.ArtifactCacheDir
 }
 
-func GetNodeNameByDid(config *Config, did string) (string, bool) {
-	for _, node := range config.Nodes {
-		if node.DID == did {
-			return node.Name, true
+// Struct to hold the contract build settings
+type BuildConfig struct {
+	ProjectRoots []string `toml:"project_roots"` // Directories deploy requests may read contracts and build cargo projects from, none disables deploying
+	Timeout      string   `toml:"timeout"`       // Longest a contract build may run, defaults to "10m"
+}
+
+const defaultBuildTimeout = 10 * time.Minute
+
+// GetBuildTimeout returns how long a contract build may run, falling back to the default
+func GetBuildTimeout(config *Config) time.Duration {
+	return parseDuration(config.Build.Timeout, defaultBuildTimeout)
+}
+
+// ResolveProjectPath returns the real path of a cargo project or contract file, refusing paths
+// outside build.project_roots. Symlinks are followed first, so they can't lead out of a root.
+func ResolveProjectPath(config *Config, path string) (string, error) {
+	if len(config.Build.ProjectRoots) == 0 {
+		return "", errors.New("deploying contracts is disabled, build.project_roots is not configured")
+	}
+	resolved, err := realPath(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve project %s: %w", path, err)
+	}
+	for _, root := range config.Build.ProjectRoots {
+		rootPath, err := realPath(root)
+		if err != nil {
+			continue
+		}
+		relative, err := filepath.Rel(rootPath, resolved)
+		if err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			return resolved, nil
 		}
 	}
-	return "", false
+	return "", fmt.Errorf("%s is outside build.project_roots", path)
 }
 
-func GetPortByNodeName(config *Config, nodeName string) (string, bool) {
-	for _, node := range config.Nodes {
-		if node.Name == nodeName {
-			return node.Port, true
-		}
+// realPath returns the absolute path of path with symlinks resolved
+func realPath(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(resolved)
+}
+
+// Struct to hold the activity catalogue settings
+type CatalogueConfig struct {
+	Path       string   `toml:"path"`       // JSON file of catalogue activities, defaults to catalogue.json
+	Categories []string `toml:"categories"` // Categories an activity may belong to
+}
+
+const defaultCataloguePath = "catalogue.json"
+
+var defaultCategories = []string{"fitness", "nutrition", "mindfulness"}
+
+// GetCataloguePath returns the catalogue file, falling back to the default
+func GetCataloguePath(config *Config) string {
+	if config.Catalogue.Path == "" {
+		return defaultCataloguePath
+	}
+	return config.Catalogue.Path
+}
+
+// GetCategories returns the categories an activity may belong to, falling back to the defaults
+func GetCategories(config *Config) []string {
+	if len(config.Catalogue.Categories) == 0 {
+		return defaultCategories
+	}
+	return config.Catalogue.Categories
+}
+
+// Struct to hold the attendance check-in settings
+type AttendanceConfig struct {
+	Path            string            `toml:"path"`             // JSON file of check-ins and their reward transfers, defaults to attendance.json
+	CheckInOpens    string            `toml:"check_in_opens"`   // How long before a session starts members may check in, defaults to "15m"
+	AutoConfirm     bool              `toml:"auto_confirm"`     // Confirm attendance of everyone still checked in when their session ends
+	SweepInterval   string            `toml:"sweep_interval"`   // How often ended sessions and queued transfers are looked at, defaults to "1m"
+	TransferTimeout string            `toml:"transfer_timeout"` // How long a reward transfer may take on chain, defaults to "2m"
+	AdminDID        string            `toml:"admin_did"`        // Signs automatic transfers for branches without admin DIDs
+	Members         map[string]string `toml:"members"`          // DID of each member ID, as typed in or read from a member's QR code
+}
+
+const (
+	defaultAttendancePath  = "attendance.json"
+	defaultCheckInOpens    = 15 * time.Minute
+	defaultSweepInterval   = time.Minute
+	defaultTransferTimeout = 2 * time.Minute
+)
+
+// GetAttendancePath returns the check-in file, falling back to the default
+func GetAttendancePath(config *Config) string {
+	if config.Attendance.Path == "" {
+		return defaultAttendancePath
+	}
+	return config.Attendance.Path
+}
+
+// GetCheckInOpens returns how long before a session check-in opens, falling back to the default
+func GetCheckInOpens(config *Config) time.Duration {
+	return parseDuration(config.Attendance.CheckInOpens, defaultCheckInOpens)
+}
+
+// GetSweepInterval returns how often the attendance rules run, falling back to the default
+func GetSweepInterval(config *Config) time.Duration {
+	return parseDuration(config.Attendance.SweepInterval, defaultSweepInterval)
+}
+
+// GetTransferTimeout returns how long one reward transfer may run, falling back to the default
+func GetTransferTimeout(config *Config) time.Duration {
+	return parseDuration(config.Attendance.TransferTimeout, defaultTransferTimeout)
+}
+
+// GetMemberDID returns the DID registered for a member ID
+func GetMemberDID(config *Config, memberID string) (string, bool) {
+	did, exists := config.Attendance.Members[memberID]
+	return did, exists && did != ""
+}
+
+// GetMemberID returns the member ID a DID is registered under
+func GetMemberID(config *Config, did string) (string, bool) {
+	memberIDs := config.memberIDs
+	if memberIDs == nil {
+		memberIDs = indexMembers(config.Attendance.Members)
 	}
-	return "", false
+	memberID, exists := memberIDs[did]
+	return memberID, exists
 }
 
-func GetPortByDid(config *Config, did string) (string, bool) {
-	for _, node := range config.Nodes {
-		if node.DID == did {
-			return node.Port, true
+// indexMembers maps each registered DID back to its member ID
+func indexMembers(members map[string]string) map[string]string {
+	memberIDs := make(map[string]string, len(members))
+	for memberID, did := range members {
+		if did != "" {
+			memberIDs[did] = memberID
 		}
 	}
-	return "", false
+	return memberIDs
 }
 
-type EnvConfig struct {
-	AddActivityContract string
-	TransferContract    string
-	ActivityUpdatePath  string
+// GetRewardSigner returns the DID signing automatic reward transfers for a branch:
+// its first admin, or attendance.admin_did when it has none
+func GetRewardSigner(config *Config, branch Branch) (string, bool) {
+	if len(branch.AdminDIDs) > 0 {
+		return branch.AdminDIDs[0], true
+	}
+	return config.Attendance.AdminDID, config.Attendance.AdminDID != ""
+}
+
+// Struct to hold the configuration
+type Config struct {
+	HealthCheckInterval string              `toml:"health_check_interval"` // How often nodes are probed, e.g. "30s"
+	DefaultBranch       string              `toml:"default_branch"`        // Branch used when a request doesn't name one
+	Loyalty             LoyaltyConfig       `toml:"loyalty"`
+	Storage             StorageConfig       `toml:"storage"`
+	Build               BuildConfig         `toml:"build"`
+	Catalogue           CatalogueConfig     `toml:"catalogue"`
+	Attendance          AttendanceConfig    `toml:"attendance"`
+	Server              ServerConfig        `toml:"server"`
+	Auth                AuthConfig          `toml:"auth"`
+	Callbacks           CallbackConfig      `toml:"callbacks"`
+	CORS                CORSConfig          `toml:"cors"`
+	RateLimit           RateLimitConfig     `toml:"rate_limit"`
+	Audit               AuditConfig         `toml:"audit"`
+	Idempotency         IdempotencyConfig   `toml:"idempotency"`
+	Logging             LoggingConfig       `toml:"logging"`
+	Tracing             TracingConfig       `toml:"tracing"`
+	Nodes               map[string]Node     `toml:"nodes"`
+	Contracts           map[string]Contract `toml:"contracts"`
+	Branches            map[string]Branch   `toml:"branches"`
+
+	directory *nodeDirectory    // Index of Nodes, built by Load
+	memberIDs map[string]string // Member ID of each registered DID, built by Load
+}
+
+const defaultHealthCheckInterval = 30 * time.Second
+
+const (
+	defaultListenAddress   = ":9000"
+	defaultReadTimeout     = 30 * time.Second
+	defaultShutdownTimeout = 30 * time.Second
+)
+
+// GetHealthCheckInterval returns the node probe interval, falling back to the default
+func GetHealthCheckInterval(config *Config) time.Duration {
+	return parseDuration(config.HealthCheckInterval, defaultHealthCheckInterval)
+}
+
+// GetListenAddress returns the address the dapp server listens on, falling back to the default
+func GetListenAddress(config *Config) string {
+	if config.Server.ListenAddress == "" {
+		return defaultListenAddress
+	}
+	return config.Server.ListenAddress
+}
+
+// GetPublicURL returns the base URL nodes send callbacks to, without a trailing slash.
+// Unset, it points at localhost on the listen port, which only local nodes can reach.
+func GetPublicURL(config *Config) string {
+	if config.Server.PublicURL != "" {
+		return strings.TrimRight(config.Server.PublicURL, "/")
+	}
+	scheme := "http"
+	if config.Server.TLSCert != "" {
+		scheme = "https"
+	}
+	_, port, err := net.SplitHostPort(GetListenAddress(config))
+	if err != nil {
+		port = strings.TrimPrefix(defaultListenAddress, ":")
+	}
+	return scheme + "://localhost:" + port
 }
 
+// GetReadTimeout returns the request read timeout, falling back to the default
+func GetReadTimeout(config *Config) time.Duration {
+	return parseDuration(config.Server.ReadTimeout, defaultReadTimeout)
+}
+
+// GetWriteTimeout returns the response write timeout. Zero means no limit, which
+// synchronous deployments and the deployment event stream rely on by default.
+func GetWriteTimeout(config *Config) time.Duration {
+	return parseDuration(config.Server.WriteTimeout, 0)
+}
+
+// GetShutdownTimeout returns how long shutdown waits for in-flight work, falling back to the default
+func GetShutdownTimeout(config *Config) time.Duration {
+	return parseDuration(config.Server.ShutdownTimeout, defaultShutdownTimeout)
+}
+
+// IsTLSEnabled reports whether the dapp server should serve HTTPS
+func IsTLSEnabled(config *Config) bool {
+	return config.Server.TLSCert != "" && config.Server.TLSKey != ""
+}
+
+func parseDuration(value string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+	return duration
+}
+
+// The current configuration is swapped atomically on reload, callers holding
+// the previous one keep a consistent snapshot
 var (
-	envInstance *EnvConfig
-	envOnce     sync.Once
+	instance    atomic.Pointer[Config]
+	loadOptions LoadOptions
 )
 
-// LoadConfig initializes the configuration
-func LoadEnvConfig() *EnvConfig {
-	envOnce.Do(func() {
-		// Load the .env file
-		err := godotenv.Load(".config/.env")
-		if err != nil {
-			log.Fatalf("Error loading .env file: %v", err)
+// LoadConfig builds the configuration from its layers and makes it current
+func LoadConfig(opts LoadOptions) error {
+	config, err := Load(opts)
+	if err != nil {
+		return err
+	}
+	loadOptions = opts
+	instance.Store(config)
+	return nil
+}
+
+// GetConfig returns the global configuration instance
+func GetConfig() (*Config, error) {
+	config := instance.Load()
+	if config == nil {
+		// log.Fatal("Config not loaded. Call LoadConfig() first.")
+		return nil, fmt.Errorf("Config not loaded. Call LoadConfig() first")
+	}
+	return config, nil
+}
+
+// GetConfigFiles returns the files the configuration is read from, whether or not the optional ones exist
+func GetConfigFiles() []string {
+	return loadOptions.files()
+}
+
+// GetProfile returns the profile layered over the config file, empty when none was selected
+func GetProfile() string {
+	return loadOptions.profile()
+}
+
+// GetContractByHash returns the registry entry for a deployed contract hash
+func GetContractByHash(config *Config, hash string) (Contract, bool) {
+	for _, contract := range config.Contracts {
+		if contract.Hash == hash {
+			return contract, true
 		}
+	}
+	return Contract{}, false
+}
 
-		// Populate the config instance
-		envInstance = &EnvConfig{
-			AddActivityContract: os.Getenv("ADD_ACTIVITY_CONTRACT"),
-			TransferContract:    os.Getenv("TRANSFER_CONTRACT"),
-			ActivityUpdatePath:  os.Getenv("ACTIVITY_UPDATE_PATH"),
+// GetHostFunctionGrant returns the grant for a host function if the contract allows it
+func GetHostFunctionGrant(contract Contract, name string) (HostFunctionGrant, bool) {
+	for _, grant := range contract.HostFunctions {
+		if grant.Name == name {
+			return grant, true
 		}
-	})
-	return envInstance
+	}
+	return HostFunctionGrant{}, false
+}
+
+// EnvConfig holds the settings that used to be read from .env only
+type EnvConfig struct {
+	AddActivityContract string
+	TransferContract    string
+	ActivityUpdatePath  string
 }
 
+// GetEnvConfig returns the contract hashes and activity store path of the current configuration
 func GetEnvConfig() *EnvConfig {
-	if envInstance == nil {
-		return LoadEnvConfig()
+	config := instance.Load()
+	if config == nil {
+		return &EnvConfig{}
+	}
+	return &EnvConfig{
+		AddActivityContract: config.Loyalty.AddActivityContract,
+		TransferContract:    config.Loyalty.TransferContract,
+		ActivityUpdatePath:  config.Storage.ActivityUpdatePath,
 	}
-	return envInstance
 }
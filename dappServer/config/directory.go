@@ -0,0 +1,135 @@
+package config
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// nodeDirectory indexes the configured nodes by name, address, DID and URL.
+// It is built once per configuration, so lookups don't scan every node.
+type nodeDirectory struct {
+	byName    map[string]Node
+	byAddress map[string]Node   // By host:port of the node's URL
+	byPort    map[string][]Node // Nodes on different hosts may share a port
+	byDID     map[string]Node
+	byURL     map[string]Node
+}
+
+// GetNodeAddress returns the host:port the node's API is served on
+func GetNodeAddress(node Node) string {
+	parsed, err := url.Parse(GetNodeURL(node))
+	if err != nil {
+		return ""
+	}
+	if parsed.Port() == "" {
+		switch parsed.Scheme {
+		case "https":
+			return parsed.Hostname() + ":443"
+		case "http":
+			return parsed.Hostname() + ":80"
+		}
+	}
+	return parsed.Host
+}
+
+// GetNodeDIDs returns every DID the node signs for, its primary DID first
+func GetNodeDIDs(node Node) []string {
+	dids := make([]string, 0, len(node.DIDs)+1)
+	if node.DID != "" {
+		dids = append(dids, node.DID)
+	}
+	for _, did := range node.DIDs {
+		if did != node.DID {
+			dids = append(dids, did)
+		}
+	}
+	return dids
+}
+
+// indexNodes builds the directory, reporting every name, address, DID or URL claimed by more
+// than one node. Contested values are left out of the index rather than resolved arbitrarily.
+// Ports alone may repeat, nodes on different hosts often listen on the same one.
+func indexNodes(nodes map[string]Node) (*nodeDirectory, ValidationErrors) {
+	directory := &nodeDirectory{
+		byName:    make(map[string]Node, len(nodes)),
+		byAddress: make(map[string]Node, len(nodes)),
+		byPort:    make(map[string][]Node, len(nodes)),
+		byDID:     make(map[string]Node, len(nodes)),
+		byURL:     make(map[string]Node, len(nodes)),
+	}
+	var errs ValidationErrors
+	owners := map[string]map[string]string{"name": {}, "address": {}, "did": {}, "url": {}}
+	claim := func(field string, value string, key string, index map[string]Node, node Node) {
+		if value == "" {
+			return
+		}
+		if other, duplicate := owners[field][value]; duplicate {
+			errs.add("nodes."+key+"."+field, "%s is also used by nodes.%s", value, other)
+			delete(index, value)
+			return
+		}
+		owners[field][value] = key
+		index[value] = node
+	}
+
+	// Sorted so the same node is always the one reported as the duplicate
+	keys := make([]string, 0, len(nodes))
+	for key := range nodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		node := nodes[key]
+		claim("name", node.Name, key, directory.byName, node)
+		claim("address", GetNodeAddress(node), key, directory.byAddress, node)
+		if node.Port != "" {
+			directory.byPort[node.Port] = append(directory.byPort[node.Port], node)
+		}
+		for _, did := range GetNodeDIDs(node) {
+			claim("did", did, key, directory.byDID, node)
+		}
+		claim("url", GetNodeURL(node), key, directory.byURL, node)
+	}
+	return directory, errs
+}
+
+// directoryOf returns the index built when the configuration was loaded.
+// Configurations built by hand rather than loaded are indexed on demand.
+func directoryOf(config *Config) *nodeDirectory {
+	if config.directory != nil {
+		return config.directory
+	}
+	directory, _ := indexNodes(config.Nodes)
+	return directory
+}
+
+// GetNodeByName returns the node with the given name
+func GetNodeByName(config *Config, name string) (Node, bool) {
+	node, exists := directoryOf(config).byName[name]
+	return node, exists
+}
+
+// GetNodeByAddress returns the node whose API is served on host:port
+func GetNodeByAddress(config *Config, address string) (Node, bool) {
+	node, exists := directoryOf(config).byAddress[address]
+	return node, exists
+}
+
+// GetNodesByPort returns every node listening on port, sorted by their key in the config.
+// Callbacks only name a port, so callers tell these nodes apart by where the request came from.
+func GetNodesByPort(config *Config, port string) []Node {
+	return directoryOf(config).byPort[port]
+}
+
+// GetNodeByDid returns the node signing for did, which may be any of the node's DIDs
+func GetNodeByDid(config *Config, did string) (Node, bool) {
+	node, exists := directoryOf(config).byDID[did]
+	return node, exists
+}
+
+// GetNodeByURL returns the node whose API is served on baseURL
+func GetNodeByURL(config *Config, baseURL string) (Node, bool) {
+	node, exists := directoryOf(config).byURL[strings.TrimSuffix(baseURL, "/")]
+	return node, exists
+}
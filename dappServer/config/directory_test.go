@@ -0,0 +1,127 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestIndexNodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		nodes      map[string]Node
+		wantFields []string
+	}{
+		{
+			name: "distinct local nodes",
+			nodes: map[string]Node{
+				"a": {Name: "a", Port: "20000", DID: "did:a"},
+				"b": {Name: "b", Port: "20001", DID: "did:b"},
+			},
+		},
+		{
+			name: "shared port on different hosts",
+			nodes: map[string]Node{
+				"a": {Name: "a", Port: "20000", DID: "did:a", URL: "https://a.example.org:20000"},
+				"b": {Name: "b", Port: "20000", DID: "did:b", URL: "https://b.example.org:20000"},
+			},
+		},
+		{
+			name: "same name",
+			nodes: map[string]Node{
+				"a": {Name: "node", Port: "20000", DID: "did:a"},
+				"b": {Name: "node", Port: "20001", DID: "did:b"},
+			},
+			wantFields: []string{"nodes.b.name"},
+		},
+		{
+			name: "same local port",
+			nodes: map[string]Node{
+				"a": {Name: "a", Port: "20000", DID: "did:a"},
+				"b": {Name: "b", Port: "20000", DID: "did:b"},
+			},
+			wantFields: []string{"nodes.b.address", "nodes.b.url"},
+		},
+		{
+			name: "same address under another url",
+			nodes: map[string]Node{
+				"a": {Name: "a", Port: "443", DID: "did:a", URL: "https://a.example.org"},
+				"b": {Name: "b", Port: "443", DID: "did:b", URL: "https://a.example.org:443/"},
+			},
+			wantFields: []string{"nodes.b.address"},
+		},
+		{
+			name: "primary did",
+			nodes: map[string]Node{
+				"a": {Name: "a", Port: "20000", DID: "did:shared"},
+				"b": {Name: "b", Port: "20001", DID: "did:shared"},
+			},
+			wantFields: []string{"nodes.b.did"},
+		},
+		{
+			name: "further did",
+			nodes: map[string]Node{
+				"a": {Name: "a", Port: "20000", DID: "did:a", DIDs: []string{"did:a", "did:shared"}},
+				"b": {Name: "b", Port: "20001", DID: "did:b", DIDs: []string{"did:shared"}},
+			},
+			wantFields: []string{"nodes.b.did"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := indexNodes(tt.nodes)
+			var fields []string
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Fatalf("indexNodes() reported %v, want %v", errs, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestNodeLookups(t *testing.T) {
+	config := &Config{Nodes: map[string]Node{
+		"local":  {Name: "local", Port: "20000", DID: "did:local", DIDs: []string{"did:local-2"}},
+		"north":  {Name: "north", Port: "20000", DID: "did:north", URL: "https://north.example.org:20000/"},
+		"south":  {Name: "south", Port: "20001", DID: "did:south", URL: "https://south.example.org"},
+		"shared": {Name: "shared", Port: "20002", DID: "did:shared"},
+		"twin":   {Name: "twin", Port: "20003", DID: "did:shared"},
+	}}
+
+	tests := []struct {
+		name     string
+		lookup   func() (Node, bool)
+		wantName string
+	}{
+		{name: "by name", lookup: func() (Node, bool) { return GetNodeByName(config, "north") }, wantName: "north"},
+		{name: "by unknown name", lookup: func() (Node, bool) { return GetNodeByName(config, "east") }},
+		{name: "by address", lookup: func() (Node, bool) { return GetNodeByAddress(config, "north.example.org:20000") }, wantName: "north"},
+		{name: "by default https address", lookup: func() (Node, bool) { return GetNodeByAddress(config, "south.example.org:443") }, wantName: "south"},
+		{name: "by local address", lookup: func() (Node, bool) { return GetNodeByAddress(config, "localhost:20000") }, wantName: "local"},
+		{name: "by primary did", lookup: func() (Node, bool) { return GetNodeByDid(config, "did:local") }, wantName: "local"},
+		{name: "by further did", lookup: func() (Node, bool) { return GetNodeByDid(config, "did:local-2") }, wantName: "local"},
+		{name: "by contested did", lookup: func() (Node, bool) { return GetNodeByDid(config, "did:shared") }},
+		{name: "by url with slash", lookup: func() (Node, bool) { return GetNodeByURL(config, "https://north.example.org:20000/") }, wantName: "north"},
+		{name: "by default url", lookup: func() (Node, bool) { return GetNodeByURL(config, "http://localhost:20000") }, wantName: "local"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, exists := tt.lookup()
+			if exists != (tt.wantName != "") || node.Name != tt.wantName {
+				t.Fatalf("lookup = %q, %v, want %q", node.Name, exists, tt.wantName)
+			}
+		})
+	}
+
+	var names []string
+	for _, node := range GetNodesByPort(config, "20000") {
+		names = append(names, node.Name)
+	}
+	if !slices.Equal(names, []string{"local", "north"}) {
+		t.Fatalf("GetNodesByPort(20000) = %v, want [local north]", names)
+	}
+	if nodes := GetNodesByPort(config, "30000"); len(nodes) != 0 {
+		t.Fatalf("GetNodesByPort(30000) = %v, want none", nodes)
+	}
+}
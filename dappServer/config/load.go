@@ -0,0 +1,323 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+)
+
+// DefaultConfigPath is the config file read when no other is given
+const DefaultConfigPath = ".config/config.toml"
+
+// ProfileEnv selects the profile when none is given on the command line
+const ProfileEnv = "DAPP_PROFILE"
+
+// EnvPrefix starts the environment variables overriding config keys,
+// e.g. DAPP_SERVER_LISTEN_ADDRESS for server.listen_address
+const EnvPrefix = "DAPP_"
+
+// Variables older deployments keep in .env, and the keys they now set
+var legacyEnvKeys = map[string]string{
+	"ADD_ACTIVITY_CONTRACT": "loyalty.add_activity_contract",
+	"TRANSFER_CONTRACT":     "loyalty.transfer_contract",
+	"ACTIVITY_UPDATE_PATH":  "storage.activity_update_path",
+}
+
+// LoadOptions selects the files and overrides making up the configuration. Layers apply
+// in order, each overriding the one before: defaults, the config file, the profile file,
+// the .env file beside the config file, environment variables and finally Overrides.
+type LoadOptions struct {
+	Path      string            // Config file, defaults to DefaultConfigPath
+	Profile   string            // Reads config.<profile>.toml beside Path, defaults to $DAPP_PROFILE
+	Overrides map[string]string // Dotted keys such as server.listen_address, set from the command line
+}
+
+func (opts LoadOptions) path() string {
+	if opts.Path == "" {
+		return DefaultConfigPath
+	}
+	return opts.Path
+}
+
+func (opts LoadOptions) profile() string {
+	if opts.Profile == "" {
+		return os.Getenv(ProfileEnv)
+	}
+	return opts.Profile
+}
+
+// profilePath returns config.<profile>.toml for config.toml, or "" without a profile
+func (opts LoadOptions) profilePath() string {
+	profile := opts.profile()
+	if profile == "" {
+		return ""
+	}
+	path := opts.path()
+	extension := filepath.Ext(path)
+	return strings.TrimSuffix(path, extension) + "." + profile + extension
+}
+
+func (opts LoadOptions) envPath() string {
+	return filepath.Join(filepath.Dir(opts.path()), ".env")
+}
+
+func (opts LoadOptions) files() []string {
+	files := []string{opts.path()}
+	if profilePath := opts.profilePath(); profilePath != "" {
+		files = append(files, profilePath)
+	}
+	return append(files, opts.envPath())
+}
+
+// Defaults returns the configuration every layer starts from
+func Defaults() *Config {
+	return &Config{
+		HealthCheckInterval: defaultHealthCheckInterval.String(),
+		Server: ServerConfig{
+			ListenAddress:   defaultListenAddress,
+			ReadTimeout:     defaultReadTimeout.String(),
+			ShutdownTimeout: defaultShutdownTimeout.String(),
+		},
+		RateLimit: RateLimitConfig{
+			Read:      defaultReadRateLimit,
+			Expensive: defaultExpensiveRateLimit,
+		},
+		Audit:     AuditConfig{Path: defaultAuditLogPath},
+		Catalogue: CatalogueConfig{Path: defaultCataloguePath, Categories: slices.Clone(defaultCategories)},
+		Attendance: AttendanceConfig{
+			Path:            defaultAttendancePath,
+			CheckInOpens:    defaultCheckInOpens.String(),
+			SweepInterval:   defaultSweepInterval.String(),
+			TransferTimeout: defaultTransferTimeout.String(),
+		},
+		Idempotency: IdempotencyConfig{TTL: defaultIdempotencyTTL.String()},
+		Build:       BuildConfig{Timeout: defaultBuildTimeout.String()},
+		Logging:     LoggingConfig{Level: "info", Format: "text"},
+	}
+}
+
+// Load builds the configuration from its layers without making it current
+func Load(opts LoadOptions) (*Config, error) {
+	merged, err := readTOML(opts.path())
+	if err != nil {
+		return nil, err
+	}
+	// The profile only lists what differs, so it is merged key by key rather than replacing whole tables
+	if profilePath := opts.profilePath(); profilePath != "" {
+		profile, err := readTOML(profilePath)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", opts.profile(), err)
+		}
+		mergeTables(merged, profile)
+	}
+
+	var encoded bytes.Buffer
+	if err := toml.NewEncoder(&encoded).Encode(merged); err != nil {
+		return nil, err
+	}
+	config := Defaults()
+	if _, err := toml.Decode(encoded.String(), config); err != nil {
+		return nil, err
+	}
+
+	if err := applyEnv(config, opts.envPath()); err != nil {
+		return nil, err
+	}
+	for key, value := range opts.Overrides {
+		if err := SetKey(config, key, value); err != nil {
+			return nil, fmt.Errorf("--set %s: %w", key, err)
+		}
+	}
+	// Lookups by port, DID or URL would be ambiguous, so collisions fail the load
+	directory, errs := indexNodes(config.Nodes)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	config.directory = directory
+	config.memberIDs = indexMembers(config.Attendance.Members)
+	return config, nil
+}
+
+func readTOML(path string) (map[string]interface{}, error) {
+	table := make(map[string]interface{})
+	if _, err := toml.DecodeFile(path, &table); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return table, nil
+}
+
+// mergeTables copies override into base, descending into tables present in both
+func mergeTables(base map[string]interface{}, override map[string]interface{}) {
+	for key, value := range override {
+		overrideTable, isTable := value.(map[string]interface{})
+		baseTable, baseIsTable := base[key].(map[string]interface{})
+		if isTable && baseIsTable {
+			mergeTables(baseTable, overrideTable)
+			continue
+		}
+		base[key] = value
+	}
+}
+
+// applyEnv applies the .env file, then the process environment, which wins over it.
+// Each config key can be set by its DAPP_ variable; the legacy .env names still work.
+func applyEnv(config *Config, envPath string) error {
+	fileValues, err := godotenv.Read(envPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", envPath, err)
+	}
+	lookup := func(variable string) (string, bool) {
+		if value, exists := os.LookupEnv(variable); exists {
+			return value, true
+		}
+		value, exists := fileValues[variable]
+		return value, exists
+	}
+
+	for variable, key := range legacyEnvKeys {
+		if value, exists := lookup(variable); exists {
+			if err := SetKey(config, key, value); err != nil {
+				return fmt.Errorf("%s: %w", variable, err)
+			}
+		}
+	}
+	for _, key := range Keys(config) {
+		variable := EnvVariable(key)
+		if value, exists := lookup(variable); exists {
+			if err := SetKey(config, key, value); err != nil {
+				return fmt.Errorf("%s: %w", variable, err)
+			}
+		}
+	}
+	return nil
+}
+
+// EnvVariable returns the environment variable overriding a dotted config key
+func EnvVariable(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// Keys lists the dotted keys of every setting that can be overridden, including
+// those of the nodes and contracts already configured
+func Keys(config *Config) []string {
+	var keys []string
+	collectKeys(reflect.ValueOf(config).Elem(), "", &keys)
+	return keys
+}
+
+func collectKeys(value reflect.Value, prefix string, keys *[]string) {
+	switch {
+	case value.Kind() == reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if field := value.Type().Field(i); isSetting(field) {
+				collectKeys(value.Field(i), prefix+tomlName(field)+".", keys)
+			}
+		}
+	case value.Kind() == reflect.Map:
+		for _, mapKey := range value.MapKeys() {
+			collectKeys(value.MapIndex(mapKey), prefix+mapKey.String()+".", keys)
+		}
+	case value.Kind() == reflect.Slice && value.Type().Elem().Kind() != reflect.String:
+		// Lists of tables, such as api_keys, can only be set in files
+	default:
+		*keys = append(*keys, strings.TrimSuffix(prefix, "."))
+	}
+}
+
+// SetKey sets the setting at a dotted key such as nodes.node1.url from its string form.
+// Lists are comma separated.
+func SetKey(config *Config, key string, value string) error {
+	return setValue(reflect.ValueOf(config).Elem(), strings.Split(key, "."), value)
+}
+
+func setValue(target reflect.Value, path []string, value string) error {
+	if len(path) == 0 {
+		return parseValue(target, value)
+	}
+	switch target.Kind() {
+	case reflect.Struct:
+		for i := 0; i < target.NumField(); i++ {
+			if field := target.Type().Field(i); isSetting(field) && tomlName(field) == path[0] {
+				return setValue(target.Field(i), path[1:], value)
+			}
+		}
+		return fmt.Errorf("unknown key %q", path[0])
+	case reflect.Map:
+		// Map values aren't addressable, so the entry is copied, updated and stored back
+		if target.IsNil() {
+			target.Set(reflect.MakeMap(target.Type()))
+		}
+		mapKey := reflect.ValueOf(path[0])
+		entry := reflect.New(target.Type().Elem()).Elem()
+		if existing := target.MapIndex(mapKey); existing.IsValid() {
+			entry.Set(existing)
+		}
+		if err := setValue(entry, path[1:], value); err != nil {
+			return err
+		}
+		target.SetMapIndex(mapKey, entry)
+		return nil
+	}
+	return fmt.Errorf("%q is not a table", path[0])
+}
+
+func parseValue(target reflect.Value, value string) error {
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		target.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		target.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		target.SetFloat(parsed)
+	case reflect.Slice:
+		if target.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("lists of tables can only be set in a config file")
+		}
+		list := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		target.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("is a table, set one of its keys instead")
+	}
+	return nil
+}
+
+// isSetting reports whether a struct field is read from the config files
+func isSetting(field reflect.StructField) bool {
+	return field.IsExported() && field.Tag.Get("toml") != "-"
+}
+
+func tomlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const baseTOML = `
+health_check_interval = "10s"
+
+[server]
+listen_address = ":8000"
+read_timeout = "20s"
+
+[loyalty]
+add_activity_contract = "hash-add"
+transfer_contract = "hash-transfer"
+
+[nodes.node1]
+name = "node1"
+port = "20000"
+did = "did:node1"
+path = "/srv/node1"
+`
+
+// writeFiles writes name -> content into a fresh directory and returns config.toml's path
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "config.toml")
+}
+
+func TestLoadLayers(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     map[string]string
+		env       map[string]string
+		profile   string
+		overrides map[string]string
+		check     func(t *testing.T, c *Config)
+	}{
+		{
+			name:  "defaults under the file",
+			files: map[string]string{"config.toml": baseTOML},
+			check: func(t *testing.T, c *Config) {
+				checkSetting(t, "server.listen_address", c.Server.ListenAddress, ":8000")
+				checkSetting(t, "server.shutdown_timeout", c.Server.ShutdownTimeout, defaultShutdownTimeout.String())
+				checkSetting(t, "audit.path", c.Audit.Path, defaultAuditLogPath)
+			},
+		},
+		{
+			name: "profile merged key by key",
+			files: map[string]string{
+				"config.toml":      baseTOML,
+				"config.prod.toml": "[server]\nread_timeout = \"5s\"\n\n[nodes.node1]\nurl = \"https://node1.example.org:20000\"\n",
+			},
+			profile: "prod",
+			check: func(t *testing.T, c *Config) {
+				checkSetting(t, "server.read_timeout", c.Server.ReadTimeout, "5s")
+				checkSetting(t, "server.listen_address", c.Server.ListenAddress, ":8000")
+				checkSetting(t, "nodes.node1.url", c.Nodes["node1"].URL, "https://node1.example.org:20000")
+				checkSetting(t, "nodes.node1.did", c.Nodes["node1"].DID, "did:node1")
+			},
+		},
+		{
+			name: "profile from the environment",
+			files: map[string]string{
+				"config.toml":         baseTOML,
+				"config.staging.toml": "health_check_interval = \"1m\"\n",
+			},
+			env: map[string]string{ProfileEnv: "staging"},
+			check: func(t *testing.T, c *Config) {
+				checkSetting(t, "health_check_interval", c.HealthCheckInterval, "1m")
+			},
+		},
+		{
+			name: "env file and legacy names",
+			files: map[string]string{
+				"config.toml": baseTOML,
+				".env":        "DAPP_SERVER_READ_TIMEOUT=45s\nTRANSFER_CONTRACT=hash-legacy\n",
+			},
+			check: func(t *testing.T, c *Config) {
+				checkSetting(t, "server.read_timeout", c.Server.ReadTimeout, "45s")
+				checkSetting(t, "loyalty.transfer_contract", c.Loyalty.TransferContract, "hash-legacy")
+			},
+		},
+		{
+			name: "environment over env file",
+			files: map[string]string{
+				"config.toml": baseTOML,
+				".env":        "DAPP_SERVER_READ_TIMEOUT=45s\n",
+			},
+			env: map[string]string{"DAPP_SERVER_READ_TIMEOUT": "50s", "DAPP_NODES_NODE1_PORT": "20001"},
+			check: func(t *testing.T, c *Config) {
+				checkSetting(t, "server.read_timeout", c.Server.ReadTimeout, "50s")
+				checkSetting(t, "nodes.node1.port", c.Nodes["node1"].Port, "20001")
+			},
+		},
+		{
+			name: "overrides over everything",
+			files: map[string]string{
+				"config.toml":      baseTOML,
+				"config.prod.toml": "[server]\nlisten_address = \":7000\"\n",
+			},
+			profile:   "prod",
+			env:       map[string]string{"DAPP_SERVER_LISTEN_ADDRESS": ":7500"},
+			overrides: map[string]string{"server.listen_address": ":9500"},
+			check: func(t *testing.T, c *Config) {
+				checkSetting(t, "server.listen_address", c.Server.ListenAddress, ":9500")
+			},
+		},
+		{
+			name:  "lookups indexed",
+			files: map[string]string{"config.toml": baseTOML + "\n[attendance.members]\nm1 = \"did:alice\"\n"},
+			check: func(t *testing.T, c *Config) {
+				if node, exists := GetNodeByDid(c, "did:node1"); !exists || node.Name != "node1" {
+					t.Fatalf("GetNodeByDid() = %+v, %v", node, exists)
+				}
+				if memberID, exists := GetMemberID(c, "did:alice"); !exists || memberID != "m1" {
+					t.Fatalf("GetMemberID() = %q, %v", memberID, exists)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ProfileEnv, "")
+			for variable, value := range tt.env {
+				t.Setenv(variable, value)
+			}
+			config, err := Load(LoadOptions{Path: writeFiles(t, tt.files), Profile: tt.profile, Overrides: tt.overrides})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, config)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     map[string]string
+		env       map[string]string
+		profile   string
+		overrides map[string]string
+		wantErr   string
+	}{
+		{name: "missing file", files: map[string]string{}, wantErr: "failed to read"},
+		{name: "missing profile", files: map[string]string{"config.toml": baseTOML}, profile: "prod", wantErr: "profile prod"},
+		{name: "malformed file", files: map[string]string{"config.toml": "[server\n"}, wantErr: "failed to read"},
+		{
+			name:    "bad env value",
+			files:   map[string]string{"config.toml": baseTOML},
+			env:     map[string]string{"DAPP_RATE_LIMIT_ENABLED": "sometimes"},
+			wantErr: "DAPP_RATE_LIMIT_ENABLED",
+		},
+		{
+			name:      "unknown override",
+			files:     map[string]string{"config.toml": baseTOML},
+			overrides: map[string]string{"server.listen_port": "9000"},
+			wantErr:   "--set server.listen_port",
+		},
+		{
+			name:    "node collision",
+			files:   map[string]string{"config.toml": baseTOML + "\n[nodes.node2]\nname = \"node2\"\nport = \"20000\"\ndid = \"did:node1\"\npath = \"/srv/node2\"\n"},
+			wantErr: "did:node1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ProfileEnv, "")
+			for variable, value := range tt.env {
+				t.Setenv(variable, value)
+			}
+			_, err := Load(LoadOptions{Path: writeFiles(t, tt.files), Profile: tt.profile, Overrides: tt.overrides})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Load() error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		check   func(c *Config) bool
+		wantErr bool
+	}{
+		{name: "string", key: "server.public_url", value: "https://dapp.example.org", check: func(c *Config) bool {
+			return c.Server.PublicURL == "https://dapp.example.org"
+		}},
+		{name: "bool", key: "attendance.auto_confirm", value: "true", check: func(c *Config) bool {
+			return c.Attendance.AutoConfirm
+		}},
+		{name: "int", key: "rate_limit.read.burst", value: "7", check: func(c *Config) bool {
+			return c.RateLimit.Read.Burst == 7
+		}},
+		{name: "float", key: "tracing.sample_ratio", value: "0.25", check: func(c *Config) bool {
+			return c.Tracing.SampleRatio == 0.25
+		}},
+		{name: "list", key: "cors.allow_origins", value: "https://a.example.org, ,https://b.example.org", check: func(c *Config) bool {
+			return slices.Equal(c.CORS.AllowOrigins, []string{"https://a.example.org", "https://b.example.org"})
+		}},
+		{name: "existing map entry", key: "nodes.node1.url", value: "https://node1.example.org", check: func(c *Config) bool {
+			return c.Nodes["node1"].URL == "https://node1.example.org" && c.Nodes["node1"].DID == "did:node1"
+		}},
+		{name: "new map entry", key: "nodes.node2.port", value: "20002", check: func(c *Config) bool {
+			return c.Nodes["node2"].Port == "20002"
+		}},
+		{name: "nil map", key: "attendance.members.m1", value: "did:alice", check: func(c *Config) bool {
+			return c.Attendance.Members["m1"] == "did:alice"
+		}},
+		{name: "unknown key", key: "server.listen_port", value: "9000", wantErr: true},
+		{name: "bad bool", key: "auth.enabled", value: "yes please", wantErr: true},
+		{name: "bad int", key: "rate_limit.read.burst", value: "many", wantErr: true},
+		{name: "bad float", key: "tracing.sample_ratio", value: "half", wantErr: true},
+		{name: "whole table", key: "server", value: "x", wantErr: true},
+		{name: "list of tables", key: "auth.api_keys", value: "x", wantErr: true},
+		{name: "past a value", key: "server.listen_address.port", value: "9000", wantErr: true},
+		{name: "untagged field", key: "branches.north.ID", value: "south", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Defaults()
+			config.Nodes = map[string]Node{"node1": {Name: "node1", Port: "20000", DID: "did:node1"}}
+			err := SetKey(config, tt.key, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("SetKey(%s) succeeded, want an error", tt.key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetKey(%s) error = %v", tt.key, err)
+			}
+			if !tt.check(config) {
+				t.Fatalf("SetKey(%s, %s) did not set it", tt.key, tt.value)
+			}
+		})
+	}
+}
+
+func TestEnvVariable(t *testing.T) {
+	for key, variable := range map[string]string{
+		"server.listen_address": "DAPP_SERVER_LISTEN_ADDRESS",
+		"nodes.node-1.url":      "DAPP_NODES_NODE_1_URL",
+		"health_check_interval": "DAPP_HEALTH_CHECK_INTERVAL",
+	} {
+		if got := EnvVariable(key); got != variable {
+			t.Errorf("EnvVariable(%s) = %s, want %s", key, got, variable)
+		}
+	}
+}
+
+func checkSetting(t *testing.T, key string, got string, expected string) {
+	t.Helper()
+	if got != expected {
+		t.Fatalf("%s = %q, want %q", key, got, expected)
+	}
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Sections read once at startup; changing them needs a restart
+var restartSections = map[string]bool{
+	"server":      true,
+	"logging":     true,
+	"tracing":     true,
+	"auth":        true,
+	"cors":        true,
+	"rate_limit":  true,
+	"audit":       true,
+	"idempotency": true,
+	"catalogue":   true,
+	"attendance":  true,
+}
+
+// ReloadResult describes a configuration reload that was applied
+type ReloadResult struct {
+	Changes         []string `json:"changes"`
+	RestartRequired []string `json:"restart_required,omitempty"` // Changed sections that only apply after a restart
+}
+
+var reloadMu sync.Mutex
+
+// Reload rebuilds the configuration from the same layers it was loaded from, validates it
+// and, only if it is valid, swaps it in for every later GetConfig call
+func Reload() (*ReloadResult, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	config, err := Load(loadOptions)
+	if err != nil {
+		return nil, err
+	}
+	if errs := Validate(config); len(errs) > 0 {
+		return nil, errs
+	}
+
+	oldConfig, err := GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	result := Diff(oldConfig, config)
+	instance.Store(config)
+	return result, nil
+}
+
+// Diff lists what changed between two configurations
+func Diff(oldConfig *Config, newConfig *Config) *ReloadResult {
+	result := &ReloadResult{Changes: []string{}}
+	result.Changes = append(result.Changes, diffMap("node", oldConfig.Nodes, newConfig.Nodes)...)
+	result.Changes = append(result.Changes, diffMap("contract", oldConfig.Contracts, newConfig.Contracts)...)
+	result.Changes = append(result.Changes, diffMap("branch", oldConfig.Branches, newConfig.Branches)...)
+	if oldConfig.DefaultBranch != newConfig.DefaultBranch {
+		result.Changes = append(result.Changes, fmt.Sprintf("default_branch changed from %q to %q", oldConfig.DefaultBranch, newConfig.DefaultBranch))
+	}
+	if oldConfig.HealthCheckInterval != newConfig.HealthCheckInterval {
+		result.Changes = append(result.Changes, fmt.Sprintf("health_check_interval changed from %q to %q", oldConfig.HealthCheckInterval, newConfig.HealthCheckInterval))
+	}
+	if !reflect.DeepEqual(oldConfig.Callbacks, newConfig.Callbacks) {
+		result.Changes = append(result.Changes, "callbacks changed")
+	}
+	for section, changed := range map[string]bool{
+		"server":      !reflect.DeepEqual(oldConfig.Server, newConfig.Server),
+		"logging":     !reflect.DeepEqual(oldConfig.Logging, newConfig.Logging),
+		"tracing":     !reflect.DeepEqual(oldConfig.Tracing, newConfig.Tracing),
+		"auth":        !reflect.DeepEqual(oldConfig.Auth, newConfig.Auth),
+		"cors":        !reflect.DeepEqual(oldConfig.CORS, newConfig.CORS),
+		"rate_limit":  !reflect.DeepEqual(oldConfig.RateLimit, newConfig.RateLimit),
+		"audit":       !reflect.DeepEqual(oldConfig.Audit, newConfig.Audit),
+		"idempotency": !reflect.DeepEqual(oldConfig.Idempotency, newConfig.Idempotency),
+		"catalogue":   oldConfig.Catalogue.Path != newConfig.Catalogue.Path,
+		"attendance":  oldConfig.Attendance.Path != newConfig.Attendance.Path || oldConfig.Attendance.SweepInterval != newConfig.Attendance.SweepInterval,
+	} {
+		if changed && restartSections[section] {
+			result.Changes = append(result.Changes, section+" changed")
+			result.RestartRequired = append(result.RestartRequired, section)
+		}
+	}
+	if !reflect.DeepEqual(oldConfig.Loyalty, newConfig.Loyalty) {
+		result.Changes = append(result.Changes, "loyalty changed")
+	}
+	if !reflect.DeepEqual(oldConfig.Storage, newConfig.Storage) {
+		result.Changes = append(result.Changes, "storage changed")
+	}
+	if !reflect.DeepEqual(oldConfig.Build, newConfig.Build) {
+		result.Changes = append(result.Changes, "build changed")
+	}
+	// Categories only affect validation of later requests, so they apply straight away
+	if !reflect.DeepEqual(oldConfig.Catalogue.Categories, newConfig.Catalogue.Categories) {
+		result.Changes = append(result.Changes, "catalogue.categories changed")
+	}
+	// The attendance rules read the rest of their settings on every sweep and request
+	oldAttendance, newAttendance := oldConfig.Attendance, newConfig.Attendance
+	oldAttendance.Path, oldAttendance.SweepInterval = newAttendance.Path, newAttendance.SweepInterval
+	if !reflect.DeepEqual(oldAttendance, newAttendance) {
+		result.Changes = append(result.Changes, "attendance settings changed")
+	}
+	sort.Strings(result.Changes)
+	sort.Strings(result.RestartRequired)
+	return result
+}
+
+func diffMap[T any](kind string, oldEntries map[string]T, newEntries map[string]T) []string {
+	var changes []string
+	for key, oldEntry := range oldEntries {
+		newEntry, exists := newEntries[key]
+		if !exists {
+			changes = append(changes, fmt.Sprintf("%s %s removed", kind, key))
+		} else if !reflect.DeepEqual(oldEntry, newEntry) {
+			changes = append(changes, fmt.Sprintf("%s %s changed", kind, key))
+		}
+	}
+	for key := range newEntries {
+		if _, exists := oldEntries[key]; !exists {
+			changes = append(changes, fmt.Sprintf("%s %s added", kind, key))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,395 @@
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidationError is one problem found in the configuration
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors collects every problem found, so they can be fixed in one pass
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, 0, len(errs)+1)
+	lines = append(lines, fmt.Sprintf("%d configuration problem(s):", len(errs)))
+	for _, err := range errs {
+		lines = append(lines, "  - "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (errs *ValidationErrors) add(field string, format string, args ...interface{}) {
+	*errs = append(*errs, ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks the configuration for missing, duplicate and malformed settings
+func Validate(config *Config) ValidationErrors {
+	var errs ValidationErrors
+	validateNodes(config, &errs)
+	validateContracts(config, &errs)
+	validateLoyalty(config, &errs)
+	validateCatalogue(config, &errs)
+	validateAttendance(config, &errs)
+
+	for field, value := range map[string]string{
+		"health_check_interval":       config.HealthCheckInterval,
+		"server.read_timeout":         config.Server.ReadTimeout,
+		"server.write_timeout":        config.Server.WriteTimeout,
+		"server.shutdown_timeout":     config.Server.ShutdownTimeout,
+		"cors.max_age":                config.CORS.MaxAge,
+		"idempotency.ttl":             config.Idempotency.TTL,
+		"build.timeout":               config.Build.Timeout,
+		"attendance.check_in_opens":   config.Attendance.CheckInOpens,
+		"attendance.sweep_interval":   config.Attendance.SweepInterval,
+		"attendance.transfer_timeout": config.Attendance.TransferTimeout,
+	} {
+		validateDuration(field, value, &errs)
+	}
+	if (config.Server.TLSCert == "") != (config.Server.TLSKey == "") {
+		errs.add("server", "tls_cert and tls_key must be set together")
+	}
+	if config.Server.PublicURL != "" {
+		parsed, err := url.Parse(config.Server.PublicURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs.add("server.public_url", "%q is not an http or https URL", config.Server.PublicURL)
+		}
+	} else {
+		for _, node := range config.Nodes {
+			if !IsLocalNode(node) {
+				errs.add("server.public_url", "is empty, but remote nodes can't send callbacks to localhost")
+				break
+			}
+		}
+	}
+	for i, root := range config.Build.ProjectRoots {
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			errs.add(fmt.Sprintf("build.project_roots[%d]", i), "%s is not a directory", root)
+		}
+	}
+	validateFileExists("server.tls_cert", config.Server.TLSCert, &errs)
+	validateFileExists("server.tls_key", config.Server.TLSKey, &errs)
+
+	switch strings.ToLower(config.Logging.Level) {
+	case "", "debug", "info", "warn", "error":
+	default:
+		errs.add("logging.level", "%q is not one of debug, info, warn or error", config.Logging.Level)
+	}
+	switch strings.ToLower(config.Logging.Format) {
+	case "", "text", "json":
+	default:
+		errs.add("logging.format", "%q is not one of text or json", config.Logging.Format)
+	}
+	switch strings.ToLower(config.Tracing.Exporter) {
+	case "", "otlp", "stdout":
+	default:
+		errs.add("tracing.exporter", "%q is not one of otlp or stdout", config.Tracing.Exporter)
+	}
+	if config.Tracing.SampleRatio < 0 || config.Tracing.SampleRatio > 1 {
+		errs.add("tracing.sample_ratio", "must be between 0 and 1")
+	}
+
+	validateAuth(config.Auth, &errs)
+	validateCORS(config.CORS, &errs)
+	if config.Callbacks.SecretEnv != "" && os.Getenv(config.Callbacks.SecretEnv) == "" {
+		errs.add("callbacks.secret_env", "environment variable %s is not set", config.Callbacks.SecretEnv)
+	}
+	if config.Audit.KeyEnv != "" && os.Getenv(config.Audit.KeyEnv) == "" {
+		errs.add("audit.key_env", "environment variable %s is not set", config.Audit.KeyEnv)
+	}
+	for field, limit := range map[string]RateLimit{
+		"rate_limit.read":      config.RateLimit.Read,
+		"rate_limit.expensive": config.RateLimit.Expensive,
+		"rate_limit.client":    config.RateLimit.Client,
+	} {
+		if limit.RequestsPerMinute < 0 || limit.Burst < 0 {
+			errs.add(field, "requests_per_minute and burst can't be negative")
+		}
+	}
+	sortErrors(errs)
+	return errs
+}
+
+// validateCORS checks the origins the CORS middleware would otherwise panic on, and
+// credentials for any origin, which browsers refuse
+func validateCORS(cors CORSConfig, errs *ValidationErrors) {
+	for i, origin := range cors.AllowOrigins {
+		field := fmt.Sprintf("cors.allow_origins[%d]", i)
+		if origin == "*" {
+			if len(cors.AllowOrigins) > 1 {
+				errs.add(field, "\"*\" can't be combined with other origins")
+			}
+			continue
+		}
+		parsed, err := url.Parse(origin)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+			strings.Contains(origin, "*") || parsed.Path != "" || parsed.RawQuery != "" {
+			errs.add(field, "%q is not an origin such as https://app.example.org", origin)
+		}
+	}
+	if cors.AllowCredentials && (len(cors.AllowOrigins) == 0 || slices.Contains(cors.AllowOrigins, "*")) {
+		errs.add("cors.allow_credentials", "needs allow_origins to list origins, browsers refuse credentials for every origin")
+	}
+}
+
+func validateNodes(config *Config, errs *ValidationErrors) {
+	if len(config.Nodes) == 0 {
+		errs.add("nodes", "no nodes configured")
+		return
+	}
+	_, collisions := indexNodes(config.Nodes)
+	*errs = append(*errs, collisions...)
+	for key, node := range config.Nodes {
+		field := "nodes." + key
+		if node.Name == "" {
+			errs.add(field+".name", "is empty")
+		}
+		if port, err := strconv.Atoi(node.Port); err != nil || port < 1 || port > 65535 {
+			errs.add(field+".port", "%q is not a valid port", node.Port)
+		}
+		if node.DID == "" {
+			errs.add(field+".did", "is empty")
+		}
+
+		// Contract artifacts are read from path unless the node serves them over HTTP
+		if node.Path == "" && node.ArtifactURL == "" {
+			errs.add(field+".path", "is empty and no artifact_url is set")
+		}
+		if node.URL != "" {
+			parsed, err := url.Parse(node.URL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				errs.add(field+".url", "%q is not an http or https URL", node.URL)
+			}
+		}
+		if (node.ClientCert == "") != (node.ClientKey == "") {
+			errs.add(field, "client_cert and client_key must be set together")
+		}
+		validateFileExists(field+".ca_cert", node.CACert, errs)
+		validateFileExists(field+".client_cert", node.ClientCert, errs)
+		validateFileExists(field+".client_key", node.ClientKey, errs)
+	}
+}
+
+func validateContracts(config *Config, errs *ValidationErrors) {
+	hashes := make(map[string]string)
+	for key, contract := range config.Contracts {
+		field := "contracts." + key
+		if contract.Hash == "" {
+			errs.add(field+".hash", "is empty")
+		} else if other, duplicate := hashes[contract.Hash]; duplicate {
+			errs.add(field+".hash", "%s is also used by contracts.%s", contract.Hash, other)
+		} else {
+			hashes[contract.Hash] = key
+		}
+		validateDigest(field+".wasm_sha256", contract.WasmSHA256, errs)
+		validateDigest(field+".lib_sha256", contract.LibSHA256, errs)
+		for i, grant := range contract.HostFunctions {
+			if grant.Name == "" {
+				errs.add(fmt.Sprintf("%s.host_functions[%d].name", field, i), "is empty")
+			}
+		}
+	}
+}
+
+func validateAuth(auth AuthConfig, errs *ValidationErrors) {
+	jwtConfigured := auth.JWT.HMACSecretEnv != "" || auth.JWT.JWKSFile != ""
+	if auth.Enabled && len(auth.APIKeys) == 0 && !jwtConfigured {
+		errs.add("auth", "enabled without any api_keys or jwt settings")
+	}
+	names := make(map[string]bool)
+	for i, key := range auth.APIKeys {
+		field := fmt.Sprintf("auth.api_keys[%d]", i)
+		if key.Name == "" {
+			errs.add(field+".name", "is empty")
+		} else if names[key.Name] {
+			errs.add(field+".name", "%q is used by another key", key.Name)
+		}
+		names[key.Name] = true
+		if digest, err := hex.DecodeString(key.KeySHA256); err != nil || len(digest) != 32 {
+			errs.add(field+".key_sha256", "must be a hex SHA-256 digest")
+		}
+	}
+	if auth.JWT.HMACSecretEnv != "" && os.Getenv(auth.JWT.HMACSecretEnv) == "" {
+		errs.add("auth.jwt.hmac_secret_env", "environment variable %s is not set", auth.JWT.HMACSecretEnv)
+	}
+	validateFileExists("auth.jwt.jwks_file", auth.JWT.JWKSFile, errs)
+}
+
+// validateLoyalty checks the settings the activity and reward handlers depend on.
+// With branches configured each branch brings its own contracts instead.
+func validateLoyalty(config *Config, errs *ValidationErrors) {
+	shared := len(config.Branches) == 0
+	for field, hash := range map[string]string{
+		"loyalty.add_activity_contract": config.Loyalty.AddActivityContract,
+		"loyalty.transfer_contract":     config.Loyalty.TransferContract,
+	} {
+		if hash == "" {
+			if shared {
+				errs.add(field, "is empty")
+			}
+		} else if _, exists := GetContractByHash(config, hash); !exists {
+			errs.add(field, "contract %s is not in the contract registry", hash)
+		}
+	}
+	if config.Storage.ActivityUpdatePath == "" {
+		if shared {
+			errs.add("storage.activity_update_path", "is empty")
+		}
+		for id, branch := range config.Branches {
+			if branch.ActivityUpdatePath == "" {
+				errs.add("branches."+id+".activity_update_path", "is empty and storage.activity_update_path isn't set to derive it from")
+			}
+		}
+	}
+	validateBranches(config, errs)
+}
+
+func validateCatalogue(config *Config, errs *ValidationErrors) {
+	seen := make(map[string]bool)
+	for i, category := range config.Catalogue.Categories {
+		field := fmt.Sprintf("catalogue.categories[%d]", i)
+		if category == "" {
+			errs.add(field, "is empty")
+		} else if seen[category] {
+			errs.add(field, "%s is listed twice", category)
+		}
+		seen[category] = true
+	}
+}
+
+func validateBranches(config *Config, errs *ValidationErrors) {
+	if config.DefaultBranch != "" {
+		if _, exists := config.Branches[config.DefaultBranch]; !exists {
+			errs.add("default_branch", "branch %q is not configured", config.DefaultBranch)
+		}
+	}
+	owners := make(map[string]string)
+	stores := make(map[string]string)
+	for _, branch := range ListBranches(config) {
+		if branch.ID == "" {
+			continue
+		}
+		field := "branches." + branch.ID
+		if len(branch.AdminDIDs) == 0 {
+			errs.add(field+".admin_dids", "is empty")
+		}
+		for _, did := range branch.AdminDIDs {
+			if _, exists := GetNodeByDid(config, did); !exists {
+				errs.add(field+".admin_dids", "%s is not hosted on any configured node", did)
+			}
+		}
+		// A callback is routed to its branch by contract, so no contract may serve two branches
+		hashes := make(map[string]bool)
+		for _, key := range branch.Contracts {
+			contract, exists := config.Contracts[key]
+			if !exists {
+				errs.add(field+".contracts", "%q is not in the contract registry", key)
+				continue
+			}
+			hashes[contract.Hash] = true
+			if other, taken := owners[key]; taken {
+				errs.add(field+".contracts", "%q also belongs to branches.%s", key, other)
+			} else {
+				owners[key] = branch.ID
+			}
+		}
+		for name, hash := range map[string]string{
+			"add_activity_contract": branch.AddActivityContract,
+			"transfer_contract":     branch.TransferContract,
+		} {
+			if hash == "" {
+				errs.add(field+"."+name, "is empty")
+			} else if !hashes[hash] {
+				errs.add(field+"."+name, "contract %s is not one of the branch's contracts", hash)
+			}
+		}
+		if branch.ActivityUpdatePath != "" {
+			if other, taken := stores[branch.ActivityUpdatePath]; taken {
+				errs.add(field+".activity_update_path", "%s is also used by branches.%s", branch.ActivityUpdatePath, other)
+			}
+			stores[branch.ActivityUpdatePath] = branch.ID
+		}
+		if branch.Rewards.Multiplier < 0 || branch.Rewards.MaxPoints < 0 {
+			errs.add(field+".rewards", "multiplier and max_points can't be negative")
+		}
+	}
+}
+
+func validateDuration(field string, value string, errs *ValidationErrors) {
+	if value == "" {
+		return
+	}
+	if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+		errs.add(field, "%q is not a positive duration such as \"30s\"", value)
+	}
+}
+
+func validateDigest(field string, value string, errs *ValidationErrors) {
+	if value == "" {
+		return
+	}
+	if digest, err := hex.DecodeString(value); err != nil || len(digest) != 32 {
+		errs.add(field, "must be a hex SHA-256 digest")
+	}
+}
+
+func validateFileExists(field string, path string, errs *ValidationErrors) {
+	if path == "" {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		errs.add(field, "%s can't be read: %v", path, err)
+	}
+}
+
+func sortErrors(errs ValidationErrors) {
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+}
+
+// validateAttendance checks the member registry and that automatic confirmation has someone to sign transfers
+func validateAttendance(config *Config, errs *ValidationErrors) {
+	// Sorted so the same member is always the one reported as the duplicate
+	sortedIDs := make([]string, 0, len(config.Attendance.Members))
+	for memberID := range config.Attendance.Members {
+		sortedIDs = append(sortedIDs, memberID)
+	}
+	sort.Strings(sortedIDs)
+	memberIDs := make(map[string]string)
+	for _, memberID := range sortedIDs {
+		did := config.Attendance.Members[memberID]
+		if did == "" {
+			errs.add("attendance.members."+memberID, "is empty")
+		} else if other, duplicate := memberIDs[did]; duplicate {
+			errs.add("attendance.members."+memberID, "%s is also registered as member %s", did, other)
+		} else {
+			memberIDs[did] = memberID
+		}
+	}
+	if !config.Attendance.AutoConfirm {
+		return
+	}
+	for _, branch := range ListBranches(config) {
+		if _, exists := GetRewardSigner(config, branch); !exists {
+			field := "attendance.admin_did"
+			if branch.ID != "" {
+				field = "branches." + branch.ID + ".admin_dids"
+			}
+			errs.add(field, "auto_confirm needs a DID to sign reward transfers")
+		}
+	}
+}
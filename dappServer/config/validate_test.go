@@ -0,0 +1,160 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// validConfig returns a single-node configuration that passes Validate
+func validConfig() *Config {
+	return &Config{
+		Loyalty: LoyaltyConfig{AddActivityContract: "hash-add", TransferContract: "hash-transfer"},
+		Storage: StorageConfig{ActivityUpdatePath: "activities.json"},
+		Nodes: map[string]Node{
+			"node1": {Name: "node1", Port: "20000", DID: "did:node1", Path: "/srv/node1"},
+		},
+		Contracts: map[string]Contract{
+			"add":      {Name: "add", Hash: "hash-add"},
+			"transfer": {Name: "transfer", Hash: "hash-transfer"},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "server.crt")
+	if err := os.WriteFile(cert, []byte("certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		change     func(c *Config)
+		wantFields []string
+	}{
+		{name: "valid", change: func(c *Config) {}},
+		{
+			name:       "no nodes",
+			change:     func(c *Config) { c.Nodes = nil },
+			wantFields: []string{"nodes"},
+		},
+		{
+			name: "bad durations",
+			change: func(c *Config) {
+				c.HealthCheckInterval = "often"
+				c.Server.ReadTimeout = "-5s"
+				c.Attendance.TransferTimeout = "0s"
+				c.Idempotency.TTL = "24h"
+			},
+			wantFields: []string{"attendance.transfer_timeout", "health_check_interval", "server.read_timeout"},
+		},
+		{
+			name:       "tls cert without key",
+			change:     func(c *Config) { c.Server.TLSCert = cert },
+			wantFields: []string{"server"},
+		},
+		{
+			name: "tls files missing",
+			change: func(c *Config) {
+				c.Server.TLSCert = filepath.Join(dir, "missing.crt")
+				c.Server.TLSKey = filepath.Join(dir, "missing.key")
+			},
+			wantFields: []string{"server.tls_cert", "server.tls_key"},
+		},
+		{
+			name:       "public url not http",
+			change:     func(c *Config) { c.Server.PublicURL = "ftp://dapp.example.org" },
+			wantFields: []string{"server.public_url"},
+		},
+		{
+			name:   "public url https",
+			change: func(c *Config) { c.Server.PublicURL = "https://dapp.example.org/" },
+		},
+		{
+			name: "remote node without public url",
+			change: func(c *Config) {
+				c.Nodes["node1"] = Node{Name: "node1", Port: "20000", DID: "did:node1", Path: "/srv/node1", URL: "https://node1.example.org:20000"}
+			},
+			wantFields: []string{"server.public_url"},
+		},
+		{
+			name: "remote node with public url",
+			change: func(c *Config) {
+				c.Server.PublicURL = "https://dapp.example.org"
+				c.Nodes["node1"] = Node{Name: "node1", Port: "20000", DID: "did:node1", Path: "/srv/node1", URL: "https://node1.example.org:20000"}
+			},
+		},
+		{
+			name: "build roots",
+			change: func(c *Config) {
+				c.Build.ProjectRoots = []string{dir, filepath.Join(dir, "missing")}
+				c.Build.Timeout = "10 minutes"
+			},
+			wantFields: []string{"build.project_roots[1]", "build.timeout"},
+		},
+		{
+			name: "cors explicit origins with credentials",
+			change: func(c *Config) {
+				c.CORS = CORSConfig{AllowOrigins: []string{"https://app.example.org", "http://localhost:3000"}, AllowCredentials: true}
+			},
+		},
+		{
+			name:       "cors wildcard among origins",
+			change:     func(c *Config) { c.CORS.AllowOrigins = []string{"*", "https://app.example.org"} },
+			wantFields: []string{"cors.allow_origins[0]"},
+		},
+		{
+			name: "cors malformed origins",
+			change: func(c *Config) {
+				c.CORS.AllowOrigins = []string{"app.example.org", "https://*.example.org", "https://app.example.org/path", "https://app.example.org?q=1"}
+			},
+			wantFields: []string{"cors.allow_origins[0]", "cors.allow_origins[1]", "cors.allow_origins[2]", "cors.allow_origins[3]"},
+		},
+		{
+			name:       "cors credentials for every origin",
+			change:     func(c *Config) { c.CORS = CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true} },
+			wantFields: []string{"cors.allow_credentials"},
+		},
+		{
+			name:       "cors credentials without origins",
+			change:     func(c *Config) { c.CORS.AllowCredentials = true },
+			wantFields: []string{"cors.allow_credentials"},
+		},
+		{
+			name: "duplicate member dids",
+			change: func(c *Config) {
+				c.Attendance.Members = map[string]string{"m1": "did:alice", "m2": "did:alice", "m3": "", "m4": "did:bob"}
+			},
+			wantFields: []string{"attendance.members.m2", "attendance.members.m3"},
+		},
+		{
+			name:       "auto confirm without a signer",
+			change:     func(c *Config) { c.Attendance.AutoConfirm = true },
+			wantFields: []string{"attendance.admin_did"},
+		},
+		{
+			name:       "audit key variable unset",
+			change:     func(c *Config) { c.Audit.KeyEnv = "TEST_AUDIT_KEY_UNSET" },
+			wantFields: []string{"audit.key_env"},
+		},
+		{
+			name:       "negative rate limit",
+			change:     func(c *Config) { c.RateLimit.Read = RateLimit{RequestsPerMinute: -1} },
+			wantFields: []string{"rate_limit.read"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig()
+			tt.change(config)
+			var fields []string
+			for _, err := range Validate(config) {
+				fields = append(fields, err.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Fatalf("Validate() reported %v, want %v", Validate(config), tt.wantFields)
+			}
+		})
+	}
+}
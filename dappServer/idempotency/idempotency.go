@@ -0,0 +1,197 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"dapp-server/auth"
+	"dapp-server/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header clients send to make a POST safe to retry
+const Header = "Idempotency-Key"
+
+// ReplayedHeader marks a response replayed from the store
+const ReplayedHeader = "Idempotent-Replayed"
+
+const maxKeyLength = 255
+
+// Largest request body fingerprinted, bigger bodies are refused when a key is sent
+const maxBodySize = 10 << 20
+
+type record struct {
+	fingerprint string
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// Store remembers the response to each idempotency key for ttl
+type Store struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	records map[string]*record
+}
+
+func NewStore(ttl time.Duration) *Store {
+	return &Store{ttl: ttl, records: make(map[string]*record)}
+}
+
+// Longest a request may hold its key. A handler stuck past it no longer blocks retries.
+const inProgressTimeout = time.Hour
+
+// begin claims key for a request with the given fingerprint. It returns a copy of the stored
+// record when the key was already used, or the claim the caller now owns the key with.
+func (s *Store) begin(key string, fingerprint string) (existing *record, claim *record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, r := range s.records {
+		if now.After(r.expires) {
+			delete(s.records, k)
+		}
+	}
+	if stored, exists := s.records[key]; exists {
+		copied := *stored
+		return &copied, nil
+	}
+	claim = &record{fingerprint: fingerprint, expires: now.Add(inProgressTimeout)}
+	s.records[key] = claim
+	return nil, claim
+}
+
+// complete stores the response under key, unless the claim expired and the key was claimed again
+func (s *Store) complete(key string, claim *record, status int, contentType string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.records[key] != claim {
+		return
+	}
+	claim.done = true
+	claim.status = status
+	claim.contentType = contentType
+	claim.body = body
+	claim.expires = time.Now().Add(s.ttl)
+}
+
+// release forgets key so the request can be retried
+func (s *Store) release(key string, claim *record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.records[key] == claim {
+		delete(s.records, key)
+	}
+}
+
+// Context key set by handlers that changed something outside the server
+const sideEffectsKey = "idempotency.side_effects"
+
+// MarkSideEffects tells the middleware the request changed something a retry would change
+// again, such as running a contract, so its response is kept whatever the status
+func MarkSideEffects(c *gin.Context) {
+	c.Set(sideEffectsKey, true)
+}
+
+// recordingWriter keeps a copy of the response body
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// Middleware makes POST requests carrying an Idempotency-Key safe to retry. The first
+// response is stored and replayed for retries with the same body; a different body under
+// the same key gets 422 and a retry while the first attempt is still running gets 409.
+// Responses of requests marked with MarkSideEffects are always stored, so a retry can't
+// repeat them. Otherwise only successful responses with a body are stored and anything else
+// releases the key so the request can be retried. Keys are scoped to the caller, so the
+// middleware runs after authentication and rate limiting.
+func Middleware(store *Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(Header)
+		if c.Request.Method != http.MethodPost || key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBodySize+1))
+		if err != nil || len(body) > maxBodySize {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large for an idempotent request"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scopedKey := callerScope(c) + "|" + key
+		fingerprint := fingerprintRequest(c.Request.Method, c.Request.URL.Path, body)
+		existing, claim := store.begin(scopedKey, fingerprint)
+		if existing != nil {
+			switch {
+			case existing.fingerprint != fingerprint:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			case !existing.done:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still in progress"})
+			default:
+				logger.FromContext(c.Request.Context()).Info("replaying idempotent response", "status", existing.status)
+				c.Header(ReplayedHeader, "true")
+				c.Data(existing.status, existing.contentType, existing.body)
+				c.Abort()
+			}
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if !c.GetBool(sideEffectsKey) {
+					store.release(scopedKey, claim)
+				}
+				panic(recovered)
+			}
+		}()
+		c.Next()
+
+		status := c.Writer.Status()
+		if !c.GetBool(sideEffectsKey) && (status < 200 || status > 299 || writer.body.Len() == 0) {
+			store.release(scopedKey, claim)
+			return
+		}
+		store.complete(scopedKey, claim, status, c.Writer.Header().Get("Content-Type"), writer.body.Bytes())
+	}
+}
+
+// callerScope keeps one caller's keys from colliding with another's
+func callerScope(c *gin.Context) string {
+	if principal, exists := auth.GetPrincipal(c); exists && principal.Method != auth.MethodAnonymous {
+		return principal.Method + ":" + principal.Subject
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func fingerprintRequest(method string, path string, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, method+" "+path+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,260 @@
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type request struct {
+	method string
+	path   string
+	key    string
+	body   string
+}
+
+// newRouter counts how often the handlers behind the middleware run
+func newRouter(store *Store, calls *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware(store))
+	handle := func(status int, body bool) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			*calls++
+			if !body {
+				c.Status(status)
+				return
+			}
+			c.JSON(status, gin.H{"message": "done", "data": *calls})
+		}
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		router.Handle(method, "/ok", handle(http.StatusOK, true))
+		router.Handle(method, "/created", handle(http.StatusCreated, true))
+		router.Handle(method, "/bad", handle(http.StatusBadRequest, true))
+		router.Handle(method, "/fail", handle(http.StatusInternalServerError, true))
+		router.Handle(method, "/empty", handle(http.StatusOK, false))
+		router.Handle(method, "/partial", func(c *gin.Context) {
+			*calls++
+			MarkSideEffects(c)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "unconfirmed", "data": *calls})
+		})
+		router.Handle(method, "/partial-empty", func(c *gin.Context) {
+			*calls++
+			MarkSideEffects(c)
+			c.Status(http.StatusAccepted)
+		})
+	}
+	return router
+}
+
+func serve(router *gin.Engine, req request) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(req.method, req.path, strings.NewReader(req.body))
+	r.RemoteAddr = "192.0.2.1:1234"
+	if req.key != "" {
+		r.Header.Set(Header, req.key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	post := func(path string, key string, body string) request {
+		return request{method: http.MethodPost, path: path, key: key, body: body}
+	}
+	tests := []struct {
+		name         string
+		requests     []request
+		wantStatus   []int
+		wantReplayed []bool
+		wantCalls    int
+	}{
+		{
+			name:         "success replayed",
+			requests:     []request{post("/ok", "k1", `{"a":1}`), post("/ok", "k1", `{"a":1}`)},
+			wantStatus:   []int{200, 200},
+			wantReplayed: []bool{false, true},
+			wantCalls:    1,
+		},
+		{
+			name:         "created replayed",
+			requests:     []request{post("/created", "k1", `{}`), post("/created", "k1", `{}`)},
+			wantStatus:   []int{201, 201},
+			wantReplayed: []bool{false, true},
+			wantCalls:    1,
+		},
+		{
+			name:         "different body under the same key",
+			requests:     []request{post("/ok", "k1", `{"a":1}`), post("/ok", "k1", `{"a":2}`)},
+			wantStatus:   []int{200, 422},
+			wantReplayed: []bool{false, false},
+			wantCalls:    1,
+		},
+		{
+			name:         "different path under the same key",
+			requests:     []request{post("/ok", "k1", `{}`), post("/created", "k1", `{}`)},
+			wantStatus:   []int{200, 422},
+			wantReplayed: []bool{false, false},
+			wantCalls:    1,
+		},
+		{
+			name:         "client error not stored",
+			requests:     []request{post("/bad", "k1", `{}`), post("/bad", "k1", `{}`)},
+			wantStatus:   []int{400, 400},
+			wantReplayed: []bool{false, false},
+			wantCalls:    2,
+		},
+		{
+			name:         "server error not stored",
+			requests:     []request{post("/fail", "k1", `{}`), post("/fail", "k1", `{}`)},
+			wantStatus:   []int{500, 500},
+			wantReplayed: []bool{false, false},
+			wantCalls:    2,
+		},
+		{
+			name:         "empty success not stored",
+			requests:     []request{post("/empty", "k1", `{}`), post("/empty", "k1", `{}`)},
+			wantStatus:   []int{200, 200},
+			wantReplayed: []bool{false, false},
+			wantCalls:    2,
+		},
+		{
+			name:         "failure after side effects replayed",
+			requests:     []request{post("/partial", "k1", `{}`), post("/partial", "k1", `{}`)},
+			wantStatus:   []int{502, 502},
+			wantReplayed: []bool{false, true},
+			wantCalls:    1,
+		},
+		{
+			name:         "empty response after side effects replayed",
+			requests:     []request{post("/partial-empty", "k1", `{}`), post("/partial-empty", "k1", `{}`)},
+			wantStatus:   []int{202, 202},
+			wantReplayed: []bool{false, true},
+			wantCalls:    1,
+		},
+		{
+			name:         "released key reusable for another body",
+			requests:     []request{post("/fail", "k1", `{"a":1}`), post("/ok", "k1", `{"a":2}`)},
+			wantStatus:   []int{500, 200},
+			wantReplayed: []bool{false, false},
+			wantCalls:    2,
+		},
+		{
+			name:         "no key",
+			requests:     []request{post("/ok", "", `{}`), post("/ok", "", `{}`)},
+			wantStatus:   []int{200, 200},
+			wantReplayed: []bool{false, false},
+			wantCalls:    2,
+		},
+		{
+			name: "get ignores the key",
+			requests: []request{
+				{method: http.MethodGet, path: "/ok", key: "k1"},
+				{method: http.MethodGet, path: "/ok", key: "k1"},
+			},
+			wantStatus:   []int{200, 200},
+			wantReplayed: []bool{false, false},
+			wantCalls:    2,
+		},
+		{
+			name:         "key too long",
+			requests:     []request{post("/ok", strings.Repeat("k", maxKeyLength+1), `{}`)},
+			wantStatus:   []int{400},
+			wantReplayed: []bool{false},
+			wantCalls:    0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			router := newRouter(NewStore(time.Hour), &calls)
+			var first string
+			for i, req := range tt.requests {
+				w := serve(router, req)
+				if w.Code != tt.wantStatus[i] {
+					t.Fatalf("request %d status = %d, want %d", i, w.Code, tt.wantStatus[i])
+				}
+				if replayed := w.Header().Get(ReplayedHeader) == "true"; replayed != tt.wantReplayed[i] {
+					t.Fatalf("request %d replayed = %v, want %v", i, replayed, tt.wantReplayed[i])
+				}
+				if i == 0 {
+					first = w.Body.String()
+				} else if tt.wantReplayed[i] && w.Body.String() != first {
+					t.Fatalf("replayed body = %s, want %s", w.Body.String(), first)
+				}
+			}
+			if calls != tt.wantCalls {
+				t.Fatalf("handler ran %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestMiddlewareInProgress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := NewStore(time.Hour)
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	router := gin.New()
+	router.POST("/slow", Middleware(store), func(c *gin.Context) {
+		close(started)
+		<-finish
+		c.JSON(http.StatusOK, gin.H{"message": "done"})
+	})
+
+	req := request{method: http.MethodPost, path: "/slow", key: "k1", body: `{}`}
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serve(router, req) }()
+	<-started
+	if w := serve(router, req); w.Code != http.StatusConflict {
+		t.Fatalf("retry while in progress status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	close(finish)
+	if w := <-done; w.Code != http.StatusOK {
+		t.Fatalf("first request status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := serve(router, req); w.Code != http.StatusOK || w.Header().Get(ReplayedHeader) != "true" {
+		t.Fatalf("retry after completion status = %d replayed = %q, want a replayed 200", w.Code, w.Header().Get(ReplayedHeader))
+	}
+}
+
+func TestStoreExpiry(t *testing.T) {
+	store := NewStore(time.Millisecond)
+	existing, claim := store.begin("k", "f")
+	if existing != nil {
+		t.Fatal("new key already claimed")
+	}
+	store.complete("k", claim, http.StatusOK, "application/json", []byte(`{}`))
+	time.Sleep(5 * time.Millisecond)
+	if existing, _ := store.begin("k", "other"); existing != nil {
+		t.Fatalf("expired key still stored: %+v", existing)
+	}
+}
+
+func TestStoreInProgressExpiry(t *testing.T) {
+	store := NewStore(time.Hour)
+	_, stuck := store.begin("k", "f")
+	if existing, _ := store.begin("k", "f"); existing == nil || existing.done {
+		t.Fatalf("key in progress = %+v, want it claimed", existing)
+	}
+
+	// A claim past its timeout no longer blocks retries, and finishing late doesn't overwrite the retry's claim
+	store.mu.Lock()
+	stuck.expires = time.Now().Add(-time.Second)
+	store.mu.Unlock()
+	existing, retry := store.begin("k", "f")
+	if existing != nil {
+		t.Fatalf("expired claim still stored: %+v", existing)
+	}
+	store.complete("k", stuck, http.StatusOK, "application/json", []byte(`{"stuck":true}`))
+	store.release("k", stuck)
+	store.complete("k", retry, http.StatusOK, "application/json", []byte(`{"retry":true}`))
+	if existing, _ := store.begin("k", "f"); existing == nil || string(existing.body) != `{"retry":true}` {
+		t.Fatalf("stored record = %+v, want the retry's response", existing)
+	}
+}
@@ -0,0 +1,184 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the request ID between the dapp server, its clients and the nodes
+const RequestIDHeader = "X-Request-ID"
+
+const redacted = "[REDACTED]"
+
+// Attribute and JSON keys whose values never reach the logs
+var sensitiveKeys = map[string]bool{
+	"password":            true,
+	"priv_pwd":            true,
+	"secret":              true,
+	"signature":           true,
+	"initiatorsignature":  true,
+	"initiator_signature": true,
+	"initiatorsigndata":   true,
+	"initiator_sign_data": true,
+	"authorization":       true,
+}
+
+type requestIDKey struct{}
+
+// Setup installs the default logger. level is debug, info, warn or error and
+// format is json or text; unknown values fall back to info and text.
+func Setup(level string, format string) {
+	slog.SetDefault(New(os.Stdout, level, format))
+}
+
+// New builds a logger writing to w with sensitive attributes redacted
+func New(w io.Writer, level string, format string) *slog.Logger {
+	options := &slog.HandlerOptions{
+		Level:       parseLevel(level),
+		ReplaceAttr: redactAttr,
+	}
+	var handler slog.Handler
+	if strings.EqualFold(format, "json") {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = slog.NewTextHandler(w, options)
+	}
+	return slog.New(handler)
+}
+
+func parseLevel(level string) slog.Level {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo
+	}
+	return parsed
+}
+
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	if isSensitive(attr.Key) {
+		return slog.String(attr.Key, redacted)
+	}
+	return attr
+}
+
+func isSensitive(key string) bool {
+	return sensitiveKeys[strings.ToLower(key)]
+}
+
+// RedactJSON returns a JSON document with sensitive fields masked, for logging raw node responses.
+// Bodies that aren't JSON are summarised by size rather than logged.
+func RedactJSON(body []byte) string {
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return fmt.Sprintf("<%d byte non-JSON body>", len(body))
+	}
+	redactedBody, err := json.Marshal(redactValue(document))
+	if err != nil {
+		return "<unloggable body>"
+	}
+	return string(redactedBody)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			if isSensitive(key) {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redactValue(inner)
+		}
+		return v
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = redactValue(inner)
+		}
+		return v
+	case string:
+		// Contract data is often JSON nested inside a string
+		trimmed := strings.TrimSpace(v)
+		if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			return RedactJSON([]byte(trimmed))
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// WithRequestID returns a context carrying the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID carried by ctx, or an empty string
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// FromContext returns the default logger annotated with the context's request ID and trace ID
+func FromContext(ctx context.Context) *slog.Logger {
+	log := slog.Default()
+	if requestID := RequestID(ctx); requestID != "" {
+		log = log.With("request_id", requestID)
+	}
+	if ctx != nil {
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+			log = log.With("trace_id", spanContext.TraceID().String())
+		}
+	}
+	return log
+}
+
+// Detach keeps the request ID and trace of ctx for work that outlives the request
+func Detach(ctx context.Context) context.Context {
+	detached := WithRequestID(context.Background(), RequestID(ctx))
+	return trace.ContextWithSpanContext(detached, trace.SpanContextFromContext(ctx))
+}
+
+// Middleware assigns every request an ID (reusing the caller's X-Request-ID),
+// returns it in the response and logs the completed request
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), requestID))
+		c.Header(RequestIDHeader, requestID)
+
+		start := time.Now()
+		c.Next()
+		FromContext(c.Request.Context()).Info("request completed",
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return hex.EncodeToString([]byte(time.Now().Format("150405.000000")))
+	}
+	return hex.EncodeToString(b)
+}
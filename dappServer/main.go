@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"dapp-server/commands"
 	"dapp-server/config"
+	"dapp-server/logger"
 	"dapp-server/server"
-)
+	"dapp-server/tracing"
+	"fmt"
+	"log/slog"
+	"os"
 
-const CONFIG_PATH = ".config/config.toml"
+	"github.com/spf13/cobra"
+)
 
 func main() {
 	// Create a new registry
@@ -15,8 +22,44 @@ func main() {
 	// registry.Register(rubix_interaction.NewWriteToJsonFile())
 	// hostFunction := registry.GetHostFunctions()
 	// fmt.Println("Host function is :", hostFunction)
-	config.LoadConfig(CONFIG_PATH)
-	config.LoadEnvConfig()
-	server.BootupServer()
+	shutdownTracing := func(context.Context) error { return nil }
+
+	// The configuration depends on --config, --profile and --set, so it is loaded once flags are parsed
+	commands.RootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		opts, err := commands.LoadOptions()
+		if err != nil {
+			return err
+		}
+		if err := config.LoadConfig(opts); err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		cfg, _ := config.GetConfig()
+		logger.Setup(cfg.Logging.Level, cfg.Logging.Format)
+		slog.Debug("configuration loaded", "files", config.GetConfigFiles(), "profile", config.GetProfile())
+		shutdownTracing, err = tracing.Setup(cfg.Tracing)
+		if err != nil {
+			return fmt.Errorf("failed to set up tracing: %w", err)
+		}
+		return nil
+	}
 
+	// Running without a subcommand starts the dapp server
+	commands.RootCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		cfg, _ := config.GetConfig()
+		if errs := config.Validate(cfg); len(errs) > 0 {
+			if !commands.AllowInvalidConfig {
+				return fmt.Errorf("refusing to start with an invalid configuration, pass --allow-invalid-config to override\n%w", errs)
+			}
+			slog.Warn("starting with an invalid configuration", "problems", len(errs), "error", errs.Error())
+		}
+		return server.BootupServer()
+	}
+	err := commands.RootCmd.Execute()
+	if err := shutdownTracing(context.Background()); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dapp_http_requests_total",
+		Help: "HTTP requests handled, by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dapp_http_request_duration_seconds",
+		Help:    "HTTP request latency by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	nodeRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dapp_rubix_requests_total",
+		Help: "Rubix node API calls, by node, endpoint and outcome.",
+	}, []string{"node", "endpoint", "outcome"})
+
+	nodeRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dapp_rubix_request_duration_seconds",
+		Help:    "Rubix node API call latency by node and endpoint.",
+		Buckets: []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"node", "endpoint"})
+
+	wasmExecutionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dapp_wasm_execution_duration_seconds",
+		Help:    "Time spent in a contract function call, by contract hash and outcome.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"contract", "outcome"})
+
+	callbackLag = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dapp_callback_lag_seconds",
+		Help:    "Delay between a contract block's epoch and the dapp processing its callback.",
+		Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800},
+	}, []string{"contract"})
+
+	rewardPointsIssued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dapp_reward_points_issued_total",
+		Help: "Reward points transferred to members, by branch and activity.",
+	}, []string{"branch", "activity_id"})
+
+	rewardTokensIssued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dapp_reward_tokens_issued_total",
+		Help: "Reward tokens transferred to members after the branch's conversion rules, by branch and activity.",
+	}, []string{"branch", "activity_id"})
+
+	callbackRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dapp_callback_rejections_total",
+		Help: "Node callbacks refused, by reason.",
+	}, []string{"reason"})
+
+	rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dapp_rate_limited_total",
+		Help: "Requests refused by the rate limiter, by route class.",
+	}, []string{"class"})
+
+	jobQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dapp_job_queue_depth",
+		Help: "Background jobs queued or running, by kind.",
+	}, []string{"kind"})
+)
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// Middleware records the count and latency of every request against its route template
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		httpRequests.WithLabelValues(route, method, strconv.Itoa(c.Writer.Status())).Inc()
+		httpRequestDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// nodeEndpoints are the Rubix node API routes the dapp calls; their paths carry no IDs
+var nodeEndpoints = map[string]bool{
+	"/api/node-status":                         true,
+	"/api/generate-smart-contract":             true,
+	"/api/deploy-smart-contract":               true,
+	"/api/execute-smart-contract":              true,
+	"/api/signature-response":                  true,
+	"/api/register-callback-url":               true,
+	"/api/get-smart-contract-token-chain-data": true,
+	"/api/get-ft-info-by-did":                  true,
+	"/api/register-did":                        true,
+}
+
+type endpointKey struct{}
+
+// WithEndpoint labels the node calls made with ctx by a fixed route template,
+// for URLs that carry IDs such as contract hashes
+func WithEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, endpoint)
+}
+
+// endpointLabel keeps the endpoint label bounded: a template from the context, a known
+// node route, or "other" for anything else
+func endpointLabel(req *http.Request) string {
+	if endpoint, ok := req.Context().Value(endpointKey{}).(string); ok {
+		return endpoint
+	}
+	if nodeEndpoints[req.URL.Path] {
+		return req.URL.Path
+	}
+	return "other"
+}
+
+// nodeTransport times every request sent to a Rubix node
+type nodeTransport struct {
+	node string
+	next http.RoundTripper
+}
+
+// InstrumentNodeTransport wraps the transport used to talk to a node with call metrics
+func InstrumentNodeTransport(node string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &nodeTransport{node: node, next: next}
+}
+
+func (t *nodeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	endpoint := endpointLabel(req)
+	nodeRequestDuration.WithLabelValues(t.node, endpoint).Observe(time.Since(start).Seconds())
+
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	} else if resp.StatusCode >= http.StatusBadRequest {
+		outcome = "http_" + strconv.Itoa(resp.StatusCode)
+	}
+	nodeRequests.WithLabelValues(t.node, endpoint, outcome).Inc()
+	return resp, err
+}
+
+// ObserveWasmExecution records how long a contract function call took
+func ObserveWasmExecution(contractHash string, duration time.Duration, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	wasmExecutionDuration.WithLabelValues(contractHash, outcome).Observe(duration.Seconds())
+}
+
+// ObserveCallbackLag records the delay between a block's epoch (unix seconds) and now
+func ObserveCallbackLag(contractHash string, blockEpoch uint64) {
+	if blockEpoch == 0 {
+		return
+	}
+	lag := time.Since(time.Unix(int64(blockEpoch), 0))
+	callbackLag.WithLabelValues(contractHash).Observe(lag.Seconds())
+}
+
+// CallbackRejected counts a node callback refused for reason
+func CallbackRejected(reason string) {
+	callbackRejections.WithLabelValues(reason).Inc()
+}
+
+// RateLimited counts a request refused by the rate limiter for class
+func RateLimited(class string) {
+	rateLimited.WithLabelValues(class).Inc()
+}
+
+// AddRewardPoints counts the reward points of an activity issued by a branch and the tokens they were converted to
+func AddRewardPoints(branch string, activityID string, points int, tokens float64) {
+	rewardPointsIssued.WithLabelValues(branch, activityID).Add(float64(points))
+	rewardTokensIssued.WithLabelValues(branch, activityID).Add(tokens)
+}
+
+// JobQueued and JobDone track the depth of a background job queue
+func JobQueued(kind string) {
+	jobQueueDepth.WithLabelValues(kind).Inc()
+}
+
+func JobDone(kind string) {
+	jobQueueDepth.WithLabelValues(kind).Dec()
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"dapp-server/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLimiterReserve(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       config.RateLimit
+		requests    int
+		wantAllowed int
+	}{
+		{name: "within burst", limit: config.RateLimit{RequestsPerMinute: 60, Burst: 5}, requests: 5, wantAllowed: 5},
+		{name: "burst exhausted", limit: config.RateLimit{RequestsPerMinute: 60, Burst: 5}, requests: 8, wantAllowed: 5},
+		{name: "burst of one", limit: config.RateLimit{RequestsPerMinute: 1, Burst: 1}, requests: 3, wantAllowed: 1},
+		{name: "zero burst refuses everything", limit: config.RateLimit{RequestsPerMinute: 60, Burst: 0}, requests: 2, wantAllowed: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := New("test", tt.limit)
+			allowed := 0
+			for i := 0; i < tt.requests; i++ {
+				ok, retryAfter := limiter.Reserve("client")
+				if ok {
+					allowed++
+				} else if tt.limit.Burst > 0 && retryAfter <= 0 {
+					t.Fatalf("request %d refused without a retry delay", i)
+				}
+			}
+			if allowed != tt.wantAllowed {
+				t.Fatalf("allowed %d of %d requests, want %d", allowed, tt.requests, tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestLimiterKeepsClientsApart(t *testing.T) {
+	limiter := New("test", config.RateLimit{RequestsPerMinute: 1, Burst: 1})
+	if ok, _ := limiter.Reserve("a"); !ok {
+		t.Fatal("first request from a refused")
+	}
+	if ok, _ := limiter.Reserve("a"); ok {
+		t.Fatal("second request from a allowed")
+	}
+	if ok, _ := limiter.Reserve("b"); !ok {
+		t.Fatal("first request from b refused because of a")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		limiter    *Limiter
+		requests   int
+		wantStatus []int
+	}{
+		{name: "no limiter", limiter: nil, requests: 3, wantStatus: []int{200, 200, 200}},
+		{name: "limited", limiter: New("test", config.RateLimit{RequestsPerMinute: 1, Burst: 2}), requests: 3, wantStatus: []int{200, 200, 429}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", Middleware(tt.limiter), func(c *gin.Context) { c.Status(http.StatusOK) })
+			for i := 0; i < tt.requests; i++ {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.RemoteAddr = "192.0.2.1:1234"
+				router.ServeHTTP(w, r)
+				if w.Code != tt.wantStatus[i] {
+					t.Fatalf("request %d status = %d, want %d", i, w.Code, tt.wantStatus[i])
+				}
+				if w.Code == http.StatusTooManyRequests {
+					seconds, err := strconv.Atoi(w.Header().Get("Retry-After"))
+					if err != nil || seconds < 1 {
+						t.Fatalf("Retry-After = %q, want a positive number of seconds", w.Header().Get("Retry-After"))
+					}
+				}
+			}
+		})
+	}
+}
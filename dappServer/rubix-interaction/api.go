@@ -2,79 +2,132 @@ package rubix_interaction
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"dapp-server/config"
+	"dapp-server/logger"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 )
 
-func GetSmartContractData(token string, address string) []byte {
+func GetSmartContractData(ctx context.Context, token string, address string) []byte {
+	log := logger.FromContext(ctx).With("node_url", address, "contract", token)
 	data := map[string]interface{}{
 		"token":  token,
 		"latest": true,
 	}
 	bodyJSON, err := json.Marshal(data)
 	if err != nil {
-		fmt.Println("Error marshaling JSON:", err)
+		log.Error("failed to marshal token chain request", "error", err)
 		return nil
 	}
 	url := address + "/api/get-smart-contract-token-chain-data"
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(bodyJSON))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(bodyJSON))
 	if err != nil {
-		fmt.Println("Error creating HTTP request:", err)
+		log.Error("failed to create token chain request", "error", err)
 		return nil
 	}
 	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
 
-	client := &http.Client{}
+	client := nodeHTTPClient(address)
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Println("Error sending HTTP request:", err)
+		log.Error("failed to fetch token chain data", "error", err)
 		return nil
 	}
+	defer resp.Body.Close()
 
-	fmt.Println("Response Status:", resp.Status)
 	data2, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("Error reading response body: %s\n", err)
+		log.Error("failed to read token chain response", "error", err)
+		return nil
+	}
+	log.Debug("token chain data received", "status", resp.Status, "body", logger.RedactJSON(data2))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Error("node refused token chain request", "status", resp.Status)
+		return nil
+	}
+	var reply struct {
+		Status  *bool  `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data2, &reply); err != nil {
+		log.Error("failed to parse token chain response", "error", err)
+		return nil
+	}
+	if reply.Status != nil && !*reply.Status {
+		log.Error("node failed to return token chain data", "message", reply.Message)
 		return nil
 	}
-	// Process the data as needed
-	fmt.Println("Response Body in get smart contract data :", string(data2))
-
 	return data2
+}
+
+// CallbackTokenParam is the query parameter carrying a callback's token
+const CallbackTokenParam = "token"
 
+// CallbackSignatureHeader carries "sha256=" and the hex HMAC of a callback body, for nodes able to sign callbacks
+const CallbackSignatureHeader = "X-Callback-Signature"
+
+// CallbackToken derives the token a contract's callback URL carries from the shared secret,
+// so a leaked callback URL only lets its holder trigger that one contract
+func CallbackToken(secret []byte, contractHash string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(contractHash))
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
-func RegisterCallBackUrl(smartContractTokenHash string, urlPort string, endPoint string, nodePort string) {
-	callBackUrl := fmt.Sprintf("http://localhost:%s/%s", urlPort, endPoint)
+// CallbackPath is the dapp server route nodes send contract callbacks to
+const CallbackPath = "/api/callback/trigger"
+
+// RegisterCallBackUrl registers the dapp callback for a contract deployed on node and returns
+// the node's reply. With a callback secret configured the URL carries the contract's callback token.
+func RegisterCallBackUrl(ctx context.Context, smartContractTokenHash string, node config.Node) string {
+	log := logger.FromContext(ctx).With("contract", smartContractTokenHash, "node", node.Name)
+	cfg, err := config.GetConfig()
+	if err != nil {
+		log.Error("failed to load config", "error", err)
+		return ""
+	}
+	callBackUrl := config.GetPublicURL(cfg) + CallbackPath
+	loggedCallBackUrl := callBackUrl
+	if secret := config.GetCallbackSecret(cfg); secret != nil {
+		query := url.Values{CallbackTokenParam: {CallbackToken(secret, smartContractTokenHash)}}
+		callBackUrl += "?" + query.Encode()
+		loggedCallBackUrl += "?" + CallbackTokenParam + "=[REDACTED]"
+	}
 	data := map[string]interface{}{
 		"CallBackURL":        callBackUrl,
 		"SmartContractToken": smartContractTokenHash,
 	}
 	bodyJSON, err := json.Marshal(data)
 	if err != nil {
-		fmt.Println("Error marshaling JSON:", err)
-		return
+		log.Error("failed to marshal callback registration", "error", err)
+		return ""
 	}
-	url := fmt.Sprintf("http://localhost:%s/api/register-callback-url", nodePort)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(bodyJSON))
+	nodeURL := config.GetNodeURL(node)
+	req, err := http.NewRequestWithContext(ctx, "POST", nodeURL+"/api/register-callback-url", bytes.NewBuffer(bodyJSON))
 	if err != nil {
-		fmt.Println("Error creating HTTP request:", err)
-		return
+		log.Error("failed to create callback registration request", "error", err)
+		return ""
 	}
 	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
-	client := &http.Client{}
+	client := nodeHTTPClient(nodeURL)
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Println("Error sending HTTP request:", err)
-		return
+		log.Error("failed to register callback url", "error", err)
+		return ""
 	}
-	fmt.Println("Response Status:", resp.Status)
+	defer resp.Body.Close()
 	data2, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("Error reading response body: %s\n", err)
-		return
+		log.Error("failed to read callback registration response", "error", err)
+		return ""
 	}
-	fmt.Println("Response Body in register callback url :", string(data2))
+	log.Info("callback url registered", "callback_url", loggedCallBackUrl, "status", resp.Status)
+	log.Debug("callback registration response", "body", logger.RedactJSON(data2))
+	return string(data2)
 }
@@ -0,0 +1,132 @@
+package rubix_interaction
+
+import (
+	"context"
+	"crypto/sha256"
+	"dapp-server/config"
+	"dapp-server/logger"
+	"dapp-server/metrics"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// GetWasmContractPath returns a local path to a contract's wasm for the given node.
+// Local nodes and nodes with a mounted Path are read from disk, other nodes are
+// downloaded from their ArtifactURL into the artifact cache.
+func GetWasmContractPath(ctx context.Context, node config.Node, contract config.Contract) (string, error) {
+	contractDir := GetContractDir(node, contract.Hash)
+	if config.IsLocalNode(node) || dirExists(contractDir) {
+		return findWasmInDir(contractDir)
+	}
+	if node.ArtifactURL == "" {
+		return "", fmt.Errorf("node %s is remote and has neither a mounted path nor an artifact_url", node.Name)
+	}
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return "", err
+	}
+	return fetchWasmArtifact(ctx, config.GetArtifactCacheDir(cfg), node, contract)
+}
+
+func findWasmInDir(contractDir string) (string, error) {
+	entries, err := os.ReadDir(contractDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".wasm") {
+			return filepath.Join(contractDir, entry.Name()), nil
+		}
+	}
+
+	return "", fmt.Errorf("no wasm contract found in directory: %v", contractDir)
+}
+
+// fetchWasmArtifact returns a remote node's contract wasm from the artifact cache, downloading
+// it first when no good copy is cached. Downloads and cached copies are both checked against
+// the wasm digest pinned in the contract registry before they are used.
+func fetchWasmArtifact(ctx context.Context, cacheDir string, node config.Node, contract config.Contract) (string, error) {
+	if contract.WasmSHA256 == "" {
+		return "", fmt.Errorf("contract %s has no wasm_sha256 in the registry to verify artifacts from node %s against", contract.Hash, node.Name)
+	}
+	if contract.Hash == "" || filepath.Base(contract.Hash) != contract.Hash || contract.Hash == ".." {
+		return "", fmt.Errorf("contract hash %q can't name a cache file", contract.Hash)
+	}
+	if err := ensurePrivateDir(cacheDir); err != nil {
+		return "", err
+	}
+	wasmPath := filepath.Join(cacheDir, contract.Hash+".wasm")
+	if digest, err := fileSHA256(wasmPath); err == nil {
+		if strings.EqualFold(digest, contract.WasmSHA256) {
+			return wasmPath, nil
+		}
+		logger.FromContext(ctx).Warn("cached contract does not match its registry digest, downloading it again", "contract", contract.Hash, "path", wasmPath)
+	}
+
+	artifactURL := strings.ReplaceAll(node.ArtifactURL, "{hash}", contract.Hash)
+	// Artifact URLs carry the contract hash, so the metrics label them by template
+	req, err := http.NewRequestWithContext(metrics.WithEndpoint(ctx, "artifact"), http.MethodGet, artifactURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid artifact URL for node %s: %w", node.Name, err)
+	}
+	resp, err := clientForNode(node).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch contract from node %s: %w", node.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch contract from node %s: %s", node.Name, resp.Status)
+	}
+
+	tmpFile, err := os.CreateTemp(cacheDir, "download-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create contract cache file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmpFile, hash), resp.Body); err != nil {
+		tmpFile.Close()
+		return "", fmt.Errorf("failed to download contract: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return "", fmt.Errorf("failed to write contract cache file: %w", err)
+	}
+	if digest := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(digest, contract.WasmSHA256) {
+		return "", fmt.Errorf("contract %s from node %s has sha256 %s, the registry pins %s", contract.Hash, node.Name, digest, contract.WasmSHA256)
+	}
+	if err := os.Rename(tmpFile.Name(), wasmPath); err != nil {
+		return "", fmt.Errorf("failed to store contract in cache: %w", err)
+	}
+	return wasmPath, nil
+}
+
+// ensurePrivateDir creates dir for the server alone, refusing an existing directory other users can reach
+func ensurePrivateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create artifact cache: %w", err)
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read artifact cache: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("artifact cache %s is not a directory", dir)
+	}
+	// Windows doesn't report permission bits for directories
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("artifact cache %s is accessible to other users, restrict it to mode 0700", dir)
+	}
+	return nil
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,103 @@
+package rubix_interaction
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"dapp-server/config"
+)
+
+func TestFetchWasmArtifact(t *testing.T) {
+	const wasm = "contract wasm"
+	sum := sha256.Sum256([]byte(wasm))
+	digest := hex.EncodeToString(sum[:])
+
+	var downloads atomic.Int32
+	served := wasm
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		if r.URL.Path != "/contracts/QmTest" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(served))
+	}))
+	defer srv.Close()
+	node := config.Node{Name: "remote", ArtifactURL: srv.URL + "/contracts/{hash}"}
+
+	tests := []struct {
+		name          string
+		contract      config.Contract
+		served        string
+		cached        string // Written to the cache before fetching
+		cacheMode     os.FileMode
+		wantErr       string
+		wantDownloads int32
+	}{
+		{name: "download", contract: config.Contract{Hash: "QmTest", WasmSHA256: digest}, served: wasm, wantDownloads: 1},
+		{name: "download tampered with", contract: config.Contract{Hash: "QmTest", WasmSHA256: digest}, served: "other wasm", wantErr: "the registry pins", wantDownloads: 1},
+		{name: "cached copy", contract: config.Contract{Hash: "QmTest", WasmSHA256: strings.ToUpper(digest)}, cached: wasm},
+		{name: "cached copy tampered with", contract: config.Contract{Hash: "QmTest", WasmSHA256: digest}, served: wasm, cached: "other wasm", wantDownloads: 1},
+		{name: "no pinned digest", contract: config.Contract{Hash: "QmTest"}, wantErr: "has no wasm_sha256"},
+		{name: "hash naming another path", contract: config.Contract{Hash: "../QmTest", WasmSHA256: digest}, wantErr: "can't name a cache file"},
+		{name: "cache other users can read", contract: config.Contract{Hash: "QmTest", WasmSHA256: digest}, cacheMode: 0755, wantErr: "accessible to other users"},
+		{name: "node refuses", contract: config.Contract{Hash: "QmMissing", WasmSHA256: digest}, wantErr: "404 Not Found", wantDownloads: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := filepath.Join(t.TempDir(), "cache")
+			if tt.cached != "" || tt.cacheMode != 0 {
+				mode := tt.cacheMode
+				if mode == 0 {
+					mode = 0700
+				}
+				if err := os.Mkdir(cacheDir, mode); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chmod(cacheDir, mode); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.cached != "" {
+				if err := os.WriteFile(filepath.Join(cacheDir, tt.contract.Hash+".wasm"), []byte(tt.cached), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			served = tt.served
+			downloads.Store(0)
+
+			wasmPath, err := fetchWasmArtifact(context.Background(), cacheDir, node, tt.contract)
+			if got := downloads.Load(); got != tt.wantDownloads {
+				t.Errorf("fetchWasmArtifact() downloaded %d times, want %d", got, tt.wantDownloads)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("fetchWasmArtifact() error = %v, want %q", err, tt.wantErr)
+				}
+				if _, err := os.Stat(filepath.Join(cacheDir, tt.contract.Hash+".wasm")); err == nil && tt.cached == "" {
+					t.Fatal("fetchWasmArtifact() cached an artifact it refused")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := os.ReadFile(wasmPath)
+			if err != nil || string(content) != wasm {
+				t.Fatalf("cached artifact = %q, %v, want %q", content, err, wasm)
+			}
+			info, err := os.Stat(cacheDir)
+			if err != nil || info.Mode().Perm() != 0700 {
+				t.Fatalf("artifact cache mode = %v, %v, want 0700", info.Mode().Perm(), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package rubix_interaction
+
+import (
+	"bytes"
+	"context"
+	"dapp-server/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+const wasmBuildTarget = "wasm32-unknown-unknown"
+
+// cargoManifest holds the parts of Cargo.toml needed to name the build artifact
+type cargoManifest struct {
+	Package struct {
+		Name string `toml:"name"`
+	} `toml:"package"`
+	Lib struct {
+		Name string `toml:"name"`
+	} `toml:"lib"`
+}
+
+// IsContractProject reports whether path is a cargo project rather than a prebuilt wasm file
+func IsContractProject(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(path, "Cargo.toml"))
+	return err == nil
+}
+
+// How long a cancelled build's output may keep draining before cargo is abandoned
+const buildWaitDelay = 10 * time.Second
+
+// BuildContract compiles a Rust contract project to wasm and returns the path of the artifact.
+// Cargo output is streamed to buildLog as it is produced. The build is stopped when ctx ends
+// or build.timeout passes.
+func BuildContract(ctx context.Context, projectDir string, buildLog io.Writer) (string, error) {
+	if buildLog == nil {
+		buildLog = io.Discard
+	}
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return "", err
+	}
+	timeout := config.GetBuildTimeout(cfg)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	crateName, err := getCrateName(projectDir)
+	if err != nil {
+		return "", err
+	}
+	targetDir, err := getTargetDir(ctx, projectDir)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, "cargo", "build", "--target", wasmBuildTarget, "--release")
+	cmd.Dir = projectDir
+	cmd.Stdout = buildLog
+	cmd.Stderr = buildLog
+	cmd.WaitDelay = buildWaitDelay
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("cargo build timed out after %s", timeout)
+		}
+		return "", fmt.Errorf("cargo build failed: %w", err)
+	}
+
+	artifactPath := filepath.Join(targetDir, wasmBuildTarget, "release", crateName+".wasm")
+	if _, err := os.Stat(artifactPath); err != nil {
+		return "", fmt.Errorf("build artifact not found at %s: %w", artifactPath, err)
+	}
+	return artifactPath, nil
+}
+
+// getTargetDir asks cargo where the project's artifacts go, which takes CARGO_TARGET_DIR,
+// .cargo/config.toml and workspaces into account
+func getTargetDir(ctx context.Context, projectDir string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "cargo", "metadata", "--format-version", "1", "--no-deps")
+	cmd.Dir = projectDir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = buildWaitDelay
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("cargo metadata failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var metadata struct {
+		TargetDirectory string `json:"target_directory"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &metadata); err != nil {
+		return "", fmt.Errorf("failed to parse cargo metadata: %w", err)
+	}
+	if metadata.TargetDirectory == "" {
+		return "", errors.New("cargo metadata did not report a target directory")
+	}
+	return metadata.TargetDirectory, nil
+}
+
+// getCrateName reads the library name cargo uses for the wasm artifact
+func getCrateName(projectDir string) (string, error) {
+	var manifest cargoManifest
+	if _, err := toml.DecodeFile(filepath.Join(projectDir, "Cargo.toml"), &manifest); err != nil {
+		return "", fmt.Errorf("failed to read Cargo.toml: %w", err)
+	}
+	name := manifest.Lib.Name
+	if name == "" {
+		name = manifest.Package.Name
+	}
+	if name == "" {
+		return "", fmt.Errorf("Cargo.toml in %s has no package name", projectDir)
+	}
+	return strings.ReplaceAll(name, "-", "_"), nil
+}
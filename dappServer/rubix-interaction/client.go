@@ -0,0 +1,112 @@
+package rubix_interaction
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"dapp-server/config"
+	"dapp-server/logger"
+	"dapp-server/metrics"
+	"dapp-server/tracing"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+)
+
+var (
+	nodeClientsMu sync.Mutex
+	nodeClients   = make(map[string]*http.Client)
+)
+
+// Client for URLs that don't belong to any configured node
+var unconfiguredNodeClient = &http.Client{Transport: nodeTransport("unconfigured", nil)}
+
+// nodeHTTPClient returns the HTTP client for the node served on baseURL,
+// configured with that node's CA and client certificate when it has them
+func nodeHTTPClient(baseURL string) *http.Client {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return unconfiguredNodeClient
+	}
+	node, exists := config.GetNodeByURL(cfg, baseURL)
+	if !exists {
+		return unconfiguredNodeClient
+	}
+	return clientForNode(node)
+}
+
+// clientForNode builds (once) and returns the HTTP client used to talk to a node
+func clientForNode(node config.Node) *http.Client {
+	nodeClientsMu.Lock()
+	defer nodeClientsMu.Unlock()
+	if client, exists := nodeClients[node.Name]; exists {
+		return client
+	}
+
+	var transport http.RoundTripper
+	if node.CACert != "" || node.ClientCert != "" {
+		tlsConfig, err := nodeTLSConfig(node)
+		if err != nil {
+			// Fall back to the system roots, the request itself will surface the TLS failure
+			slog.Error("failed to load node TLS settings", "node", node.Name, "error", err)
+		} else {
+			transport = &http.Transport{TLSClientConfig: tlsConfig}
+		}
+	}
+	client := &http.Client{Transport: nodeTransport(node.Name, transport)}
+	nodeClients[node.Name] = client
+	return client
+}
+
+// ResetNodeClients drops the cached node clients so the next request picks up reloaded TLS settings
+func ResetNodeClients() {
+	nodeClientsMu.Lock()
+	defer nodeClientsMu.Unlock()
+	nodeClients = make(map[string]*http.Client)
+}
+
+// nodeTransport wraps the transport for a node with metrics, a client span and request ID forwarding
+func nodeTransport(nodeName string, transport http.RoundTripper) http.RoundTripper {
+	return metrics.InstrumentNodeTransport(nodeName, tracing.NodeTransport(nodeName, requestIDTransport{transport}))
+}
+
+func nodeTLSConfig(node config.Node) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if node.CACert != "" {
+		caPEM, err := os.ReadFile(node.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", node.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if node.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(node.ClientCert, node.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// requestIDTransport forwards the request ID of the originating dapp request to the node
+type requestIDTransport struct {
+	next http.RoundTripper
+}
+
+func (t requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if requestID := logger.RequestID(req.Context()); requestID != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(logger.RequestIDHeader, requestID)
+	}
+	return next.RoundTrip(req)
+}
@@ -2,7 +2,9 @@ package rubix_interaction
 
 import (
 	"bytes"
+	"context"
 	"dapp-server/config"
+	"dapp-server/tracing"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,36 +13,54 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
-)
 
-const CONFIG_PATH = ".config/config.toml"
+	"go.opentelemetry.io/otel/attribute"
+)
 
-// Deploy handles the contract deployment process
-func Deploy(wasmPath string, libPath string, deployerDid string, statePath string, nodeName string) (*DeploymentResult, error) {
-	// Load config to get API URL
-	cfg, err := config.GetConfig()
-	if err != nil {
-		return nil, fmt.Errorf("failed to load config: %w", err)
-	}
-	node := cfg.Nodes[nodeName]
-	url := fmt.Sprintf("http://localhost:%s", node.Port)
-	contractHash, err := generateSmartContract(url, deployerDid, wasmPath, libPath, statePath)
+// Deploy handles the contract deployment process.
+// source is either a prebuilt .wasm file or a cargo project directory, which is built first.
+// When building from source an empty libPath defaults to the project's src/lib.rs.
+func Deploy(ctx context.Context, source string, libPath string, deployerDid string, statePath string, node config.Node, hooks DeployHooks) (*DeploymentResult, error) {
+	url := config.GetNodeURL(node)
+
+	wasmPath := source
+	var err error
+	if IsContractProject(source) {
+		hooks.stage(StageBuild)
+		wasmPath, err = BuildContract(ctx, source, hooks.BuildLog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build contract: %w", err)
+		}
+		if libPath == "" {
+			libPath = filepath.Join(source, "src", "lib.rs")
+		}
+	}
+
+	hooks.stage(StageGenerate)
+	contractHash, err := generateSmartContract(ctx, url, deployerDid, wasmPath, libPath, statePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate smart contract: %w", err)
 	}
+	hooks.nodeResponse("/api/generate-smart-contract", contractHash)
 
-	requestID, err := deploySmartContract(url, contractHash, deployerDid)
+	hooks.stage(StageDeploy)
+	requestID, err := deploySmartContract(ctx, url, contractHash, deployerDid)
 	if err != nil {
 		return nil, fmt.Errorf("failed to deploy smart contract: %w", err)
 	}
+	hooks.nodeResponse("/api/deploy-smart-contract", requestID)
 
 	// Call signature-response API
-	err2 := SignatureResponse(url, requestID)
+	hooks.stage(StageSign)
+	err2 := SignatureResponse(ctx, url, requestID)
 	if err2 != nil {
-		return nil, fmt.Errorf("failed to process signature response: %w", err)
+		return nil, fmt.Errorf("failed to process signature response: %w", err2)
 	}
-	// RegisterCallBackUrl(contractHash, "8080", "api/call-back-trigger", "20002")
-	RegisterCallBackUrl(contractHash, "8080", "api/trigger-contract-2", "20003") //This call back url and port should be accepted as a param
+	hooks.nodeResponse("/api/signature-response", "signed")
+
+	hooks.stage(StageRegisterCallback)
+	callbackResponse := RegisterCallBackUrl(ctx, contractHash, node)
+	hooks.nodeResponse("/api/register-callback-url", callbackResponse)
 	return &DeploymentResult{
 		ContractHash: contractHash,
 		Success:      true,
@@ -48,7 +68,7 @@ func Deploy(wasmPath string, libPath string, deployerDid string, statePath strin
 	}, nil
 }
 
-func generateSmartContract(baseURL, deployerDid, wasmPath, libPath, statePath string) (string, error) {
+func generateSmartContract(ctx context.Context, baseURL, deployerDid, wasmPath, libPath, statePath string) (string, error) {
 	// Create a buffer to store the multipart form data
 	var requestBody bytes.Buffer
 	writer := multipart.NewWriter(&requestBody)
@@ -107,7 +127,7 @@ func generateSmartContract(baseURL, deployerDid, wasmPath, libPath, statePath st
 
 	// Create the request
 	url := fmt.Sprintf("%s/api/generate-smart-contract", baseURL)
-	req, err := http.NewRequest("POST", url, &requestBody)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, &requestBody)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -117,7 +137,7 @@ func generateSmartContract(baseURL, deployerDid, wasmPath, libPath, statePath st
 	req.Header.Set("Accept", "multipart/form-data")
 
 	// Send the request
-	client := &http.Client{}
+	client := nodeHTTPClient(baseURL)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %w", err)
@@ -144,7 +164,7 @@ func generateSmartContract(baseURL, deployerDid, wasmPath, libPath, statePath st
 	return apiResp.Result, nil
 }
 
-func deploySmartContract(baseURL, contractHash, deployerDid string) (string, error) {
+func deploySmartContract(ctx context.Context, baseURL, contractHash, deployerDid string) (string, error) {
 	// Create request body
 	requestBody := struct {
 		Comment            string  `json:"comment"`
@@ -172,7 +192,7 @@ func deploySmartContract(baseURL, contractHash, deployerDid string) (string, err
 		return "", fmt.Errorf("deploy: unable to form request URL")
 	}
 
-	req, err := http.NewRequest("POST", requestURL, bytes.NewBuffer(bodyBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", requestURL, bytes.NewBuffer(bodyBytes))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -181,7 +201,7 @@ func deploySmartContract(baseURL, contractHash, deployerDid string) (string, err
 	req.Header.Set("Content-Type", "application/json")
 
 	// Send request
-	client := &http.Client{}
+	client := nodeHTTPClient(baseURL)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %w", err)
@@ -208,7 +228,10 @@ func deploySmartContract(baseURL, contractHash, deployerDid string) (string, err
 	return apiResp.Result.Id, nil
 }
 
-func SignatureResponse(baseURL, requestID string) error {
+func SignatureResponse(ctx context.Context, baseURL, requestID string) (err error) {
+	ctx, span := tracing.Start(ctx, "rubix.SignatureResponse", attribute.String("rubix.request_id", requestID))
+	defer func() { tracing.End(span, err) }()
+
 	// Create request body
 	requestBody := struct {
 		Id       string `json:"id"`
@@ -232,7 +255,7 @@ func SignatureResponse(baseURL, requestID string) error {
 		return fmt.Errorf("signature response: unable to form request URL")
 	}
 
-	req, err := http.NewRequest("POST", requestURL, bytes.NewBuffer(bodyBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", requestURL, bytes.NewBuffer(bodyBytes))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -241,7 +264,7 @@ func SignatureResponse(baseURL, requestID string) error {
 	req.Header.Set("Content-Type", "application/json")
 
 	// Send request
-	client := &http.Client{}
+	client := nodeHTTPClient(baseURL)
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("signature request: failed to send request: %w", err)
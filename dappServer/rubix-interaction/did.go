@@ -2,6 +2,7 @@ package rubix_interaction
 
 import (
 	"bytes"
+	"context"
 	// "dapp-server/config"
 	"encoding/json"
 	"fmt"
@@ -121,7 +122,7 @@ type registerDidResponse struct {
 // 	return response.Result.DID, nil
 // }
 
-func registerDID(baseURL string, did string) error {
+func registerDID(ctx context.Context, baseURL string, did string) error {
 	requestURL, err := url.JoinPath(baseURL, "/api/register-did")
 	if err != nil {
 		return fmt.Errorf("failed to join URL: %v", err)
@@ -136,14 +137,14 @@ func registerDID(baseURL string, did string) error {
 		return fmt.Errorf("failed to marshal JSON: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", requestURL, bytes.NewBuffer(requestBodyBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", requestURL, bytes.NewBuffer(requestBodyBytes))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
+	client := nodeHTTPClient(baseURL)
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to perform request: %v", err)
@@ -170,7 +171,7 @@ func registerDID(baseURL string, did string) error {
 
 	requestId := registerDidResp.Result.Id
 
-	if err = SignatureResponse(baseURL, requestId); err != nil {
+	if err = SignatureResponse(ctx, baseURL, requestId); err != nil {
 		return fmt.Errorf("failed to send signature response: %v", err)
 	}
 
@@ -2,7 +2,9 @@ package rubix_interaction
 
 import (
 	"bytes"
+	"context"
 	"dapp-server/config"
+	"dapp-server/logger"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,41 +15,36 @@ import (
 	"strings"
 )
 
-// Execute handles the contract execution process
+// Execute handles the contract execution process. When the node accepted the execution but
+// the signature response failed, the result carrying the Rubix request ID is returned with the error.
 func Execute(
+	ctx context.Context,
 	contractHash string, executorDid string,
-	contractInput string, nodeName string,
+	contractInput string, node config.Node,
 ) (*ExecutionResult, error) {
-	// Load config to get API URL
-	cfg, err := config.GetConfig()
-	if err != nil {
-		return nil, fmt.Errorf("failed to load config: %w", err)
-	}
-	port, exists := config.GetPortByNodeName(cfg, nodeName)
-	if !exists {
-		fmt.Println("failed to find the node in config")
-	}
-	fmt.Println("port :", port)
-	url := fmt.Sprintf("http://localhost:%s", port)
-	fmt.Println("The url is :", url)
-	requestID, err := ExecuteSmartContract(url, contractHash, executorDid, contractInput)
+	url := config.GetNodeURL(node)
+	logger.FromContext(ctx).Debug("executing contract", "contract", contractHash, "node_url", url)
+	requestID, err := ExecuteSmartContract(ctx, url, contractHash, executorDid, contractInput)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute smart contract: %w", err)
 	}
 
 	// Call signature-response API
-	if err := SignatureResponse(url, requestID); err != nil {
-		return nil, fmt.Errorf("failed to process signature response: %w", err)
+	if err := SignatureResponse(ctx, url, requestID); err != nil {
+		return &ExecutionResult{
+			ContractResult: requestID,
+			Message:        "Contract execution is unconfirmed",
+		}, fmt.Errorf("failed to process signature response: %w", err)
 	}
 
 	return &ExecutionResult{
-		ContractResult: "contractResult",
+		ContractResult: requestID,
 		Success:        true,
 		Message:        "Contract executed successfully",
 	}, nil
 }
 
-func ExecuteSmartContract(baseURL, contractHash, executorDid, contractMsg string) (string, error) {
+func ExecuteSmartContract(ctx context.Context, baseURL, contractHash, executorDid, contractMsg string) (string, error) {
 	// Create request body
 	requestBody := struct {
 		Comment            string `json:"comment"`
@@ -75,7 +72,7 @@ func ExecuteSmartContract(baseURL, contractHash, executorDid, contractMsg string
 		return "", fmt.Errorf("execute: unable to form request URL")
 	}
 
-	req, err := http.NewRequest("POST", requestURL, bytes.NewBuffer(bodyBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", requestURL, bytes.NewBuffer(bodyBytes))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -84,7 +81,7 @@ func ExecuteSmartContract(baseURL, contractHash, executorDid, contractMsg string
 	req.Header.Set("Content-Type", "application/json")
 
 	// Send request
-	client := &http.Client{}
+	client := nodeHTTPClient(baseURL)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %w", err)
@@ -111,7 +108,7 @@ func ExecuteSmartContract(baseURL, contractHash, executorDid, contractMsg string
 	return apiResp.Result.Id, nil
 }
 
-func getSmartContractChainBlocks(baseURL string, contractHash string, onlyLatest bool) ([]*SmartContractBlock, error) {
+func getSmartContractChainBlocks(ctx context.Context, baseURL string, contractHash string, onlyLatest bool) ([]*SmartContractBlock, error) {
 	// Create request body
 	requestBody := struct {
 		Latest bool   `json:"latest"`
@@ -133,7 +130,7 @@ func getSmartContractChainBlocks(baseURL string, contractHash string, onlyLatest
 		return nil, fmt.Errorf("execute: unable to form request URL")
 	}
 
-	req, err := http.NewRequest("POST", requestURL, bytes.NewBuffer(bodyBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", requestURL, bytes.NewBuffer(bodyBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -142,7 +139,7 @@ func getSmartContractChainBlocks(baseURL string, contractHash string, onlyLatest
 	req.Header.Set("Content-Type", "application/json")
 
 	// Send request
-	client := &http.Client{}
+	client := nodeHTTPClient(baseURL)
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
@@ -179,7 +176,6 @@ func getSmartContractChainBlocks(baseURL string, contractHash string, onlyLatest
 
 func getWasmContractPath(contractHash string) (string, error) {
 	currentWorkingDir, err := os.Getwd()
-	fmt.Println("The current working Directory is : ", currentWorkingDir)
 	if err != nil {
 		return "", fmt.Errorf("failed to get current working directory: %w", err)
 	}
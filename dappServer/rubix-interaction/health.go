@@ -0,0 +1,295 @@
+package rubix_interaction
+
+import (
+	"context"
+	"dapp-server/config"
+	"dapp-server/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Endpoint probed to decide whether a node is up
+const nodeProbeEndpoint = "/api/node-status"
+
+const nodeProbeTimeout = 5 * time.Second
+
+// NodeHealth is the last observed state of a configured node
+type NodeHealth struct {
+	Name                string    `json:"name"`
+	URL                 string    `json:"url"`
+	Healthy             bool      `json:"healthy"`
+	LatencyMs           float64   `json:"latency_ms"`
+	LastCheck           time.Time `json:"last_check"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
+
+// NodeMonitor periodically probes every configured node and tracks its health
+type NodeMonitor struct {
+	mu              sync.RWMutex
+	health          map[string]NodeHealth
+	interval        time.Duration
+	intervalChanges chan time.Duration // Hands SetInterval changes to Start
+}
+
+func NewNodeMonitor(interval time.Duration) *NodeMonitor {
+	return &NodeMonitor{
+		health:          make(map[string]NodeHealth),
+		interval:        interval,
+		intervalChanges: make(chan time.Duration, 1),
+	}
+}
+
+// Start probes all nodes immediately and then on every interval until ctx is cancelled
+func (m *NodeMonitor) Start(ctx context.Context) {
+	current := m.interval
+	ticker := time.NewTicker(current)
+	defer ticker.Stop()
+	m.ProbeAll()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case interval := <-m.intervalChanges:
+			if interval != current {
+				current = interval
+				ticker.Reset(current)
+			}
+		case <-ticker.C:
+			m.ProbeAll()
+		}
+	}
+}
+
+// SetInterval changes how often Start probes, counting from now when it differs from the current one
+func (m *NodeMonitor) SetInterval(interval time.Duration) {
+	for {
+		select {
+		case m.intervalChanges <- interval:
+			return
+		default:
+			// Replace a change Start hasn't picked up yet
+			select {
+			case <-m.intervalChanges:
+			default:
+			}
+		}
+	}
+}
+
+// ProbeAll checks every node in the current config concurrently
+func (m *NodeMonitor) ProbeAll() {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return
+	}
+	m.prune(cfg)
+	var wg sync.WaitGroup
+	for _, node := range cfg.Nodes {
+		wg.Add(1)
+		go func(node config.Node) {
+			defer wg.Done()
+			m.record(node, probeNode(node))
+		}(node)
+	}
+	wg.Wait()
+}
+
+func probeNode(node config.Node) NodeHealth {
+	health := NodeHealth{Name: node.Name, URL: config.GetNodeURL(node), LastCheck: time.Now()}
+	ctx, cancel := context.WithTimeout(context.Background(), nodeProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", health.URL+nodeProbeEndpoint, nil)
+	if err != nil {
+		health.LastError = err.Error()
+		return health
+	}
+	start := time.Now()
+	resp, err := clientForNode(node).Do(req)
+	health.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		health.LastError = err.Error()
+		slog.Warn("node probe failed", "node", node.Name, "error", err)
+		return health
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		health.LastError = resp.Status
+		slog.Warn("node probe failed", "node", node.Name, "status", resp.Status)
+		return health
+	}
+	health.Healthy = true
+	return health
+}
+
+func (m *NodeMonitor) record(node config.Node, health NodeHealth) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !health.Healthy {
+		health.ConsecutiveFailures = m.health[node.Name].ConsecutiveFailures + 1
+	}
+	m.health[node.Name] = health
+}
+
+// prune forgets nodes that were removed from the config by a reload
+func (m *NodeMonitor) prune(cfg *config.Config) {
+	configured := make(map[string]bool, len(cfg.Nodes))
+	for _, node := range cfg.Nodes {
+		configured[node.Name] = true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name := range m.health {
+		if !configured[name] {
+			delete(m.health, name)
+		}
+	}
+}
+
+// Status returns the health of every probed node, sorted by name
+func (m *NodeMonitor) Status() []NodeHealth {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status := make([]NodeHealth, 0, len(m.health))
+	for _, health := range m.health {
+		status = append(status, health)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Name < status[j].Name })
+	return status
+}
+
+// IsHealthy reports whether a node passed its last probe. Nodes not probed yet count as healthy.
+func (m *NodeMonitor) IsHealthy(nodeName string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	health, exists := m.health[nodeName]
+	return !exists || health.Healthy
+}
+
+// HealthyCount returns how many nodes passed their last probe
+func (m *NodeMonitor) HealthyCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	count := 0
+	for _, health := range m.health {
+		if health.Healthy {
+			count++
+		}
+	}
+	return count
+}
+
+// readCandidates lists node URLs to try for a read-only call: the preferred node if it is
+// healthy, then every other healthy node hosting the contract.
+// Only local nodes can be checked for the contract, remote ones are tried and left to report errors.
+func (m *NodeMonitor) readCandidates(preferredURL string, contractHash string) []string {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return []string{preferredURL}
+	}
+	var candidates []string
+	preferred, exists := config.GetNodeByURL(cfg, preferredURL)
+	if !exists || m.IsHealthy(preferred.Name) {
+		candidates = append(candidates, preferredURL)
+	}
+
+	names := make([]string, 0, len(cfg.Nodes))
+	for name := range cfg.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		node := cfg.Nodes[name]
+		nodeURL := config.GetNodeURL(node)
+		if nodeURL == preferredURL || !m.IsHealthy(node.Name) {
+			continue
+		}
+		if config.IsLocalNode(node) && !dirExists(GetContractDir(node, contractHash)) {
+			continue
+		}
+		candidates = append(candidates, nodeURL)
+	}
+	if len(candidates) == 0 {
+		// Nothing looks healthy, let the preferred node report its own error
+		candidates = append(candidates, preferredURL)
+	}
+	return candidates
+}
+
+// GetSmartContractData fetches the contract token chain from the preferred node, failing over
+// to another healthy node hosting the contract. It is for plain reads only: another node may lag
+// behind the preferred one, so callbacks acting on the latest block read from their sender instead.
+func (m *NodeMonitor) GetSmartContractData(ctx context.Context, token string, preferredURL string) []byte {
+	for _, nodeURL := range m.readCandidates(preferredURL, token) {
+		if data := GetSmartContractData(ctx, token, nodeURL); data != nil {
+			return data
+		}
+		logger.FromContext(ctx).Warn("token chain fetch failed, trying next node", "node_url", nodeURL, "contract", token)
+	}
+	return nil
+}
+
+// ErrDIDNotHosted is returned for balance queries about a DID no configured node hosts
+var ErrDIDNotHosted = errors.New("no configured node hosts the DID")
+
+// GetFTBalance fetches the fungible token balances of a DID from the node the directory lists as
+// hosting it. Nodes not hosting a wallet can't vouch for its balance, so there is no failover to them.
+func (m *NodeMonitor) GetFTBalance(ctx context.Context, did string) (json.RawMessage, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	node, exists := config.GetNodeByDid(cfg, did)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrDIDNotHosted, did)
+	}
+	if !m.IsHealthy(node.Name) {
+		logger.FromContext(ctx).Warn("node hosting the wallet failed its last probe", "node", node.Name, "did", did)
+	}
+	return GetFTBalance(ctx, config.GetNodeURL(node), did)
+}
+
+// GetFTBalance queries a node for the fungible tokens held by a DID
+func GetFTBalance(ctx context.Context, baseURL string, did string) (json.RawMessage, error) {
+	requestURL, err := url.JoinPath(baseURL, "/api/get-ft-info-by-did")
+	if err != nil {
+		return nil, fmt.Errorf("balance: unable to form request URL")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", requestURL+"?did="+url.QueryEscape(did), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	client := nodeHTTPClient(baseURL)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	var apiResp struct {
+		Status  bool   `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if !apiResp.Status {
+		return nil, fmt.Errorf("%s", apiResp.Message)
+	}
+	return body, nil
+}
@@ -4,21 +4,35 @@ import (
 	"dapp-server/config"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"sync"
+
+	"dapp-server/wasmhost"
 
 	"github.com/bytecodealliance/wasmtime-go"
-	wasmContext "github.com/rubixchain/rubix-wasm/go-wasm-bridge/context"
-	"github.com/rubixchain/rubix-wasm/go-wasm-bridge/host"
-	"github.com/rubixchain/rubix-wasm/go-wasm-bridge/utils"
 )
 
+// activityStoreMu serialises updates to the activity file so concurrent contract
+// calls don't lose each other's writes, and lets shutdown wait for the last one
+var activityStoreMu sync.Mutex
+
 type WriteToJsonFile struct {
-	allocFunc *wasmtime.Func
-	memory    *wasmtime.Memory
+	allocFunc    *wasmtime.Func
+	memory       *wasmtime.Memory
+	contractHash string
+	allowedPaths []string
+	log          *slog.Logger
 }
 
-func NewWriteToJsonFile() *WriteToJsonFile {
-	return &WriteToJsonFile{}
+// NewWriteToJsonFile creates the host function for a contract, restricted to the given file paths.
+// Activities go to the store of the branch owning the contract.
+func NewWriteToJsonFile(contractHash string, allowedPaths []string, log *slog.Logger) *WriteToJsonFile {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &WriteToJsonFile{contractHash: contractHash, allowedPaths: allowedPaths, log: log}
 }
 
 func (h *WriteToJsonFile) Name() string {
@@ -37,12 +51,12 @@ func (h *WriteToJsonFile) FuncType() *wasmtime.FuncType {
 	)
 }
 
-func (h *WriteToJsonFile) Initialize(allocFunc, deallocFunc *wasmtime.Func, memory *wasmtime.Memory, nodeAddress string, quorumType int, wasmCtx *wasmContext.WasmContext) {
+func (h *WriteToJsonFile) Initialize(allocFunc, deallocFunc *wasmtime.Func, memory *wasmtime.Memory) {
 	h.allocFunc = allocFunc
 	h.memory = memory
 }
 
-func (h *WriteToJsonFile) Callback() host.HostFunctionCallBack {
+func (h *WriteToJsonFile) Callback() wasmhost.Callback {
 	return h.callback
 }
 
@@ -51,21 +65,18 @@ func (h *WriteToJsonFile) callback(
 	args []wasmtime.Val,
 ) ([]wasmtime.Val, *wasmtime.Trap) {
 	// Extract input arguments
-	inputArgs, outputArgs := utils.HostFunctionParamExtraction(args, true, true)
-
-	// Extract data and file path from WASM memory
-	dataBytes, memory, err := utils.ExtractDataFromWASM(caller, inputArgs) // Extract data
+	params, err := wasmhost.ParseParams(args)
 	if err != nil {
-		fmt.Println("Failed to extract data from WASM", err)
-		return utils.HandleError(err.Error())
+		h.log.Error("invalid host function call", "error", err)
+		return wasmhost.Fail()
 	}
 
-	// filePathBytes, _, err := utils.ExtractDataFromWASM(caller, inputArgs) // Extract file path
-	// if err != nil {
-	// 	fmt.Println("Failed to extract file path from WASM", err)
-	// 	return utils.HandleError(err.Error())
-	// }
-	h.memory = memory
+	// Extract data from WASM memory
+	dataBytes, err := wasmhost.ReadInput(caller, h.memory, params)
+	if err != nil {
+		h.log.Error("failed to extract data from WASM", "error", err)
+		return wasmhost.Fail()
+	}
 
 	// data := string(dataBytes)
 	// filePath := string(filePathBytes)
@@ -73,24 +84,35 @@ func (h *WriteToJsonFile) callback(
 	// Parse the data into JSON (if necessary) and write it to a file
 	var jsonData interface{}
 	if err := json.Unmarshal(dataBytes, &jsonData); err != nil {
-		fmt.Printf("Failed to parse JSON data: %v\n", err)
-		return utils.HandleError("Invalid JSON data")
+		h.log.Error("failed to parse JSON data from contract", "error", err)
+		return wasmhost.Fail()
 	}
 
 	// filePath := "C:/Users/allen/Working-repo/ymca/ymca-wellness-cafe-project/dappServer/test.json"
-	filePath := config.GetEnvConfig().ActivityUpdatePath
+	cfg, err := config.GetConfig()
+	if err != nil {
+		h.log.Error("failed to load config", "error", err)
+		return wasmhost.Fail()
+	}
+	filePath := config.GetActivityStorePath(cfg, h.contractHash)
+	if !h.isPathAllowed(filePath) {
+		h.log.Warn("contract is not approved to write to file", "path", filePath)
+		return wasmhost.Fail()
+	}
+	activityStoreMu.Lock()
+	defer activityStoreMu.Unlock()
 	// Step 1: Read the existing file content
 	existingContent, err := os.ReadFile(filePath)
 	if err != nil && !os.IsNotExist(err) { // Ignore error if file doesn't exist
-		fmt.Printf("Failed to read existing file: %v\n", err)
-		return utils.HandleError(err.Error())
+		h.log.Error("failed to read existing activity file", "path", filePath, "error", err)
+		return wasmhost.Fail()
 	}
 
 	var existingData []interface{}
 	if len(existingContent) > 0 {
 		if err := json.Unmarshal(existingContent, &existingData); err != nil {
-			fmt.Printf("Failed to parse existing JSON data: %v\n", err)
-			return utils.HandleError("Invalid existing JSON data")
+			h.log.Error("failed to parse existing activity file", "path", filePath, "error", err)
+			return wasmhost.Fail()
 		}
 	} else {
 		existingData = []interface{}{}
@@ -109,16 +131,65 @@ func (h *WriteToJsonFile) callback(
 	encoder := json.NewEncoder(file)
 	encoder.SetIndent("", "  ") // Pretty-print JSON
 	if err := encoder.Encode(existingData); err != nil {
-		fmt.Printf("Failed to write JSON data to file: %v\n", err)
-		return utils.HandleError(err.Error())
+		h.log.Error("failed to write activity file", "path", filePath, "error", err)
+		return wasmhost.Fail()
 	}
 	response := fmt.Sprintf("Succesfully wrote data to DB")
-	err = utils.UpdateDataToWASM(caller, h.allocFunc, response, outputArgs)
+	err = wasmhost.WriteOutput(caller, h.allocFunc, h.memory, params, response)
+	if err != nil {
+		h.log.Error("failed to update data to WASM", "error", err)
+		return wasmhost.Fail()
+	}
+
+	h.log.Info("activity written to file", "path", filePath)
+	return wasmhost.Ok() // Return success
+}
+
+// isPathAllowed reports whether filePath is one of the paths granted to the contract
+func (h *WriteToJsonFile) isPathAllowed(filePath string) bool {
+	target, err := filepath.Abs(filePath)
 	if err != nil {
-		fmt.Println("Failed to update data to WASM", err)
-		return utils.HandleError(err.Error())
+		return false
 	}
+	for _, allowed := range h.allowedPaths {
+		allowedAbs, err := filepath.Abs(allowed)
+		if err != nil {
+			continue
+		}
+		if allowedAbs == target {
+			return true
+		}
+	}
+	return false
+}
 
-	fmt.Printf("Successfully wrote data to JSON file: %s\n", filePath)
-	return utils.HandleOk() // Return success
+// FlushActivityStore waits for any write to an activity file in progress and syncs every branch's store to disk
+func FlushActivityStore() error {
+	activityStoreMu.Lock()
+	defer activityStoreMu.Unlock()
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil
+	}
+	for _, filePath := range config.GetActivityStorePaths(cfg) {
+		if err := syncFile(filePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func syncFile(filePath string) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY, 0644)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open activity file: %w", err)
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync activity file: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,127 @@
+package rubix_interaction
+
+import (
+	"context"
+	"dapp-server/config"
+	"dapp-server/logger"
+	"dapp-server/metrics"
+	"dapp-server/tracing"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"dapp-server/wasmhost"
+
+	"github.com/bytecodealliance/wasmtime-go"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// hostFunctionFactories builds the host functions implemented by the dapp server.
+// A contract granted a host function missing here can't be loaded.
+var hostFunctionFactories = map[string]func(contract config.Contract, grant config.HostFunctionGrant, log *slog.Logger) wasmhost.HostFunction{
+	"write_to_json_file": func(contract config.Contract, grant config.HostFunctionGrant, log *slog.Logger) wasmhost.HostFunction {
+		return NewWriteToJsonFile(contract.Hash, grant.Paths, log)
+	},
+}
+
+// NewHostFunctionRegistry builds the host function registry declared by a contract registry entry
+func NewHostFunctionRegistry(ctx context.Context, contract config.Contract) (*wasmhost.Registry, error) {
+	log := logger.FromContext(ctx).With("contract", contract.Hash)
+	registry := wasmhost.NewRegistry()
+	for _, grant := range contract.HostFunctions {
+		factory, exists := hostFunctionFactories[grant.Name]
+		if !exists {
+			return nil, fmt.Errorf("host function %s is allowlisted but not implemented", grant.Name)
+		}
+		registry.Register(factory(contract, grant, log))
+	}
+	return registry, nil
+}
+
+// LoadWasmModule instantiates a contract's wasm module with only the host functions
+// approved in its registry entry. Modules importing anything else are refused.
+func LoadWasmModule(ctx context.Context, wasmPath string, contract config.Contract) (*wasmhost.Contract, error) {
+	return loadWasmModule(ctx, wasmPath, contract, func(importTypes map[string]*wasmtime.FuncType) (*wasmhost.Registry, error) {
+		for _, name := range hostFunctionNames(importTypes) {
+			if _, allowed := config.GetHostFunctionGrant(contract, name); !allowed {
+				logger.FromContext(ctx).Warn("refusing contract with unapproved host function import", "contract", contract.Hash, "host_function", name)
+				return nil, fmt.Errorf("contract %s imports unapproved host function %s", contract.Hash, name)
+			}
+		}
+		return NewHostFunctionRegistry(ctx, contract)
+	})
+}
+
+// loadWasmModule instantiates a wasm module against the registry newRegistry builds for its imports
+func loadWasmModule(ctx context.Context, wasmPath string, contract config.Contract, newRegistry func(importTypes map[string]*wasmtime.FuncType) (*wasmhost.Registry, error)) (wasmModule *wasmhost.Contract, err error) {
+	_, span := tracing.Start(ctx, "wasm.LoadModule",
+		attribute.String("contract.hash", contract.Hash),
+		attribute.String("wasm.path", wasmPath),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	importTypes, err := getHostFunctionImportTypes(wasmPath)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := newRegistry(importTypes)
+	if err != nil {
+		return nil, err
+	}
+	wasmModule, err = wasmhost.Load(wasmPath, registry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize WASM module: %w", err)
+	}
+	return wasmModule, nil
+}
+
+// CallWasmFunction runs a contract function, traced and recorded in the wasm execution metrics
+func CallWasmFunction(ctx context.Context, wasmModule *wasmhost.Contract, contractHash string, contractInput string) (contractResult string, err error) {
+	_, span := tracing.Start(ctx, "wasm.CallFunction", attribute.String("contract.hash", contractHash))
+	start := time.Now()
+	contractResult, err = wasmModule.Call(contractInput)
+	metrics.ObserveWasmExecution(contractHash, time.Since(start), err)
+	tracing.End(span, err)
+	logger.FromContext(ctx).Debug("contract function called", "contract", contractHash, "duration", time.Since(start), "error", err)
+	return contractResult, err
+}
+
+// GetHostFunctionImports lists the host functions a wasm module imports
+func GetHostFunctionImports(wasmPath string) ([]string, error) {
+	importTypes, err := getHostFunctionImportTypes(wasmPath)
+	if err != nil {
+		return nil, err
+	}
+	return hostFunctionNames(importTypes), nil
+}
+
+func hostFunctionNames(importTypes map[string]*wasmtime.FuncType) []string {
+	names := make([]string, 0, len(importTypes))
+	for name := range importTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getHostFunctionImportTypes maps each host function a wasm module imports to its signature
+func getHostFunctionImportTypes(wasmPath string) (map[string]*wasmtime.FuncType, error) {
+	module, err := wasmtime.NewModuleFromFile(wasmtime.NewEngine(), wasmPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile wasm module: %w", err)
+	}
+
+	importTypes := make(map[string]*wasmtime.FuncType)
+	for _, imp := range module.Imports() {
+		if imp.Module() != wasmhost.ImportModule || imp.Name() == nil {
+			continue
+		}
+		funcType := imp.Type().FuncType()
+		if funcType == nil {
+			continue
+		}
+		importTypes[*imp.Name()] = funcType
+	}
+	return importTypes, nil
+}
@@ -0,0 +1,102 @@
+package rubix_interaction
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"dapp-server/config"
+
+	"github.com/bytecodealliance/wasmtime-go"
+)
+
+// writeWasm compiles a text format module into a temporary wasm file
+func writeWasm(t *testing.T, wat string) string {
+	t.Helper()
+	wasm, err := wasmtime.Wat2Wasm(wat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "contract.wasm")
+	if err := os.WriteFile(path, wasm, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// contractImporting builds a contract exporting alloc and memory that imports the named host functions
+func contractImporting(names ...string) string {
+	var imports strings.Builder
+	for _, name := range names {
+		imports.WriteString(`(import "env" "` + name + `" (func (param i32 i32 i32 i32) (result i32)))`)
+	}
+	return `(module ` + imports.String() + `
+  (memory (export "memory") 1)
+  (func (export "alloc") (param i32) (result i32) (i32.const 1024))
+  (func (export "dealloc") (param i32 i32)))`
+}
+
+func TestLoadWasmModuleAllowlist(t *testing.T) {
+	writeGrant := config.HostFunctionGrant{Name: "write_to_json_file", Paths: []string{"activities.json"}}
+	tests := []struct {
+		name    string
+		imports []string
+		grants  []config.HostFunctionGrant
+		wantErr string
+	}{
+		{name: "no imports", imports: nil},
+		{name: "approved import", imports: []string{"write_to_json_file"}, grants: []config.HostFunctionGrant{writeGrant}},
+		{name: "unapproved import", imports: []string{"write_to_json_file"}, wantErr: "imports unapproved host function write_to_json_file"},
+		{
+			name:    "one of two imports unapproved",
+			imports: []string{"write_to_json_file", "do_transfer_ft"},
+			grants:  []config.HostFunctionGrant{writeGrant},
+			wantErr: "imports unapproved host function do_transfer_ft",
+		},
+		{
+			name:    "approved but not implemented",
+			imports: []string{"do_transfer_ft"},
+			grants:  []config.HostFunctionGrant{{Name: "do_transfer_ft"}},
+			wantErr: "host function do_transfer_ft is allowlisted but not implemented",
+		},
+		{
+			name:    "unimplemented grant the contract doesn't import",
+			grants:  []config.HostFunctionGrant{{Name: "do_mint_ft"}},
+			wantErr: "host function do_mint_ft is allowlisted but not implemented",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wasmPath := writeWasm(t, contractImporting(tt.imports...))
+			contract := config.Contract{Hash: "QmTest", HostFunctions: tt.grants}
+			module, err := LoadWasmModule(context.Background(), wasmPath, contract)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadWasmModule() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || module == nil {
+				t.Fatalf("LoadWasmModule() = %v, %v", module, err)
+			}
+		})
+	}
+}
+
+func TestGetHostFunctionImports(t *testing.T) {
+	wasmPath := writeWasm(t, `(module
+  (import "env" "write_to_json_file" (func (param i32 i32 i32 i32) (result i32)))
+  (import "env" "do_transfer_ft" (func (param i32 i32 i32 i32) (result i32)))
+  (import "wasi" "clock" (func (result i64)))
+  (import "env" "limit" (global i32)))`)
+	names, err := GetHostFunctionImports(wasmPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"do_transfer_ft", "write_to_json_file"}; !slices.Equal(names, want) {
+		t.Fatalf("GetHostFunctionImports() = %v, want %v", names, want)
+	}
+}
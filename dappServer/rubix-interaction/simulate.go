@@ -0,0 +1,184 @@
+package rubix_interaction
+
+import (
+	"context"
+	"dapp-server/config"
+	"dapp-server/logger"
+	"fmt"
+	"strings"
+	"sync"
+
+	"dapp-server/wasmhost"
+
+	"github.com/bytecodealliance/wasmtime-go"
+)
+
+// Response handed back to a contract in place of the real host function result
+const simulatedHostResponse = `{"status":true,"message":"simulated"}`
+
+// SideEffect is a host function call a contract attempted during a simulation
+type SideEffect struct {
+	HostFunction string `json:"host_function"`
+	Input        string `json:"input"`
+	Approved     bool   `json:"approved"`
+}
+
+// SimulationResult is the outcome of a contract call that never left the dapp server
+type SimulationResult struct {
+	Result      string       `json:"result"`
+	Error       string       `json:"error,omitempty"`
+	SideEffects []SideEffect `json:"side_effects"`
+}
+
+// sideEffectRecorder collects host function calls made during a simulation
+type sideEffectRecorder struct {
+	mu          sync.Mutex
+	sideEffects []SideEffect
+}
+
+func (r *sideEffectRecorder) record(sideEffect SideEffect) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sideEffects = append(r.sideEffects, sideEffect)
+}
+
+// RecordingHostFunction stands in for a real host function. It records the call
+// and returns a canned success response without writing files or calling a node.
+type RecordingHostFunction struct {
+	name      string
+	funcType  *wasmtime.FuncType
+	approved  bool
+	allocFunc *wasmtime.Func
+	memory    *wasmtime.Memory
+	recorder  *sideEffectRecorder
+}
+
+func (h *RecordingHostFunction) Name() string {
+	return h.name
+}
+
+func (h *RecordingHostFunction) FuncType() *wasmtime.FuncType {
+	return h.funcType
+}
+
+func (h *RecordingHostFunction) Initialize(allocFunc, deallocFunc *wasmtime.Func, memory *wasmtime.Memory) {
+	h.allocFunc = allocFunc
+	h.memory = memory
+}
+
+func (h *RecordingHostFunction) Callback() wasmhost.Callback {
+	return h.callback
+}
+
+func (h *RecordingHostFunction) callback(
+	caller *wasmtime.Caller,
+	args []wasmtime.Val,
+) ([]wasmtime.Val, *wasmtime.Trap) {
+	// Imports not shaped like a host function can't be handed a response, so
+	// their arguments are recorded and they return zero values of their result types
+	if !isHostFunctionType(h.funcType) {
+		h.recorder.record(SideEffect{
+			HostFunction: h.name,
+			Input:        formatArgs(args),
+			Approved:     h.approved,
+		})
+		return zeroResults(h.funcType), nil
+	}
+
+	params, err := wasmhost.ParseParams(args)
+	if err != nil {
+		return wasmhost.Fail()
+	}
+	dataBytes, err := wasmhost.ReadInput(caller, h.memory, params)
+	if err != nil {
+		return wasmhost.Fail()
+	}
+	h.recorder.record(SideEffect{
+		HostFunction: h.name,
+		Input:        string(dataBytes),
+		Approved:     h.approved,
+	})
+
+	if err := wasmhost.WriteOutput(caller, h.allocFunc, h.memory, params, simulatedHostResponse); err != nil {
+		return wasmhost.Fail()
+	}
+	return wasmhost.Ok()
+}
+
+// isHostFunctionType reports whether funcType is (input_ptr, input_len, output_ptr_ptr, output_len_ptr) -> status
+func isHostFunctionType(funcType *wasmtime.FuncType) bool {
+	params, results := funcType.Params(), funcType.Results()
+	if len(params) != 4 || len(results) != 1 || results[0].Kind() != wasmtime.KindI32 {
+		return false
+	}
+	for _, param := range params {
+		if param.Kind() != wasmtime.KindI32 {
+			return false
+		}
+	}
+	return true
+}
+
+func zeroResults(funcType *wasmtime.FuncType) []wasmtime.Val {
+	results := make([]wasmtime.Val, 0, len(funcType.Results()))
+	for _, result := range funcType.Results() {
+		switch result.Kind() {
+		case wasmtime.KindI64:
+			results = append(results, wasmtime.ValI64(0))
+		case wasmtime.KindF32:
+			results = append(results, wasmtime.ValF32(0))
+		case wasmtime.KindF64:
+			results = append(results, wasmtime.ValF64(0))
+		case wasmtime.KindFuncref:
+			results = append(results, wasmtime.ValFuncref(nil))
+		case wasmtime.KindExternref:
+			results = append(results, wasmtime.ValExternref(nil))
+		default:
+			results = append(results, wasmtime.ValI32(0))
+		}
+	}
+	return results
+}
+
+func formatArgs(args []wasmtime.Val) string {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = fmt.Sprint(arg.Get())
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
+
+// Simulate runs a contract function with every host function replaced by a recording stub.
+// Nothing is written to disk or sent to a node; the attempted side effects are returned instead.
+func Simulate(ctx context.Context, wasmPath string, contract config.Contract, contractInput string) (*SimulationResult, error) {
+	recorder := &sideEffectRecorder{}
+	wasmModule, err := loadWasmModule(ctx, wasmPath, contract, func(importTypes map[string]*wasmtime.FuncType) (*wasmhost.Registry, error) {
+		registry := wasmhost.NewRegistry()
+		for name, funcType := range importTypes {
+			_, approved := config.GetHostFunctionGrant(contract, name)
+			registry.Register(&RecordingHostFunction{
+				name:     name,
+				funcType: funcType,
+				approved: approved,
+				recorder: recorder,
+			})
+		}
+		return registry, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SimulationResult{}
+	contractResult, err := CallWasmFunction(ctx, wasmModule, contract.Hash, contractInput)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Result = contractResult
+	result.SideEffects = recorder.sideEffects
+	if result.SideEffects == nil {
+		result.SideEffects = []SideEffect{}
+	}
+	logger.FromContext(ctx).Info("contract simulated", "contract", contract.Hash, "side_effects", len(result.SideEffects), "error", result.Error)
+	return result, nil
+}
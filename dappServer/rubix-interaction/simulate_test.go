@@ -0,0 +1,63 @@
+package rubix_interaction
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"dapp-server/config"
+)
+
+// simulatedContract reads a clock import with a non host function signature, then
+// forwards its input to write_to_json_file and returns the host's response
+const simulatedContract = `
+(module
+  (import "env" "write_to_json_file" (func $write (param i32 i32 i32 i32) (result i32)))
+  (import "env" "clock" (func $clock (param i32) (result i64 f32)))
+  (memory (export "memory") 1)
+  (global $next (mut i32) (i32.const 1024))
+  (func (export "alloc") (param $size i32) (result i32)
+    (local $ptr i32)
+    (local.set $ptr (global.get $next))
+    (global.set $next (i32.add (global.get $next) (local.get $size)))
+    (local.get $ptr))
+  (func (export "dealloc") (param i32 i32))
+  (func (export "add_activity_") (param $in i32) (param $len i32) (param $out i32) (param $out_len i32) (result i32)
+    i32.const 7
+    call $clock
+    drop
+    drop
+    (call $write (local.get $in) (local.get $len) (local.get $out) (local.get $out_len))))
+`
+
+func TestSimulate(t *testing.T) {
+	wasmPath := writeWasm(t, simulatedContract)
+	// Only write_to_json_file is granted, and the grant's file must not be touched
+	contract := config.Contract{
+		Hash:          "QmTest",
+		HostFunctions: []config.HostFunctionGrant{{Name: "write_to_json_file", Paths: []string{t.TempDir() + "/activities.json"}}},
+	}
+
+	result, err := Simulate(context.Background(), wasmPath, contract, `{"add_activity": {"activity_id": "1"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Error != "" || result.Result != simulatedHostResponse {
+		t.Fatalf("Simulate() = %q, error %q, want the simulated host response", result.Result, result.Error)
+	}
+	want := []SideEffect{
+		{HostFunction: "clock", Input: "(7)", Approved: false},
+		{HostFunction: "write_to_json_file", Input: `{"activity_id": "1"}`, Approved: true},
+	}
+	if !reflect.DeepEqual(result.SideEffects, want) {
+		t.Fatalf("Simulate() side effects = %+v, want %+v", result.SideEffects, want)
+	}
+
+	result, err = Simulate(context.Background(), wasmPath, contract, `{"remove_activity": {}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Error == "" || len(result.SideEffects) != 0 {
+		t.Fatalf("Simulate() of a missing function = %+v, want an error and no side effects", result)
+	}
+}
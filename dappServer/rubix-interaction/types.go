@@ -1,5 +1,7 @@
 package rubix_interaction
 
+import "io"
+
 // DeploymentResult represents the result of a contract deployment
 type DeploymentResult struct {
 	ContractHash string
@@ -14,15 +16,56 @@ const (
 	StageBuild DeploymentStage = iota
 	StageGenerate
 	StageDeploy
+	StageSign
+	StageRegisterCallback
 )
 
+func (s DeploymentStage) String() string {
+	switch s {
+	case StageBuild:
+		return "build"
+	case StageGenerate:
+		return "generate"
+	case StageDeploy:
+		return "deploy"
+	case StageSign:
+		return "sign"
+	case StageRegisterCallback:
+		return "register_callback"
+	default:
+		return "unknown"
+	}
+}
+
 // StageCallback is a function that gets called when a stage begins
 type StageCallback func(stage DeploymentStage)
 
+// NodeResponseCallback is a function that gets called with the outcome of each node API call
+type NodeResponseCallback func(endpoint string, response string)
+
+// DeployHooks lets the caller follow a deployment while it runs
+type DeployHooks struct {
+	OnStage        StageCallback
+	OnNodeResponse NodeResponseCallback
+	BuildLog       io.Writer // Receives cargo output when building from source
+}
+
+func (h DeployHooks) stage(stage DeploymentStage) {
+	if h.OnStage != nil {
+		h.OnStage(stage)
+	}
+}
+
+func (h DeployHooks) nodeResponse(endpoint string, response string) {
+	if h.OnNodeResponse != nil {
+		h.OnNodeResponse(endpoint, response)
+	}
+}
+
 // ExecutionResult represents the result of a contract execution
 type ExecutionResult struct {
-	Success bool
-	Message string
+	Success        bool
+	Message        string
 	ContractResult string
 }
 
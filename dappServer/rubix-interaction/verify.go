@@ -0,0 +1,155 @@
+package rubix_interaction
+
+import (
+	"crypto/sha256"
+	"dapp-server/config"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ArtifactCheck compares one contract file against what we expect it to be
+type ArtifactCheck struct {
+	Path     string `json:"path,omitempty"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual,omitempty"`
+	Match    bool   `json:"match"`
+}
+
+// NodeVerification reports how a node's stored copy of a contract compares with local sources
+type NodeVerification struct {
+	Node    string        `json:"node"`
+	Present bool          `json:"present"`
+	Wasm    ArtifactCheck `json:"wasm"`
+	Lib     ArtifactCheck `json:"lib"`
+	Drift   bool          `json:"drift"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// ContractVerification is the drift report for a single contract
+type ContractVerification struct {
+	ContractHash  string             `json:"contract_hash"`
+	LocalWasm     ArtifactCheck      `json:"local_wasm"`
+	LocalLib      ArtifactCheck      `json:"local_lib"`
+	RegistryDrift bool               `json:"registry_drift"` // Local sources differ from the digests pinned in the registry
+	Nodes         []NodeVerification `json:"nodes"`
+}
+
+// Drifted reports whether any node or the registry disagrees with the local sources
+func (v *ContractVerification) Drifted() bool {
+	if v.RegistryDrift {
+		return true
+	}
+	for _, node := range v.Nodes {
+		if node.Drift {
+			return true
+		}
+	}
+	return false
+}
+
+// GetContractDir returns the directory a node stores a deployed contract's files in
+func GetContractDir(node config.Node, contractHash string) string {
+	return filepath.Join(node.Path, node.Name, "SmartContract", contractHash)
+}
+
+// VerifyContract hashes the contract's local wasm and lib.rs and compares them with
+// the registry entry and with the files stored by every configured node
+func VerifyContract(cfg *config.Config, contract config.Contract) (*ContractVerification, error) {
+	if contract.WasmPath == "" || contract.LibPath == "" {
+		return nil, fmt.Errorf("contract %s has no local wasm_path or lib_path in the registry", contract.Hash)
+	}
+	wasmDigest, err := fileSHA256(contract.WasmPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash local wasm: %w", err)
+	}
+	libDigest, err := fileSHA256(contract.LibPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash local lib.rs: %w", err)
+	}
+
+	verification := &ContractVerification{
+		ContractHash: contract.Hash,
+		LocalWasm:    compareDigest(contract.WasmPath, contract.WasmSHA256, wasmDigest),
+		LocalLib:     compareDigest(contract.LibPath, contract.LibSHA256, libDigest),
+	}
+	verification.RegistryDrift = !verification.LocalWasm.Match || !verification.LocalLib.Match
+
+	names := make([]string, 0, len(cfg.Nodes))
+	for name := range cfg.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		verification.Nodes = append(verification.Nodes, verifyNodeArtifacts(cfg.Nodes[name], contract.Hash, wasmDigest, libDigest))
+	}
+	return verification, nil
+}
+
+func verifyNodeArtifacts(node config.Node, contractHash, wasmDigest, libDigest string) NodeVerification {
+	result := NodeVerification{
+		Node: node.Name,
+		Wasm: ArtifactCheck{Expected: wasmDigest},
+		Lib:  ArtifactCheck{Expected: libDigest},
+	}
+	contractDir := GetContractDir(node, contractHash)
+	entries, err := os.ReadDir(contractDir)
+	if os.IsNotExist(err) {
+		// The contract was never fetched by this node, which is not drift
+		return result
+	}
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to read directory: %v", err)
+		result.Drift = true
+		return result
+	}
+	result.Present = true
+
+	for _, entry := range entries {
+		path := filepath.Join(contractDir, entry.Name())
+		switch {
+		case strings.HasSuffix(entry.Name(), ".wasm"):
+			result.Wasm = hashNodeArtifact(path, wasmDigest)
+		case strings.HasSuffix(entry.Name(), ".rs"):
+			result.Lib = hashNodeArtifact(path, libDigest)
+		}
+	}
+	if result.Wasm.Path == "" || result.Lib.Path == "" {
+		result.Error = "contract directory is missing the wasm or lib.rs file"
+	}
+	result.Drift = !result.Wasm.Match || !result.Lib.Match
+	return result
+}
+
+func hashNodeArtifact(path, expected string) ArtifactCheck {
+	actual, err := fileSHA256(path)
+	if err != nil {
+		return ArtifactCheck{Path: path, Expected: expected}
+	}
+	return compareDigest(path, expected, actual)
+}
+
+// compareDigest checks actual against expected; an empty expectation always matches
+func compareDigest(path, expected, actual string) ArtifactCheck {
+	check := ArtifactCheck{Path: path, Expected: expected, Actual: actual}
+	check.Match = expected == "" || strings.EqualFold(expected, actual)
+	return check
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"dapp-server/audit"
+	"dapp-server/auth"
+	"dapp-server/catalogue"
+	"dapp-server/config"
+	"dapp-server/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// activityCatalogue holds the activities members can take part in; BootupServer opens it
+var activityCatalogue *catalogue.Store
+
+// How far ahead sessions are listed when the request doesn't say
+const defaultSessionWindow = 30 * 24 * time.Hour
+
+// ActivityRequest carries the editable fields of a catalogue activity
+type ActivityRequest struct {
+	ID           string             `json:"id"` // Only read when creating
+	Title        string             `json:"title"`
+	Description  string             `json:"description"`
+	Category     string             `json:"category"`
+	Instructor   string             `json:"instructor"`
+	Location     string             `json:"location"`
+	Schedule     catalogue.Schedule `json:"schedule"`
+	Capacity     int                `json:"capacity"`
+	RewardPoints int                `json:"reward_points"`
+	ActiveFrom   *time.Time         `json:"active_from"`
+	ActiveUntil  *time.Time         `json:"active_until"`
+}
+
+// PublishActivityRequest names the admin whose node records the activity on chain
+type PublishActivityRequest struct {
+	AdminDID string `json:"admin_did"`
+}
+
+// apply copies the request's editable fields onto an activity
+func (req ActivityRequest) apply(activity *catalogue.Activity) {
+	activity.Title = req.Title
+	activity.Description = req.Description
+	activity.Category = req.Category
+	activity.Instructor = req.Instructor
+	activity.Location = req.Location
+	activity.Schedule = req.Schedule
+	activity.Capacity = req.Capacity
+	activity.RewardPoints = req.RewardPoints
+	activity.ActiveFrom = req.ActiveFrom
+	activity.ActiveUntil = req.ActiveUntil
+}
+
+// errInvalidActivity marks catalogue changes refused because of the request's content
+var errInvalidActivity = errors.New("invalid activity")
+
+// catalogueError replies with the status matching a catalogue or attendance error
+func catalogueError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, catalogue.ErrNotFound), errors.Is(err, catalogue.ErrCheckInNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, catalogue.ErrConflict), errors.Is(err, catalogue.ErrSessionFull):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errInvalidActivity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		logger.FromContext(c.Request.Context()).Error("catalogue operation failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// activityCategories returns the categories the current config allows
+func activityCategories() []string {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil
+	}
+	return config.GetCategories(cfg)
+}
+
+// APIListActivities lists the branch's catalogue, filtered by the category, status and active query parameters
+func APIListActivities(c *gin.Context) {
+	filter := catalogue.Filter{
+		Branch:   currentBranch(c).ID,
+		Category: c.Query("category"),
+		Status:   c.Query("status"),
+	}
+	if c.Query("active") == "true" {
+		filter.ActiveAt = time.Now()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Activities",
+		"data":    activityCatalogue.List(filter),
+	})
+}
+
+// APIGetActivity returns one of the branch's activities
+func APIGetActivity(c *gin.Context) {
+	activity, err := activityCatalogue.Get(currentBranch(c).ID, c.Param("id"))
+	if err != nil {
+		catalogueError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Activity",
+		"data":    activity,
+	})
+}
+
+// APIListSessions lists an activity's sessions between the from and to query parameters,
+// the next 30 days by default
+func APIListSessions(c *gin.Context) {
+	activity, err := activityCatalogue.Get(currentBranch(c).ID, c.Param("id"))
+	if err != nil {
+		catalogueError(c, err)
+		return
+	}
+	from, to := time.Now(), time.Time{}
+	for name, value := range map[string]*time.Time{"from": &from, "to": &to} {
+		if raw := c.Query(name); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be an RFC 3339 time", name)})
+				return
+			}
+			*value = parsed
+		}
+	}
+	if to.IsZero() {
+		to = from.Add(defaultSessionWindow)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Activity sessions",
+		"data":    activity.Schedule.Sessions(from, to),
+	})
+}
+
+// APICreateActivity adds a draft activity to the branch's catalogue
+func APICreateActivity(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	var req ActivityRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		log.Warn("invalid request body", "error", err)
+		return
+	}
+	activity := catalogue.Activity{ID: req.ID, Branch: currentBranch(c).ID}
+	req.apply(&activity)
+	if principal, exists := auth.GetPrincipal(c); exists {
+		activity.CreatedBy = principal.Subject
+	}
+	if err := activity.Validate(activityCategories()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	entry := startAudit(c, audit.ActionCreateActivity, "", req)
+	defer finishAudit(ctx, entry)
+	activity, err := activityCatalogue.Create(activity)
+	if err != nil {
+		entry.Error = err.Error()
+		catalogueError(c, err)
+		return
+	}
+	entry.Result = audit.ResultSuccess
+	log.Info("catalogue activity created", "activity_id", activity.ID, "branch", activity.Branch)
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Activity created",
+		"data":    activity,
+	})
+}
+
+// APIUpdateActivity replaces an activity's editable fields. Once published its reward
+// points are on chain and can't change; archived activities and those being published
+// can't change at all.
+func APIUpdateActivity(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	var req ActivityRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		log.Warn("invalid request body", "error", err)
+		return
+	}
+	entry := startAudit(c, audit.ActionUpdateActivity, "", req)
+	defer finishAudit(ctx, entry)
+	categories := activityCategories()
+	activity, err := activityCatalogue.Update(currentBranch(c).ID, c.Param("id"), func(activity *catalogue.Activity) error {
+		switch {
+		case activity.Status == catalogue.StatusArchived, activity.Status == catalogue.StatusPublishing:
+			return fmt.Errorf("%w: activity %s is %s", catalogue.ErrConflict, activity.ID, activity.Status)
+		case activity.Status == catalogue.StatusPublished && req.RewardPoints != activity.RewardPoints:
+			return fmt.Errorf("%w: activity %s is published with %d reward points, the chain holds them",
+				catalogue.ErrConflict, activity.ID, activity.RewardPoints)
+		}
+		req.apply(activity)
+		if err := activity.Validate(categories); err != nil {
+			return fmt.Errorf("%w: %w", errInvalidActivity, err)
+		}
+		return nil
+	})
+	if err != nil {
+		entry.Error = err.Error()
+		catalogueError(c, err)
+		return
+	}
+	entry.Result = audit.ResultSuccess
+	log.Info("catalogue activity updated", "activity_id", activity.ID, "branch", activity.Branch)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Activity updated",
+		"data":    activity,
+	})
+}
+
+// APIDeleteActivity deletes a draft activity, or archives a published one
+func APIDeleteActivity(c *gin.Context) {
+	ctx := c.Request.Context()
+	entry := startAudit(c, audit.ActionDeleteActivity, "", gin.H{"id": c.Param("id")})
+	defer finishAudit(ctx, entry)
+	activity, err := activityCatalogue.Delete(currentBranch(c).ID, c.Param("id"))
+	if err != nil {
+		entry.Error = err.Error()
+		catalogueError(c, err)
+		return
+	}
+	entry.Result = audit.ResultSuccess
+	message := "Activity deleted"
+	if activity.Status == catalogue.StatusArchived {
+		message = "Activity archived"
+	}
+	logger.FromContext(ctx).Info("catalogue activity removed", "activity_id", activity.ID, "branch", activity.Branch, "status", activity.Status)
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"data":    activity,
+	})
+}
+
+// APIPublishActivity records a draft activity with the branch's add-activity contract,
+// so the chain holds its reward points, then marks it published
+func APIPublishActivity(c *gin.Context) {
+	var req PublishActivityRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		logger.FromContext(c.Request.Context()).Warn("invalid request body", "error", err)
+		return
+	}
+	activity, err := activityCatalogue.Get(currentBranch(c).ID, c.Param("id"))
+	if err != nil {
+		catalogueError(c, err)
+		return
+	}
+	publishActivity(c, activity, req.AdminDID)
+}
+
+// publishActivity runs the add-activity contract for a draft and replies with the published
+// activity. The activity is held in publishing while the contract runs, so concurrent
+// requests can't record it twice, and goes back to draft if the contract fails.
+func publishActivity(c *gin.Context, activity catalogue.Activity, adminDID string) {
+	ctx := c.Request.Context()
+	branch := currentBranch(c)
+	log := logger.FromContext(ctx).With("activity_id", activity.ID, "admin_did", adminDID, "branch", branch.ID)
+	if !authorizeDID(c, adminDID) || !authorizeBranchAdmin(c, adminDID) {
+		return
+	}
+	activity, err := activityCatalogue.StartPublishing(branch.ID, activity.ID)
+	if err != nil {
+		catalogueError(c, err)
+		return
+	}
+	entry := startAudit(c, audit.ActionAddActivity, adminDID, AddActivityRequest{
+		ActivityID:   activity.ID,
+		RewardPoints: activity.RewardPoints,
+		AdminDID:     adminDID,
+	})
+	defer finishAudit(ctx, entry)
+	log.Info("publish activity requested", "reward_points", activity.RewardPoints)
+	if _, err := addActivityOnChain(ctx, entry, branch, adminDID, activity.ID, activity.RewardPoints); err != nil {
+		log.Error("failed to add activity", "error", err)
+		if _, abortErr := activityCatalogue.AbortPublishing(branch.ID, activity.ID); abortErr != nil {
+			log.Error("failed to return the activity to draft", "error", abortErr)
+		}
+		c.JSON(contractErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	activity, err = activityCatalogue.MarkPublished(branch.ID, activity.ID, entry.RubixRequestID)
+	if err != nil {
+		// The chain already has the activity, so this needs fixing by hand
+		log.Error("activity is on chain but the catalogue wasn't updated", "rubix_request_id", entry.RubixRequestID, "error", err)
+		catalogueError(c, err)
+		return
+	}
+	log.Info("catalogue activity published", "rubix_request_id", activity.RubixRequestID)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Activity published to smart contract tokenchain",
+		"data":    activity,
+	})
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dapp-server/catalogue"
+	"dapp-server/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCatalogueHandlers(t *testing.T) {
+	node := newFakeNode(t, nil)
+	dir := loadTestConfig(t, fmt.Sprintf(`
+[nodes.node1]
+name = "node1"
+port = "20000"
+did = "did:admin"
+url = %q
+`, node.URL))
+	store, err := catalogue.Open(filepath.Join(dir, "catalogue.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := activityCatalogue
+	activityCatalogue = store
+	t.Cleanup(func() { activityCatalogue = previous })
+	north := config.Branch{ID: "north", AdminDIDs: []string{"did:admin", "did:outsider"}, AddActivityContract: "QmAdd"}
+	inBranch := func(c *gin.Context) { c.Set(branchKey, north) }
+
+	const yoga = `{"id": "yoga", "title": "Morning yoga", "category": "fitness", "reward_points": 10,
+		"schedule": {"start": "2026-11-02T07:00:00Z", "duration": "45m", "repeat": "weekly"}}`
+	steps := []struct {
+		name       string
+		method     string
+		route      string
+		path       string
+		body       string
+		handler    gin.HandlerFunc
+		nodeDown   bool // Whether the node refuses to execute contracts
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "create", method: http.MethodPost, route: "/activities", path: "/activities", body: yoga, handler: APICreateActivity, wantStatus: http.StatusCreated, wantBody: `"status":"draft"`},
+		{name: "create again", method: http.MethodPost, route: "/activities", path: "/activities", body: yoga, handler: APICreateActivity, wantStatus: http.StatusConflict},
+		{name: "create invalid", method: http.MethodPost, route: "/activities", path: "/activities", body: `{"id": "empty", "category": "chess"}`, handler: APICreateActivity, wantStatus: http.StatusBadRequest, wantBody: "title is required"},
+		{name: "create unreadable", method: http.MethodPost, route: "/activities", path: "/activities", body: `{"id":`, handler: APICreateActivity, wantStatus: http.StatusBadRequest, wantBody: "Invalid request body"},
+		{name: "get missing", method: http.MethodGet, route: "/activities/:id", path: "/activities/missing", handler: APIGetActivity, wantStatus: http.StatusNotFound},
+		{name: "sessions with a bad time", method: http.MethodGet, route: "/activities/:id/sessions", path: "/activities/yoga/sessions?from=monday", handler: APIListSessions, wantStatus: http.StatusBadRequest, wantBody: "from must be an RFC 3339 time"},
+		{name: "publish by an admin without a node", method: http.MethodPost, route: "/activities/:id/publish", path: "/activities/yoga/publish", body: `{"admin_did": "did:outsider"}`, handler: APIPublishActivity, wantStatus: http.StatusBadRequest, wantBody: "no node configured for admin DID did:outsider"},
+		{name: "publish refused by the node", method: http.MethodPost, route: "/activities/:id/publish", path: "/activities/yoga/publish", body: `{"admin_did": "did:admin"}`, handler: APIPublishActivity, nodeDown: true, wantStatus: http.StatusBadGateway},
+		{name: "back to draft", method: http.MethodGet, route: "/activities/:id", path: "/activities/yoga", handler: APIGetActivity, wantStatus: http.StatusOK, wantBody: `"status":"draft"`},
+		{name: "publish", method: http.MethodPost, route: "/activities/:id/publish", path: "/activities/yoga/publish", body: `{"admin_did": "did:admin"}`, handler: APIPublishActivity, wantStatus: http.StatusOK, wantBody: `"rubix_request_id":"execute-request"`},
+		{name: "publish again", method: http.MethodPost, route: "/activities/:id/publish", path: "/activities/yoga/publish", body: `{"admin_did": "did:admin"}`, handler: APIPublishActivity, wantStatus: http.StatusConflict},
+		{name: "change published reward points", method: http.MethodPut, route: "/activities/:id", path: "/activities/yoga", body: strings.Replace(yoga, `"reward_points": 10`, `"reward_points": 20`, 1), handler: APIUpdateActivity, wantStatus: http.StatusConflict, wantBody: "the chain holds them"},
+		{name: "change published title", method: http.MethodPut, route: "/activities/:id", path: "/activities/yoga", body: strings.Replace(yoga, "Morning yoga", "Sunrise yoga", 1), handler: APIUpdateActivity, wantStatus: http.StatusOK, wantBody: "Sunrise yoga"},
+		{name: "archive", method: http.MethodDelete, route: "/activities/:id", path: "/activities/yoga", handler: APIDeleteActivity, wantStatus: http.StatusOK, wantBody: "Activity archived"},
+		{name: "change archived", method: http.MethodPut, route: "/activities/:id", path: "/activities/yoga", body: yoga, handler: APIUpdateActivity, wantStatus: http.StatusConflict},
+	}
+	for _, step := range steps {
+		reply := okNodeReplies["/api/execute-smart-contract"]
+		if step.nodeDown {
+			reply = `{"status": false, "message": "quorum unavailable"}`
+		}
+		node.mu.Lock()
+		node.replies["/api/execute-smart-contract"] = reply
+		node.mu.Unlock()
+
+		recorder := doRequest(step.method, step.route, step.path, step.body, nil, inBranch, step.handler)
+		if recorder.Code != step.wantStatus || !strings.Contains(recorder.Body.String(), step.wantBody) {
+			t.Fatalf("%s = %d %s, want %d with %q", step.name, recorder.Code, recorder.Body, step.wantStatus, step.wantBody)
+		}
+	}
+	if got := len(node.calls("/api/execute-smart-contract")); got != 2 {
+		t.Fatalf("node executed the add-activity contract %d times, want 2", got)
+	}
+}
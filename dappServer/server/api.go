@@ -1,11 +1,19 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 
+	"dapp-server/audit"
+	"dapp-server/auth"
 	"dapp-server/config"
+	"dapp-server/idempotency"
+	"dapp-server/logger"
+	"dapp-server/metrics"
 	rubix "dapp-server/rubix-interaction"
 
 	"github.com/gin-gonic/gin"
@@ -20,46 +28,73 @@ type ExecuteRequest struct {
 
 type DeployRequest struct {
 	WasmPath    string `json:"wasm_path"`
+	ProjectPath string `json:"project_path"` // Cargo project to build instead of a prebuilt wasm
 	LibPath     string `json:"lib_path"`
 	DeployerDid string `json:"deployer_did"`
 	StatePath   string `json:"state_path"`
+	Async       bool   `json:"async"` // Return immediately and follow progress on /api/deploy/:id/events
+}
+
+type SimulateRequest struct {
+	Node          string `json:"node"` // Name of the node whose copy of the contract runs
+	Port          string `json:"port"` // Picks the node by port instead, when only one node uses it
+	ExecutorDid   string `json:"executor_did"`
+	ContractInput string `json:"contract_input"`
 }
 
 func APIExecuteContract(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	var req ExecuteRequest
 	err := json.NewDecoder(c.Request.Body).Decode(&req)
 
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
-		fmt.Printf("Error reading response body: %s\n", err)
+		log.Warn("invalid request body", "error", err)
 		return
 	}
 	// Load config to get API URL
 	cfg, err := config.GetConfig()
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	nodeName, exist := config.GetNodeNameByDid(cfg, req.ExecutorDid)
-	if !exist {
-		fmt.Println("Failed to fetch node name from config")
-	}
-	fmt.Println("The node name is :", nodeName)
-	result, err := rubix.Execute(req.ContractHash, req.ExecutorDid, req.ContractInput, nodeName)
-	if err != nil {
-		fmt.Println("Failed to execute Contract err :", err)
+	log = log.With("contract", req.ContractHash, "executor_did", req.ExecutorDid)
+	if !authorizeDID(c, req.ExecutorDid) || !authorizeContractBranch(c, cfg, req.ContractHash) ||
+		!authorizeDIDBranch(c, cfg, req.ExecutorDid) {
+		return
 	}
-	fmt.Println("The result returned : ", result)
-	port, exist := config.GetPortByNodeName(cfg, nodeName)
+	entry := startAudit(c, audit.ActionExecuteContract, req.ExecutorDid, req)
+	entry.Contract = req.ContractHash
+	defer finishAudit(ctx, entry)
+	node, exist := config.GetNodeByDid(cfg, req.ExecutorDid)
 	if !exist {
-		fmt.Println("Failed to fetch port from config")
+		log.Warn("no node configured for executor DID")
+		entry.Error = "no node configured for executor DID"
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no node configured for executor_did"})
+		return
 	}
-
-	url := fmt.Sprintf("http://localhost:%s", port)
-	fmt.Println("The url is :", url)
-	// Call signature-response API
-	if err := rubix.SignatureResponse(url, result.ContractResult); err != nil {
+	result, err := rubix.Execute(ctx, req.ContractHash, req.ExecutorDid, req.ContractInput, node)
+	if result != nil {
+		// The node holds the execution from here, a retry must not start another
+		idempotency.MarkSideEffects(c)
+		entry.RubixRequestID = result.ContractResult
+	}
+	if err != nil {
+		log.Error("failed to execute contract", "node", node.Name, "error", err)
+		entry.Error = err.Error()
+		if result == nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":            "contract execution is unconfirmed: " + err.Error(),
+			"rubix_request_id": result.ContractResult,
+		})
 		return
 	}
+	log.Info("contract executed", "node", node.Name, "rubix_request_id", result.ContractResult)
+	entry.Result = audit.ResultSuccess
 
 	resultFinal := gin.H{
 		"message": "DApp executed successfully",
@@ -75,7 +110,7 @@ func APIDeployContract(c *gin.Context) {
 	err := json.NewDecoder(c.Request.Body).Decode(&req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
-		fmt.Printf("Error reading response body: %s\n", err)
+		logger.FromContext(c.Request.Context()).Warn("invalid request body", "error", err)
 		return
 	}
 	// Load config to get API URL
@@ -83,18 +118,209 @@ func APIDeployContract(c *gin.Context) {
 	if err != nil {
 		return
 	}
-	nodeName, exist := config.GetNodeNameByDid(cfg, req.DeployerDid)
+	if !authorizeDID(c, req.DeployerDid) || !authorizeDIDBranch(c, cfg, req.DeployerDid) {
+		return
+	}
+	node, exist := config.GetNodeByDid(cfg, req.DeployerDid)
 	if !exist {
-		fmt.Println("Failed to fetch node name from config")
+		logger.FromContext(c.Request.Context()).Warn("no node configured for deployer DID", "deployer_did", req.DeployerDid)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no node configured for deployer_did"})
+		return
 	}
-	result, err := rubix.Deploy(req.WasmPath, req.LibPath, req.DeployerDid, req.StatePath, nodeName)
+	source := req.WasmPath
+	if req.ProjectPath != "" {
+		source = req.ProjectPath
+	}
+	// Deployments read and build files on this server, so only paths under the configured roots are accepted
+	source, err = config.ResolveProjectPath(cfg, source)
 	if err != nil {
-		fmt.Println("Failed to deploy contract err :", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	libPath, statePath := req.LibPath, req.StatePath
+	for _, path := range []*string{&libPath, &statePath} {
+		if *path == "" {
+			continue
+		}
+		if *path, err = config.ResolveProjectPath(cfg, *path); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	var deployer, branchID string
+	if principal, exists := auth.GetPrincipal(c); exists {
+		deployer = principal.Subject
+	}
+	if branch, exists := c.Get(branchKey); exists {
+		branchID = branch.(config.Branch).ID
+	}
+	id, d := deployments.start(deployer, req.DeployerDid, branchID)
+	// Async deployments outlive the request, keep its request ID but not its cancellation
+	ctx := logger.Detach(c.Request.Context())
+	log := logger.FromContext(ctx).With("deployment_id", id, "node", node.Name)
+	entry := startAudit(c, audit.ActionDeployContract, req.DeployerDid, req)
+	hooks := d.hooks()
+	var buildLog bytes.Buffer
+	hooks.BuildLog = io.MultiWriter(&buildLog, debugLogWriter{log}, hooks.BuildLog)
+	deploy := func() (*rubix.DeploymentResult, error) {
+		result, err := rubix.Deploy(ctx, source, libPath, req.DeployerDid, statePath, node, hooks)
+		defer finishAudit(ctx, entry)
+		if err != nil {
+			log.Error("failed to deploy contract", "error", err)
+			entry.Error = err.Error()
+			deployments.finish(id, d, DeploymentEvent{Type: "error", Message: err.Error()})
+			return nil, err
+		}
+		log.Info("contract deployed", "contract", result.ContractHash)
+		entry.Contract = result.ContractHash
+		entry.Result = audit.ResultSuccess
+		deployments.finish(id, d, DeploymentEvent{Type: "done", Data: result})
+		return result, nil
+	}
+
+	if req.Async {
+		done, err := trackJob()
+		if err != nil {
+			entry.Error = err.Error()
+			finishAudit(ctx, entry)
+			deployments.finish(id, d, DeploymentEvent{Type: "error", Message: err.Error()})
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "deployment_id": id})
+			return
+		}
+		metrics.JobQueued("deployment")
+		go func() {
+			defer done()
+			defer metrics.JobDone("deployment")
+			deploy()
+		}()
+		response := gin.H{
+			"message":       "Contract deployment started",
+			"deployment_id": id,
+			"events_url":    eventsPath(id),
+		}
+		// Browsers can't send credentials with EventSource, so the URL carries a stream token
+		if principal, exists := auth.GetPrincipal(c); exists {
+			if token, _ := deployments.issueToken(id, principal); token != "" {
+				response["events_url"] = eventsPath(id) + "?" + StreamTokenParam + "=" + token
+			}
+		}
+		c.JSON(http.StatusAccepted, response)
+		return
+	}
+
+	result, err := deploy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "deployment_id": id, "build_log": buildLog.String()})
+		return
 	}
-	fmt.Println("The result returned : ", result)
 	resultFinal := gin.H{
-		"message": "Contract Deployed Successfully",
-		"data":    result,
+		"message":       "Contract Deployed Successfully",
+		"data":          result,
+		"deployment_id": id,
+		"build_log":     buildLog.String(),
 	}
 	c.JSON(http.StatusOK, resultFinal)
 }
+
+// APISimulateContract dry-runs a contract function locally. Host functions are
+// replaced by recording stubs so no files are written and no tokens move.
+func APISimulateContract(c *gin.Context) {
+	contractHash := c.Param("hash")
+	var req SimulateRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		logger.FromContext(c.Request.Context()).Warn("invalid request body", "error", err)
+		return
+	}
+	cfg, err := config.GetConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ExecutorDid != "" && (!authorizeDID(c, req.ExecutorDid) || !authorizeDIDBranch(c, cfg, req.ExecutorDid)) {
+		return
+	}
+	if !authorizeContractBranch(c, cfg, contractHash) {
+		return
+	}
+	node, err := simulationNode(cfg, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	contract, err := getRegisteredContract(contractHash)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	wasmPath, err := rubix.GetWasmContractPath(c.Request.Context(), node, contract)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := rubix.Simulate(c.Request.Context(), wasmPath, contract, req.ContractInput)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to simulate contract", "contract", contractHash, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Contract simulated, nothing was committed",
+		"data":    result,
+	})
+}
+
+// APIVerifyContract reports whether each node's stored copy of a contract matches our local sources
+func APIVerifyContract(c *gin.Context) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	contract, exists := config.GetContractByHash(cfg, c.Param("hash"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "contract is not in the contract registry"})
+		return
+	}
+	verification, err := rubix.VerifyContract(cfg, contract)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	message := "Contract artifacts match local sources"
+	if verification.Drifted() {
+		message = "Contract artifacts have drifted from local sources"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"data":    verification,
+	})
+}
+
+// simulationNode picks the node a simulation reads the contract from: the named node,
+// the only node on the given port, or the executor's node
+func simulationNode(cfg *config.Config, req SimulateRequest) (config.Node, error) {
+	switch {
+	case req.Node != "":
+		node, exists := config.GetNodeByName(cfg, req.Node)
+		if !exists {
+			return config.Node{}, fmt.Errorf("node %s is not configured", req.Node)
+		}
+		return node, nil
+	case req.Port != "":
+		nodes := config.GetNodesByPort(cfg, req.Port)
+		switch len(nodes) {
+		case 0:
+			return config.Node{}, fmt.Errorf("no node configured on port %s", req.Port)
+		case 1:
+			return nodes[0], nil
+		}
+		return config.Node{}, fmt.Errorf("several nodes use port %s, name one in node", req.Port)
+	}
+	node, exists := config.GetNodeByDid(cfg, req.ExecutorDid)
+	if !exists {
+		return config.Node{}, errors.New("node, port or a configured executor_did is required")
+	}
+	return node, nil
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dapp-server/auth"
+	"dapp-server/idempotency"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPIDeployContractPaths(t *testing.T) {
+	node := newFakeNode(t, nil)
+	root, outside := t.TempDir(), t.TempDir()
+	wasm := writeFile(t, root, "contract.wasm", "wasm bytes")
+	lib := writeFile(t, root, "lib.rs", "lib source")
+	state := writeFile(t, root, "state.json", "{}")
+	outsideLib := writeFile(t, outside, "lib.rs", "other source")
+	if err := os.Symlink(writeFile(t, outside, "state.json", "{}"), filepath.Join(root, "link.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		roots      []string
+		wasm       string
+		lib        string
+		state      string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "inside the roots", roots: []string{root}, wasm: wasm, lib: lib, state: state, wantStatus: http.StatusOK},
+		{name: "wasm outside the roots", roots: []string{outside}, wasm: wasm, lib: outsideLib, state: state, wantStatus: http.StatusBadRequest, wantError: "is outside build.project_roots"},
+		{name: "lib outside the roots", roots: []string{root}, wasm: wasm, lib: outsideLib, state: state, wantStatus: http.StatusBadRequest, wantError: "is outside build.project_roots"},
+		{name: "state linked out of the roots", roots: []string{root}, wasm: wasm, lib: lib, state: filepath.Join(root, "link.json"), wantStatus: http.StatusBadRequest, wantError: "is outside build.project_roots"},
+		{name: "missing wasm", roots: []string{root}, wasm: filepath.Join(root, "missing.wasm"), lib: lib, state: state, wantStatus: http.StatusBadRequest, wantError: "failed to resolve"},
+		{name: "no roots configured", roots: []string{}, wasm: wasm, lib: lib, state: state, wantStatus: http.StatusBadRequest, wantError: "deploying contracts is disabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roots, _ := json.Marshal(tt.roots)
+			loadTestConfig(t, fmt.Sprintf(`
+[build]
+project_roots = %s
+
+[nodes.node1]
+name = "node1"
+port = "20000"
+did = "did:deployer"
+url = %q
+`, roots, node.URL))
+			body, _ := json.Marshal(DeployRequest{WasmPath: tt.wasm, LibPath: tt.lib, StatePath: tt.state, DeployerDid: "did:deployer"})
+			recorder := doRequest(http.MethodPost, "/api/deploy-contract", "/api/deploy-contract", string(body), nil, APIDeployContract)
+			if recorder.Code != tt.wantStatus || !strings.Contains(recorder.Body.String(), tt.wantError) {
+				t.Fatalf("deploy = %d %s, want %d with %q", recorder.Code, recorder.Body, tt.wantStatus, tt.wantError)
+			}
+		})
+	}
+
+	generated := node.calls("/api/generate-smart-contract")
+	if len(generated) != 1 || !strings.Contains(generated[0], "wasm bytes") || !strings.Contains(generated[0], "lib source") {
+		t.Fatalf("node received %d generate requests, want only the one from inside the roots", len(generated))
+	}
+}
+
+func TestAPIExecuteContract(t *testing.T) {
+	tests := []struct {
+		name          string
+		replies       map[string]string
+		wantStatus    int
+		wantBody      string
+		wantRequestID bool
+		wantExecuted  int // Executions the node sees for the request and its retry
+	}{
+		{name: "executed", wantStatus: http.StatusOK, wantBody: "DApp executed successfully", wantRequestID: true, wantExecuted: 1},
+		{
+			name:         "node refuses",
+			replies:      map[string]string{"/api/execute-smart-contract": `{"status": false, "message": "insufficient balance"}`},
+			wantStatus:   http.StatusBadGateway,
+			wantBody:     "insufficient balance",
+			wantExecuted: 2,
+		},
+		{
+			name:          "signature response fails",
+			replies:       map[string]string{"/api/signature-response": ""},
+			wantStatus:    http.StatusBadGateway,
+			wantBody:      "contract execution is unconfirmed",
+			wantRequestID: true,
+			wantExecuted:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newFakeNode(t, tt.replies)
+			loadTestConfig(t, fmt.Sprintf(`
+[nodes.node1]
+name = "node1"
+port = "20000"
+did = "did:executor"
+url = %q
+
+[contracts.activity]
+name = "activity"
+hash = "QmContract"
+`, node.URL))
+			router := gin.New()
+			router.POST("/api/execute-contract", auth.Middleware(false), idempotency.Middleware(idempotency.NewStore(time.Hour)), APIExecuteContract)
+			body := `{"contract_hash": "QmContract", "executor_did": "did:executor", "contract_input": "{}"}`
+			send := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/api/execute-contract", strings.NewReader(body))
+				req.Header.Set(idempotency.Header, "retry-key")
+				recorder := httptest.NewRecorder()
+				router.ServeHTTP(recorder, req)
+				return recorder
+			}
+
+			first := send()
+			if first.Code != tt.wantStatus || !strings.Contains(first.Body.String(), tt.wantBody) {
+				t.Fatalf("execute = %d %s, want %d with %q", first.Code, first.Body, tt.wantStatus, tt.wantBody)
+			}
+			if got := strings.Contains(first.Body.String(), "execute-request"); got != tt.wantRequestID {
+				t.Fatalf("execute = %s, want the Rubix request ID: %v", first.Body, tt.wantRequestID)
+			}
+			// A retry runs again only when the node never took the execution
+			if retry := send(); retry.Code != tt.wantStatus {
+				t.Fatalf("retry = %d %s, want %d", retry.Code, retry.Body, tt.wantStatus)
+			}
+			if got := len(node.calls("/api/execute-smart-contract")); got != tt.wantExecuted {
+				t.Fatalf("node executed the contract %d times, want %d", got, tt.wantExecuted)
+			}
+			if got := len(node.calls("/api/signature-response")); tt.wantExecuted == 1 && got != 1 {
+				t.Fatalf("node received %d signature responses, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,483 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dapp-server/audit"
+	"dapp-server/auth"
+	"dapp-server/catalogue"
+	"dapp-server/config"
+	"dapp-server/logger"
+	"dapp-server/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// attendanceLog holds check-ins and the reward transfers they queue; BootupServer opens it
+var attendanceLog *catalogue.Attendance
+
+// rewardTransfers runs the transfers confirmed check-ins queue; BootupServer starts it
+var rewardTransfers = &transferQueue{wake: make(chan struct{}, 1)}
+
+// Actor and auth method recorded for work the attendance rules do on their own
+const (
+	attendanceActor      = "attendance-rule"
+	attendanceAuthMethod = "automatic"
+)
+
+// CheckInRequest identifies the member checking in: by member ID, by the member ID in
+// their QR code, or by DID at a kiosk. Without a session index the session open now is used.
+type CheckInRequest struct {
+	Method   string `json:"method"` // member_id, qr or kiosk
+	MemberID string `json:"member_id"`
+	QRCode   string `json:"qr_code"`
+	UserDID  string `json:"user_did"`
+	Session  *int   `json:"session"`
+}
+
+// ConfirmAttendanceRequest names the admin whose node signs the reward transfer
+type ConfirmAttendanceRequest struct {
+	AdminDID string `json:"admin_did"`
+}
+
+// RejectAttendanceRequest says why a checked in member gets no reward
+type RejectAttendanceRequest struct {
+	Reason string `json:"reason"`
+}
+
+// resolveMember returns the DID and member ID a check-in request is for
+func (req CheckInRequest) resolveMember(cfg *config.Config) (string, string, error) {
+	memberID := req.MemberID
+	switch req.Method {
+	case catalogue.MethodMemberID:
+		if memberID == "" {
+			return "", "", errors.New("member_id is required")
+		}
+	case catalogue.MethodQR:
+		// Member QR codes carry the member ID
+		if req.QRCode == "" {
+			return "", "", errors.New("qr_code is required")
+		}
+		memberID = req.QRCode
+	case catalogue.MethodKiosk:
+		if memberID == "" && req.UserDID == "" {
+			return "", "", errors.New("member_id or user_did is required")
+		}
+	default:
+		return "", "", fmt.Errorf("method %q is not one of member_id, qr or kiosk", req.Method)
+	}
+	if memberID == "" {
+		// Kiosks may send just the DID, which still has to belong to a registered member
+		memberID, exists := config.GetMemberID(cfg, req.UserDID)
+		if !exists {
+			return "", "", fmt.Errorf("%s is not a registered member", req.UserDID)
+		}
+		return req.UserDID, memberID, nil
+	}
+	did, exists := config.GetMemberDID(cfg, memberID)
+	if !exists {
+		return "", "", fmt.Errorf("member %s is not registered", memberID)
+	}
+	if req.UserDID != "" && req.UserDID != did {
+		return "", "", fmt.Errorf("member %s is not %s", memberID, req.UserDID)
+	}
+	return did, memberID, nil
+}
+
+// checkInSession returns the session of the activity a check-in at t is for
+func checkInSession(activity catalogue.Activity, index *int, t time.Time, opens time.Duration) (catalogue.Session, error) {
+	if index == nil {
+		session, exists := activity.Schedule.Current(t, opens)
+		if !exists {
+			return catalogue.Session{}, fmt.Errorf("%w: no session of %s is open for check-in", catalogue.ErrConflict, activity.ID)
+		}
+		return session, nil
+	}
+	session, exists := activity.Schedule.Session(*index)
+	if !exists {
+		return catalogue.Session{}, fmt.Errorf("%w: activity %s has no session %d", errInvalidActivity, activity.ID, *index)
+	}
+	if t.Before(session.Start.Add(-opens)) || !t.Before(session.End) {
+		return catalogue.Session{}, fmt.Errorf("%w: session %d of %s isn't open for check-in", catalogue.ErrConflict, *index, activity.ID)
+	}
+	return session, nil
+}
+
+// APICheckIn checks a member in to the activity session running now or about to start
+func APICheckIn(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	var req CheckInRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		log.Warn("invalid request body", "error", err)
+		return
+	}
+	cfg, err := config.GetConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	branch := currentBranch(c)
+	activity, err := activityCatalogue.Get(branch.ID, c.Param("id"))
+	if err != nil {
+		catalogueError(c, err)
+		return
+	}
+	did, memberID, err := req.resolveMember(cfg)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	principal, _ := auth.GetPrincipal(c)
+	if principal == nil || !accessPolicy.CanCheckIn(principal, did) {
+		auth.Forbid(c, fmt.Sprintf("not allowed to check in %s", did))
+		return
+	}
+	now := time.Now()
+	if !activity.IsActive(now) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("activity %s isn't earning rewards now", activity.ID)})
+		return
+	}
+	session, err := checkInSession(activity, req.Session, now, config.GetCheckInOpens(cfg))
+	if err != nil {
+		catalogueError(c, err)
+		return
+	}
+	log = log.With("activity_id", activity.ID, "session", session.Index, "user_did", did, "branch", branch.ID)
+	entry := startAudit(c, audit.ActionCheckIn, did, req)
+	defer finishAudit(ctx, entry)
+	checkIn, err := attendanceLog.CheckIn(catalogue.CheckIn{
+		Branch:      branch.ID,
+		ActivityID:  activity.ID,
+		Session:     session,
+		UserDID:     did,
+		MemberID:    memberID,
+		Method:      req.Method,
+		CheckedInBy: principal.Subject,
+	}, activity.Capacity)
+	if err != nil {
+		entry.Error = err.Error()
+		catalogueError(c, err)
+		return
+	}
+	entry.Result = audit.ResultSuccess
+	log.Info("member checked in", "check_in_id", checkIn.ID, "method", checkIn.Method)
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Checked in",
+		"data":    checkIn,
+	})
+}
+
+// APIListCheckIns lists the branch's check-ins, filtered by the activity_id, session, status
+// and user_did query parameters. Members must name one of their own DIDs.
+func APIListCheckIns(c *gin.Context) {
+	filter := catalogue.AttendanceFilter{
+		Branch:     currentBranch(c).ID,
+		ActivityID: c.Query("activity_id"),
+		UserDID:    c.Query("user_did"),
+		Status:     c.Query("status"),
+	}
+	if raw := c.Query("session"); raw != "" {
+		index, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "session must be a session index"})
+			return
+		}
+		filter.Session = &index
+	}
+	principal, _ := auth.GetPrincipal(c)
+	if principal == nil || !accessPolicy.CanCheckIn(principal, filter.UserDID) {
+		auth.Forbid(c, fmt.Sprintf("not allowed to read check-ins of %q", filter.UserDID))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Check-ins",
+		"data":    attendanceLog.List(filter),
+	})
+}
+
+// APIGetCheckIn returns a check-in with the reward transfer it led to
+func APIGetCheckIn(c *gin.Context) {
+	checkIn, err := attendanceLog.Get(currentBranch(c).ID, c.Param("checkin"))
+	if err != nil {
+		catalogueError(c, err)
+		return
+	}
+	principal, _ := auth.GetPrincipal(c)
+	if principal == nil || !accessPolicy.CanCheckIn(principal, checkIn.UserDID) {
+		auth.Forbid(c, fmt.Sprintf("not allowed to read check-ins of %s", checkIn.UserDID))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Check-in",
+		"data":    checkIn,
+	})
+}
+
+// APIConfirmAttendance confirms a member attended once their session has started and
+// queues the reward transfer. Confirming a check-in whose transfer failed before the
+// contract ran retries it; transfers that may have run are resolved instead.
+func APIConfirmAttendance(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	var req ConfirmAttendanceRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		log.Warn("invalid request body", "error", err)
+		return
+	}
+	branch := currentBranch(c)
+	checkIn, err := attendanceLog.Get(branch.ID, c.Param("checkin"))
+	if err != nil {
+		catalogueError(c, err)
+		return
+	}
+	log = log.With("check_in_id", checkIn.ID, "admin_did", req.AdminDID, "branch", branch.ID)
+	if !authorizeDID(c, req.AdminDID) || !authorizeBranchAdmin(c, req.AdminDID) {
+		return
+	}
+	if time.Now().Before(checkIn.Session.Start) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("session %d of %s hasn't started yet", checkIn.Session.Index, checkIn.ActivityID)})
+		return
+	}
+	entry := startAudit(c, audit.ActionConfirmAttendance, req.AdminDID, gin.H{"check_in_id": checkIn.ID, "admin_did": req.AdminDID})
+	defer finishAudit(ctx, entry)
+	principal, _ := auth.GetPrincipal(c)
+	checkIn, err = attendanceLog.Confirm(branch.ID, checkIn.ID, principal.Subject, req.AdminDID)
+	if err != nil {
+		entry.Error = err.Error()
+		catalogueError(c, err)
+		return
+	}
+	entry.Result = audit.ResultSuccess
+	rewardTransfers.notify()
+	log.Info("attendance confirmed, reward transfer queued", "user_did", checkIn.UserDID)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Attendance confirmed, reward transfer queued",
+		"data":    checkIn,
+	})
+}
+
+// APIRejectAttendance records that a checked in member didn't attend
+func APIRejectAttendance(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req RejectAttendanceRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		logger.FromContext(ctx).Warn("invalid request body", "error", err)
+		return
+	}
+	branch := currentBranch(c)
+	checkIn, err := attendanceLog.Get(branch.ID, c.Param("checkin"))
+	if err != nil {
+		catalogueError(c, err)
+		return
+	}
+	entry := startAudit(c, audit.ActionRejectAttendance, checkIn.UserDID, gin.H{"check_in_id": checkIn.ID, "reason": req.Reason})
+	defer finishAudit(ctx, entry)
+	principal, _ := auth.GetPrincipal(c)
+	checkIn, err = attendanceLog.Reject(branch.ID, checkIn.ID, principal.Subject, req.Reason)
+	if err != nil {
+		entry.Error = err.Error()
+		catalogueError(c, err)
+		return
+	}
+	entry.Result = audit.ResultSuccess
+	logger.FromContext(ctx).Info("attendance rejected", "check_in_id", checkIn.ID, "branch", branch.ID, "reason", req.Reason)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Attendance rejected",
+		"data":    checkIn,
+	})
+}
+
+// ResolveTransferRequest reports what staff found on chain for an unconfirmed transfer
+type ResolveTransferRequest struct {
+	Transferred bool `json:"transferred"`
+}
+
+// APIResolveTransfer settles a transfer that may or may not have run: marked transferred
+// when the tokens moved, otherwise failed so confirming the check-in again retries it
+func APIResolveTransfer(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req ResolveTransferRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		logger.FromContext(ctx).Warn("invalid request body", "error", err)
+		return
+	}
+	branch := currentBranch(c)
+	entry := startAudit(c, audit.ActionResolveTransfer, "", gin.H{"check_in_id": c.Param("checkin"), "transferred": req.Transferred})
+	defer finishAudit(ctx, entry)
+	checkIn, err := attendanceLog.ResolveTransfer(branch.ID, c.Param("checkin"), req.Transferred)
+	if err != nil {
+		entry.Error = err.Error()
+		catalogueError(c, err)
+		return
+	}
+	entry.RubixRequestID = checkIn.Transfer.RubixRequestID
+	entry.Result = audit.ResultSuccess
+	logger.FromContext(ctx).Info("reward transfer resolved", "check_in_id", checkIn.ID, "branch", branch.ID, "transfer", checkIn.Transfer.Status)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Reward transfer resolved",
+		"data":    checkIn,
+	})
+}
+
+// transferQueue runs queued reward transfers one at a time. The attendance log is the
+// queue, so transfers queued before a restart still run.
+type transferQueue struct {
+	wake chan struct{}
+}
+
+// notify makes the queue look for work now instead of at the next sweep
+func (q *transferQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run confirms ended sessions when the automatic rule is on and runs queued transfers,
+// every interval and whenever notified, until ctx is cancelled
+func (q *transferQueue) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		confirmEndedSessions(ctx)
+		runQueuedTransfers(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// systemAudit starts an audit entry for work done outside a request
+func systemAudit(ctx context.Context, action string, actor string, did string, branch string, payload interface{}) *audit.Entry {
+	return &audit.Entry{
+		Action:        action,
+		Actor:         actor,
+		AuthMethod:    attendanceAuthMethod,
+		DID:           did,
+		Branch:        branch,
+		PayloadSHA256: audit.HashPayload(payload),
+		Result:        audit.ResultFailure,
+		RequestID:     logger.RequestID(ctx),
+	}
+}
+
+// confirmEndedSessions confirms everyone still checked in to a session that has ended
+func confirmEndedSessions(ctx context.Context) {
+	cfg, err := config.GetConfig()
+	if err != nil || !cfg.Attendance.AutoConfirm {
+		return
+	}
+	for _, checkIn := range attendanceLog.Ended(time.Now()) {
+		log := slog.With("check_in_id", checkIn.ID, "branch", checkIn.Branch)
+		branch, exists := config.GetBranch(cfg, checkIn.Branch)
+		if !exists {
+			log.Warn("check-in belongs to a branch that is no longer configured")
+			continue
+		}
+		signer, exists := config.GetRewardSigner(cfg, branch)
+		if !exists {
+			log.Warn("no DID to sign the reward transfer, attendance left for staff to confirm")
+			continue
+		}
+		entry := systemAudit(ctx, audit.ActionConfirmAttendance, attendanceActor, signer, checkIn.Branch, gin.H{"check_in_id": checkIn.ID, "admin_did": signer})
+		if _, err := attendanceLog.Confirm(checkIn.Branch, checkIn.ID, attendanceActor, signer); err != nil {
+			log.Error("failed to confirm attendance", "error", err)
+			entry.Error = err.Error()
+		} else {
+			log.Info("attendance confirmed at session end, reward transfer queued", "user_did", checkIn.UserDID)
+			entry.Result = audit.ResultSuccess
+		}
+		finishAudit(ctx, entry)
+	}
+}
+
+// runQueuedTransfers runs every queued transfer, oldest first
+func runQueuedTransfers(ctx context.Context) {
+	queued := attendanceLog.Queued()
+	for range queued {
+		metrics.JobQueued("reward_transfer")
+	}
+	for _, checkIn := range queued {
+		if ctx.Err() == nil {
+			transferCheckInReward(checkIn)
+		}
+		metrics.JobDone("reward_transfer")
+	}
+}
+
+// transferCheckInReward pays a confirmed check-in's reward and links the transfer to it.
+// Started transfers finish even during shutdown, which waits for them, and none start once it does.
+func transferCheckInReward(checkIn catalogue.CheckIn) {
+	ctx := logger.WithRequestID(context.Background(), "checkin-"+checkIn.ID)
+	log := logger.FromContext(ctx).With("check_in_id", checkIn.ID, "activity_id", checkIn.ActivityID,
+		"user_did", checkIn.UserDID, "admin_did", checkIn.Transfer.AdminDID, "branch", checkIn.Branch)
+	done, err := trackJob()
+	if err != nil {
+		log.Info("not starting the reward transfer during shutdown, leaving it queued")
+		return
+	}
+	defer done()
+	// Saved before the contract runs: a transfer found sending at startup may have paid already
+	if _, err := attendanceLog.StartTransfer(checkIn.ID); err != nil {
+		log.Error("failed to mark the reward transfer as sending, leaving it queued", "error", err)
+		return
+	}
+	entry := systemAudit(ctx, audit.ActionTransferReward, checkIn.ConfirmedBy, checkIn.Transfer.AdminDID, checkIn.Branch, TransferRewardRequest{
+		ActivityID: checkIn.ActivityID,
+		UserDID:    checkIn.UserDID,
+		AdminDID:   checkIn.Transfer.AdminDID,
+	})
+	executed := func(rubixRequestID string) {
+		if _, err := attendanceLog.RecordTransferRequest(checkIn.ID, rubixRequestID); err != nil {
+			log.Error("failed to save the transfer's Rubix request ID", "rubix_request_id", rubixRequestID, "error", err)
+		}
+	}
+	var rewardAmount float64
+	cfg, err := config.GetConfig()
+	if err == nil {
+		branch, exists := config.GetBranch(cfg, checkIn.Branch)
+		if !exists {
+			err = fmt.Errorf("branch %s is no longer configured", checkIn.Branch)
+			entry.Error = err.Error()
+		} else {
+			transferCtx, cancel := context.WithTimeout(ctx, config.GetTransferTimeout(cfg))
+			rewardAmount, err = transferRewardOnChain(transferCtx, entry, branch, checkIn.Transfer.AdminDID, checkIn.UserDID, checkIn.ActivityID, executed)
+			cancel()
+		}
+	}
+	finishAudit(ctx, entry)
+	if err != nil {
+		log.Error("failed to transfer check-in reward", "rubix_request_id", entry.RubixRequestID, "error", err)
+	}
+	if _, err := attendanceLog.FinishTransfer(checkIn.ID, entry.RubixRequestID, rewardAmount, err); err != nil {
+		log.Error("reward transfer ran but the check-in wasn't updated", "rubix_request_id", entry.RubixRequestID, "error", err)
+	}
+}
+
+// recoverTransfers flags transfers a previous run left sending. They may have paid
+// already, so they wait for staff to check the chain instead of running again.
+func recoverTransfers() {
+	recovered, err := attendanceLog.RecoverInterrupted()
+	if err != nil {
+		slog.Error("failed to flag interrupted reward transfers", "error", err)
+	}
+	for _, checkIn := range recovered {
+		slog.Warn("reward transfer was interrupted, check the chain and resolve it",
+			"check_in_id", checkIn.ID, "branch", checkIn.Branch, "user_did", checkIn.UserDID, "rubix_request_id", checkIn.Transfer.RubixRequestID)
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"dapp-server/audit"
+	"dapp-server/auth"
+	"dapp-server/config"
+	"dapp-server/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditLog records privileged actions; BootupServer opens it
+var auditLog *audit.Log
+
+// startAudit begins the audit entry for a privileged action. The handler fills in what it
+// learns and finishes it with finishAudit, usually deferred so every exit path is recorded;
+// entries not marked successful are recorded as failures.
+func startAudit(c *gin.Context, action string, did string, payload interface{}) *audit.Entry {
+	entry := &audit.Entry{
+		Action:        action,
+		DID:           did,
+		PayloadSHA256: audit.HashPayload(payload),
+		Result:        audit.ResultFailure,
+		RequestID:     logger.RequestID(c.Request.Context()),
+	}
+	if branch, exists := c.Get(branchKey); exists {
+		entry.Branch = branch.(config.Branch).ID
+	}
+	if principal, exists := auth.GetPrincipal(c); exists {
+		entry.Actor = principal.Subject
+		entry.AuthMethod = principal.Method
+	}
+	return entry
+}
+
+// finishAudit appends the entry to the audit log. It takes a context rather than the gin
+// context so work finishing after the response, like async deployments, can still record.
+func finishAudit(ctx context.Context, entry *audit.Entry) {
+	if auditLog == nil {
+		return
+	}
+	if entry.Result == audit.ResultFailure && entry.Error == "" {
+		entry.Error = "action did not complete"
+	}
+	if _, err := auditLog.Append(*entry); err != nil {
+		logger.FromContext(ctx).Error("failed to write audit entry", "action", entry.Action, "error", err)
+	}
+}
+
+// APIListAudit returns audit entries filtered by actor, did, branch, action, result, since, until (RFC 3339) and limit.
+// Callers limited to some branches only see those branches' entries.
+func APIListAudit(c *gin.Context) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	filter := audit.Filter{
+		Actor:  c.Query("actor"),
+		DID:    c.Query("did"),
+		Branch: c.Query("branch"),
+		Action: c.Query("action"),
+		Result: c.Query("result"),
+	}
+	filter.Branches = accessibleBranches(c, cfg)
+	if filter.Branch != "" && filter.Branches != nil && !slices.Contains(filter.Branches, filter.Branch) {
+		auth.Forbid(c, fmt.Sprintf("not allowed to report on branch %s", filter.Branch))
+		return
+	}
+	for param, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC 3339 time"})
+			return
+		}
+		*target = parsed
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a non-negative integer"})
+			return
+		}
+		filter.Limit = limit
+	}
+	if auditLog == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "audit log is not open"})
+		return
+	}
+
+	entries, err := auditLog.Query(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Audit entries",
+		"data":    entries,
+	})
+}
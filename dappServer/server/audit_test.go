@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"dapp-server/audit"
+	"dapp-server/auth"
+)
+
+func TestAPIListAudit(t *testing.T) {
+	dir := loadTestConfig(t, `
+[branches.north]
+name = "North"
+
+[branches.south]
+name = "South"
+`)
+	log, err := audit.Open(filepath.Join(dir, "audit.jsonl"), []byte("audit key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := auditLog
+	auditLog = log
+	t.Cleanup(func() { auditLog = previous })
+	for _, entry := range []audit.Entry{
+		{Actor: "north-admin", Action: audit.ActionAddActivity, Branch: "north", Result: audit.ResultSuccess},
+		{Actor: "north-admin", Action: audit.ActionTransferReward, Branch: "north", Result: audit.ResultFailure},
+		{Actor: "south-admin", Action: audit.ActionAddActivity, Branch: "south", Result: audit.ResultSuccess},
+	} {
+		if _, err := log.Append(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := &auth.Principal{Subject: "root", Method: auth.MethodJWT, Roles: []string{auth.RoleAdmin}}
+	northAdmin := &auth.Principal{Subject: "north-admin", Method: auth.MethodJWT, Roles: []string{auth.RoleAdmin}, Branches: []string{"north"}}
+
+	tests := []struct {
+		name        string
+		query       string
+		principal   *auth.Principal
+		wantStatus  int
+		wantEntries int
+	}{
+		{name: "association admin", principal: root, wantStatus: http.StatusOK, wantEntries: 3},
+		{name: "branch admin sees its branch", principal: northAdmin, wantStatus: http.StatusOK, wantEntries: 2},
+		{name: "branch admin asking for another branch", query: "?branch=south", principal: northAdmin, wantStatus: http.StatusForbidden},
+		{name: "filtered", query: "?action=add_activity&result=success", principal: root, wantStatus: http.StatusOK, wantEntries: 2},
+		{name: "limited", query: "?limit=1", principal: root, wantStatus: http.StatusOK, wantEntries: 1},
+		{name: "bad since", query: "?since=yesterday", principal: root, wantStatus: http.StatusBadRequest},
+		{name: "negative limit", query: "?limit=-1", principal: root, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := doRequest(http.MethodGet, "/api/audit", "/api/audit"+tt.query, "", tt.principal, APIListAudit)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("audit = %d %s, want %d", recorder.Code, recorder.Body, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response struct {
+				Data []audit.Entry `json:"data"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Data) != tt.wantEntries {
+				t.Fatalf("audit returned %d entries, want %d", len(response.Data), tt.wantEntries)
+			}
+			for _, entry := range response.Data {
+				if tt.principal == northAdmin && entry.Branch != "north" {
+					t.Fatalf("branch admin saw an entry of branch %q", entry.Branch)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"dapp-server/audit"
+	"dapp-server/auth"
+	"dapp-server/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BranchHeader selects the branch a request acts for when the route doesn't name one
+const BranchHeader = "X-Branch"
+
+// Key the request's branch is stored under in the gin context
+const branchKey = "branch"
+
+// BranchReport summarises a branch's activities and rewards
+type BranchReport struct {
+	Branch             string `json:"branch"`
+	Name               string `json:"name,omitempty"`
+	Activities         int    `json:"activities"`
+	RewardPoints       int    `json:"reward_points"`       // Points offered across the branch's activities
+	RewardsTransferred int    `json:"rewards_transferred"` // Successful reward transfers in the audit log
+	Error              string `json:"error,omitempty"`
+}
+
+// branchScope resolves the branch a request acts for, from the :branch route parameter or
+// the X-Branch header, and refuses callers that don't work for it
+func branchScope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("branch")
+		if id == "" {
+			id = c.GetHeader(BranchHeader)
+		}
+		cfg, err := config.GetConfig()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		branch, exists := config.GetBranch(cfg, id)
+		if !exists {
+			if id == "" {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "a branch is required, name it in the route or the " + BranchHeader + " header"})
+			} else {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("branch %s is not configured", id)})
+			}
+			return
+		}
+		principal, exists := auth.GetPrincipal(c)
+		if !exists || !accessPolicy.CanAccessBranch(principal, branch.ID) {
+			auth.Forbid(c, fmt.Sprintf("not allowed to act for branch %s", branch.ID))
+			return
+		}
+		c.Set(branchKey, branch)
+		c.Next()
+	}
+}
+
+// currentBranch returns the branch resolved by branchScope
+func currentBranch(c *gin.Context) config.Branch {
+	branch, _ := c.Get(branchKey)
+	resolved, _ := branch.(config.Branch)
+	return resolved
+}
+
+// authorizeBranchAdmin refuses the request unless did administers the request's branch
+func authorizeBranchAdmin(c *gin.Context, did string) bool {
+	branch := currentBranch(c)
+	if !config.IsBranchAdmin(branch, did) {
+		auth.Forbid(c, fmt.Sprintf("%s is not an admin of branch %s", did, branch.ID))
+		return false
+	}
+	return true
+}
+
+// authorizeContractBranch refuses the request unless the caller may work for the branch
+// owning the contract, which then becomes the request's branch for the audit log
+func authorizeContractBranch(c *gin.Context, cfg *config.Config, contractHash string) bool {
+	branch, exists := config.GetBranchByContract(cfg, contractHash)
+	if !exists {
+		return true
+	}
+	principal, _ := auth.GetPrincipal(c)
+	if principal == nil || !accessPolicy.CanAccessBranch(principal, branch.ID) {
+		auth.Forbid(c, fmt.Sprintf("contract %s belongs to branch %s", contractHash, branch.ID))
+		return false
+	}
+	c.Set(branchKey, branch)
+	return true
+}
+
+// authorizeDIDBranch refuses the request unless did is free of branches or administers one
+// the caller may work for, so admins limited to a branch can't sign as another branch's admin
+func authorizeDIDBranch(c *gin.Context, cfg *config.Config, did string) bool {
+	branches := config.GetBranchesByAdmin(cfg, did)
+	if len(branches) == 0 {
+		return true
+	}
+	principal, _ := auth.GetPrincipal(c)
+	for _, branch := range branches {
+		if principal != nil && accessPolicy.CanAccessBranch(principal, branch.ID) {
+			if _, exists := c.Get(branchKey); !exists {
+				c.Set(branchKey, branch)
+			}
+			return true
+		}
+	}
+	auth.Forbid(c, fmt.Sprintf("%s administers branch %s", did, branches[0].ID))
+	return false
+}
+
+// accessibleBranches returns the branches the caller may report on, or nil when it may report on all of them
+func accessibleBranches(c *gin.Context, cfg *config.Config) []string {
+	principal, _ := auth.GetPrincipal(c)
+	all := config.ListBranches(cfg)
+	branches := []string{}
+	for _, branch := range all {
+		if principal != nil && accessPolicy.CanAccessBranch(principal, branch.ID) {
+			branches = append(branches, branch.ID)
+		}
+	}
+	if len(branches) == len(all) {
+		return nil
+	}
+	return branches
+}
+
+// APIListBranches reports on every branch the caller works for, across the whole association for its admins
+func APIListBranches(c *gin.Context) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	principal, _ := auth.GetPrincipal(c)
+	reports := []BranchReport{}
+	for _, branch := range config.ListBranches(cfg) {
+		if principal != nil && accessPolicy.CanAccessBranch(principal, branch.ID) {
+			reports = append(reports, reportBranch(branch))
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Branch reports",
+		"data":    reports,
+	})
+}
+
+// APIGetBranch reports on the branch named in the route
+func APIGetBranch(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Branch report",
+		"data":    reportBranch(currentBranch(c)),
+	})
+}
+
+func reportBranch(branch config.Branch) BranchReport {
+	report := BranchReport{Branch: branch.ID, Name: branch.Name}
+	activities, err := readActivities(branch.ActivityUpdatePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		report.Error = err.Error()
+	}
+	report.Activities = len(activities)
+	for _, activity := range activities {
+		report.RewardPoints += activity.RewardPoints
+	}
+	if auditLog != nil {
+		transfers, err := auditLog.Query(audit.Filter{Branch: branch.ID, Action: audit.ActionTransferReward, Result: audit.ResultSuccess})
+		if err != nil {
+			report.Error = err.Error()
+		}
+		report.RewardsTransferred = len(transfers)
+	}
+	return report
+}
+
+// readActivities reads the activities recorded in an activity store
+func readActivities(filePath string) ([]Activity, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var activities []Activity
+	if err := json.Unmarshal(data, &activities); err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
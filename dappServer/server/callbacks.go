@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"dapp-server/config"
+	"dapp-server/logger"
+	"dapp-server/metrics"
+	rubix_interaction "dapp-server/rubix-interaction"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Largest callback body accepted, callbacks only carry a port and a contract hash
+const maxCallbackBody = 64 << 10
+
+// VerifyCallback admits node callbacks only from a configured node's address, for contracts
+// in the registry and, with a callback secret configured, carrying a valid token or signature.
+// The body is left in place for the handler.
+func VerifyCallback() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxCallbackBody))
+		if err != nil {
+			rejectCallback(c, http.StatusBadRequest, "unreadable_body", err.Error())
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var req ContractInputRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			rejectCallback(c, http.StatusBadRequest, "invalid_body", "Invalid request body")
+			return
+		}
+		cfg, err := config.GetConfig()
+		if err != nil {
+			rejectCallback(c, http.StatusInternalServerError, "config", err.Error())
+			return
+		}
+		// Callbacks only name a port, the node is the one on that port the request came from
+		nodes := config.GetNodesByPort(cfg, req.Port)
+		if len(nodes) == 0 {
+			rejectCallback(c, http.StatusForbidden, "unknown_node", "no node configured on port "+req.Port)
+			return
+		}
+		index := slices.IndexFunc(nodes, func(node config.Node) bool {
+			return callbackOriginAllowed(c.Request.Context(), node, c.RemoteIP())
+		})
+		if index < 0 {
+			rejectCallback(c, http.StatusForbidden, "origin", "callback did not come from a node on port "+req.Port)
+			return
+		}
+		node := nodes[index]
+		if _, exists := config.GetContractByHash(cfg, req.SmartContractHash); !exists {
+			rejectCallback(c, http.StatusForbidden, "unregistered_contract", "contract is not in the contract registry")
+			return
+		}
+		if secret := config.GetCallbackSecret(cfg); secret != nil && !callbackAuthentic(c, secret, req.SmartContractHash, body) {
+			rejectCallback(c, http.StatusUnauthorized, "bad_token", "missing or invalid callback token")
+			return
+		}
+		c.Set(callbackNodeKey, node)
+		c.Next()
+	}
+}
+
+// Context key of the node VerifyCallback matched a callback to
+const callbackNodeKey = "callback_node"
+
+// callbackNode returns the node a verified callback came from
+func callbackNode(c *gin.Context) (config.Node, bool) {
+	node, exists := c.Get(callbackNodeKey)
+	resolved, ok := node.(config.Node)
+	return resolved, exists && ok
+}
+
+func rejectCallback(c *gin.Context, status int, reason string, message string) {
+	metrics.CallbackRejected(reason)
+	logger.FromContext(c.Request.Context()).Warn("callback rejected",
+		"reason", reason,
+		"detail", message,
+		"remote_ip", c.RemoteIP(),
+		"path", c.Request.URL.Path,
+	)
+	c.AbortWithStatusJSON(status, gin.H{"error": message})
+}
+
+// callbackOriginAllowed reports whether remoteIP is one of the addresses the node's callbacks may come from
+func callbackOriginAllowed(ctx context.Context, node config.Node, remoteIP string) bool {
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return false
+	}
+	if len(node.CallbackOrigins) > 0 {
+		for _, origin := range node.CallbackOrigins {
+			if _, network, err := net.ParseCIDR(origin); err == nil {
+				if network.Contains(ip) {
+					return true
+				}
+			} else if allowed := net.ParseIP(origin); allowed != nil && allowed.Equal(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	if config.IsLocalNode(node) {
+		return ip.IsLoopback()
+	}
+
+	nodeURL, err := url.Parse(config.GetNodeURL(node))
+	if err != nil {
+		return false
+	}
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, nodeURL.Hostname())
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to resolve node host", "node", node.Name, "error", err)
+		return false
+	}
+	for _, address := range addresses {
+		if address.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// callbackAuthentic checks the contract's callback token, or an HMAC of the body for nodes that sign callbacks
+func callbackAuthentic(c *gin.Context, secret []byte, contractHash string, body []byte) bool {
+	if signature := c.GetHeader(rubix_interaction.CallbackSignatureHeader); signature != "" {
+		provided, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(body)
+		return hmac.Equal(provided, mac.Sum(nil))
+	}
+	token := c.Query(rubix_interaction.CallbackTokenParam)
+	expected := rubix_interaction.CallbackToken(secret, contractHash)
+	return token != "" && hmac.Equal([]byte(token), []byte(expected))
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	rubix "dapp-server/rubix-interaction"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Callback test config. httptest requests come from 192.0.2.1, which only node1 admits.
+const callbackTestConfig = `
+[callbacks]
+secret_env = "DAPP_TEST_CALLBACK_SECRET"
+
+[nodes.node1]
+name = "node1"
+port = "20000"
+did = "did:node1"
+url = "http://node1.example.org:20000"
+callback_origins = ["192.0.2.0/24"]
+
+[nodes.node2]
+name = "node2"
+port = "20001"
+did = "did:node2"
+url = "http://node2.example.org:20001"
+callback_origins = ["10.0.0.1"]
+
+[nodes.node3]
+name = "node3"
+port = "20002"
+did = "did:node3"
+
+[contracts.activity]
+name = "activity"
+hash = "QmContract"
+`
+
+func TestVerifyCallback(t *testing.T) {
+	loadTestConfig(t, callbackTestConfig)
+	const secret = "callback secret"
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	validBody := `{"port": "20000", "smart_contract_hash": "QmContract"}`
+	validToken := rubix.CallbackToken([]byte(secret), "QmContract")
+
+	tests := []struct {
+		name       string
+		secret     string
+		body       string
+		token      string
+		signature  string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "configured node without a secret", body: validBody, wantStatus: http.StatusOK},
+		{name: "valid token", secret: secret, body: validBody, token: validToken, wantStatus: http.StatusOK},
+		{name: "valid signature", secret: secret, body: validBody, signature: sign(validBody), wantStatus: http.StatusOK},
+		{name: "invalid body", body: `{"port":`, wantStatus: http.StatusBadRequest, wantError: "Invalid request body"},
+		{name: "no node on the port", body: `{"port": "30000", "smart_contract_hash": "QmContract"}`, wantStatus: http.StatusForbidden, wantError: "no node configured on port 30000"},
+		{name: "origin not listed", body: `{"port": "20001", "smart_contract_hash": "QmContract"}`, wantStatus: http.StatusForbidden, wantError: "did not come from a node"},
+		{name: "local node from another host", body: `{"port": "20002", "smart_contract_hash": "QmContract"}`, wantStatus: http.StatusForbidden, wantError: "did not come from a node"},
+		{name: "unregistered contract", body: `{"port": "20000", "smart_contract_hash": "QmOther"}`, wantStatus: http.StatusForbidden, wantError: "not in the contract registry"},
+		{name: "missing token", secret: secret, body: validBody, wantStatus: http.StatusUnauthorized, wantError: "missing or invalid callback token"},
+		{name: "token of another contract", secret: secret, body: validBody, token: rubix.CallbackToken([]byte(secret), "QmOther"), wantStatus: http.StatusUnauthorized},
+		{name: "signature of another body", secret: secret, body: validBody, signature: sign(`{"port": "20000"}`), wantStatus: http.StatusUnauthorized},
+		{name: "malformed signature", secret: secret, body: validBody, signature: "sha256=zz", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DAPP_TEST_CALLBACK_SECRET", tt.secret)
+			var handled string
+			router := gin.New()
+			router.POST("/callback", VerifyCallback(), func(c *gin.Context) {
+				node, _ := callbackNode(c)
+				body, _ := io.ReadAll(c.Request.Body)
+				handled = node.Name + " " + string(body)
+				c.Status(http.StatusOK)
+			})
+			path := "/callback"
+			if tt.token != "" {
+				path += "?" + rubix.CallbackTokenParam + "=" + tt.token
+			}
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(tt.body))
+			if tt.signature != "" {
+				req.Header.Set(rubix.CallbackSignatureHeader, tt.signature)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus || !strings.Contains(recorder.Body.String(), tt.wantError) {
+				t.Fatalf("callback = %d %s, want %d with %q", recorder.Code, recorder.Body, tt.wantStatus, tt.wantError)
+			}
+			if tt.wantStatus == http.StatusOK && handled != "node1 "+tt.body {
+				t.Fatalf("handler saw %q, want node1 and the unread body", handled)
+			}
+			if tt.wantStatus != http.StatusOK && handled != "" {
+				t.Fatal("handler ran for a rejected callback")
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"dapp-server/auth"
+	"dapp-server/logger"
+	rubix "dapp-server/rubix-interaction"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How long a finished deployment's events stay available for late subscribers
+const deploymentRetention = time.Hour
+
+// How long an event stream token is accepted. EventSource can't send headers, so browsers
+// following a deployment pass this token in the URL instead.
+const streamTokenTTL = 15 * time.Minute
+
+// StreamTokenParam is the query parameter carrying an event stream token
+const StreamTokenParam = "token"
+
+// DeploymentEvent is one update in a deployment's progress stream
+type DeploymentEvent struct {
+	Type    string      `json:"type"` // stage, log, node_response, error or done
+	Stage   string      `json:"stage,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Time    time.Time   `json:"time"`
+}
+
+// deployment records the events of a single deployment so they can be replayed to subscribers
+type deployment struct {
+	deployer    string // Subject of the caller that started the deployment
+	deployerDID string
+	branch      string // Branch the deployer DID administers, empty when it has none
+	mu          sync.Mutex
+	events      []DeploymentEvent
+	done        bool
+	changed     chan struct{} // Closed and replaced whenever an event is published
+}
+
+// canFollow reports whether principal may follow the deployment: the caller that started
+// it may, and so may callers working for its branch
+func (d *deployment) canFollow(principal *auth.Principal) bool {
+	if principal == nil {
+		return false
+	}
+	if principal.Subject == d.deployer {
+		return true
+	}
+	return d.branch != "" && accessPolicy.CanAccessBranch(principal, d.branch)
+}
+
+func (d *deployment) publish(event DeploymentEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.done {
+		return
+	}
+	event.Time = time.Now()
+	d.events = append(d.events, event)
+	if event.Type == "done" || event.Type == "error" {
+		d.done = true
+	}
+	close(d.changed)
+	d.changed = make(chan struct{})
+}
+
+// since returns the events after index next, whether the deployment has finished,
+// and a channel that is closed when more events arrive
+func (d *deployment) since(next int) ([]DeploymentEvent, bool, <-chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.events[next:], d.done, d.changed
+}
+
+// hooks adapts the deployment into the callbacks rubix.Deploy reports progress through
+func (d *deployment) hooks() rubix.DeployHooks {
+	return rubix.DeployHooks{
+		OnStage: func(stage rubix.DeploymentStage) {
+			d.publish(DeploymentEvent{Type: "stage", Stage: stage.String()})
+		},
+		OnNodeResponse: func(endpoint string, response string) {
+			d.publish(DeploymentEvent{Type: "node_response", Message: endpoint, Data: response})
+		},
+		BuildLog: deploymentLogWriter{d},
+	}
+}
+
+// deploymentLogWriter turns build output into log events
+type deploymentLogWriter struct {
+	d *deployment
+}
+
+func (w deploymentLogWriter) Write(p []byte) (int, error) {
+	w.d.publish(DeploymentEvent{Type: "log", Message: string(p)})
+	return len(p), nil
+}
+
+// debugLogWriter sends build output to a log at debug level, one record per line
+type debugLogWriter struct {
+	log *slog.Logger
+}
+
+func (w debugLogWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line != "" {
+			w.log.Debug("build output", "line", line)
+		}
+	}
+	return len(p), nil
+}
+
+// deploymentTracker keeps the deployments started by this server
+type deploymentTracker struct {
+	mu          sync.Mutex
+	deployments map[string]*deployment
+	tokens      map[string]streamToken // Event stream tokens by their value
+}
+
+// streamToken lets its holder follow one deployment's events as the principal it was issued to
+type streamToken struct {
+	deploymentID string
+	principal    auth.Principal
+	expires      time.Time
+}
+
+var deployments = &deploymentTracker{deployments: make(map[string]*deployment), tokens: make(map[string]streamToken)}
+
+// issueToken creates an event stream token for a deployment, acting as principal
+func (t *deploymentTracker) issueToken(id string, principal *auth.Principal) (string, time.Time) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}
+	}
+	token := hex.EncodeToString(b)
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for value, issued := range t.tokens {
+		if now.After(issued.expires) {
+			delete(t.tokens, value)
+		}
+	}
+	issued := streamToken{deploymentID: id, principal: *principal, expires: now.Add(streamTokenTTL)}
+	issued.principal.Method = auth.MethodStreamToken
+	t.tokens[token] = issued
+	return token, issued.expires
+}
+
+// Authenticate accepts an event stream token, only on the events route of its own deployment
+func (t *deploymentTracker) Authenticate(r *http.Request) (*auth.Principal, error) {
+	token := r.URL.Query().Get(StreamTokenParam)
+	if token == "" {
+		return nil, auth.ErrNoCredentials
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for value, issued := range t.tokens {
+		if subtle.ConstantTimeCompare([]byte(value), []byte(token)) != 1 {
+			continue
+		}
+		if time.Now().After(issued.expires) || r.URL.Path != eventsPath(issued.deploymentID) {
+			break
+		}
+		principal := issued.principal
+		return &principal, nil
+	}
+	return nil, errors.New("invalid or expired stream token")
+}
+
+// eventsPath is the route streaming a deployment's events
+func eventsPath(id string) string {
+	return fmt.Sprintf("/api/deploy/%s/events", id)
+}
+
+func (t *deploymentTracker) start(deployer string, deployerDID string, branch string) (string, *deployment) {
+	id := newDeploymentID()
+	d := &deployment{deployer: deployer, deployerDID: deployerDID, branch: branch, changed: make(chan struct{})}
+	t.mu.Lock()
+	t.deployments[id] = d
+	t.mu.Unlock()
+	return id, d
+}
+
+func (t *deploymentTracker) get(id string) (*deployment, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d, exists := t.deployments[id]
+	return d, exists
+}
+
+// finish publishes the final event and schedules the deployment for removal
+func (t *deploymentTracker) finish(id string, d *deployment, event DeploymentEvent) {
+	d.publish(event)
+	time.AfterFunc(deploymentRetention, func() {
+		t.mu.Lock()
+		delete(t.deployments, id)
+		t.mu.Unlock()
+	})
+}
+
+func newDeploymentID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return hex.EncodeToString([]byte(time.Now().Format(time.RFC3339Nano)))
+	}
+	return hex.EncodeToString(b)
+}
+
+// APIDeploymentStreamToken issues a token for following a deployment's events with EventSource
+func APIDeploymentStreamToken(c *gin.Context) {
+	id := c.Param("id")
+	d, exists := deployments.get(id)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+	principal, _ := auth.GetPrincipal(c)
+	if principal == nil {
+		auth.Forbid(c, "no caller to issue a stream token to")
+		return
+	}
+	if !d.canFollow(principal) {
+		auth.Forbid(c, "deployment was started by another caller")
+		return
+	}
+	token, expires := deployments.issueToken(id, principal)
+	if token == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create a stream token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Stream token issued",
+		"data": gin.H{
+			"token":      token,
+			"expires_at": expires,
+			"events_url": eventsPath(id) + "?" + StreamTokenParam + "=" + token,
+		},
+	})
+}
+
+// APIDeploymentEvents streams a deployment's progress as Server-Sent Events.
+// Events already published are replayed first, so subscribing late loses nothing.
+func APIDeploymentEvents(c *gin.Context) {
+	d, exists := deployments.get(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+	if principal, _ := auth.GetPrincipal(c); !d.canFollow(principal) {
+		logger.FromContext(c.Request.Context()).Warn("refusing deployment stream", "deployment_id", c.Param("id"), "deployer_did", d.deployerDID, "branch", d.branch)
+		auth.Forbid(c, "deployment was started by another caller")
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	next := 0
+	c.Stream(func(w io.Writer) bool {
+		events, done, changed := d.since(next)
+		for _, event := range events {
+			c.SSEvent(event.Type, event)
+		}
+		next += len(events)
+		if len(events) > 0 {
+			return true
+		}
+		if done {
+			return false
+		}
+		select {
+		case <-changed:
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		case <-streams.Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"dapp-server/auth"
+)
+
+func TestAPIDeploymentEventsAccess(t *testing.T) {
+	loadTestConfig(t, "")
+	root := &auth.Principal{Subject: "root", Method: auth.MethodJWT, Roles: []string{auth.RoleAdmin}}
+	northAdmin := &auth.Principal{Subject: "north-admin", Method: auth.MethodJWT, Roles: []string{auth.RoleAdmin}, Branches: []string{"north"}}
+	southAdmin := &auth.Principal{Subject: "south-admin", Method: auth.MethodJWT, Roles: []string{auth.RoleAdmin}, Branches: []string{"south"}}
+
+	northID, north := deployments.start("north-admin", "did:north-admin", "north")
+	deployments.finish(northID, north, DeploymentEvent{Type: "done"})
+	sharedID, shared := deployments.start("root", "did:root", "")
+	deployments.finish(sharedID, shared, DeploymentEvent{Type: "done"})
+
+	tests := []struct {
+		name       string
+		id         string
+		principal  *auth.Principal
+		wantStatus int
+	}{
+		{name: "deployer", id: northID, principal: northAdmin, wantStatus: http.StatusOK},
+		{name: "works for the branch", id: northID, principal: root, wantStatus: http.StatusOK},
+		{name: "other branch", id: northID, principal: southAdmin, wantStatus: http.StatusForbidden},
+		{name: "deployer without a branch", id: sharedID, principal: root, wantStatus: http.StatusOK},
+		{name: "other caller without a branch", id: sharedID, principal: northAdmin, wantStatus: http.StatusForbidden},
+		{name: "unknown deployment", id: "missing", principal: root, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := doRequest(http.MethodGet, "/api/deploy/:id/events", eventsPath(tt.id), "", tt.principal, APIDeploymentEvents)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("events = %d %s, want %d", recorder.Code, recorder.Body, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(recorder.Body.String(), "event:done") {
+				t.Fatalf("events = %s, want the done event", recorder.Body)
+			}
+
+			recorder = doRequest(http.MethodPost, "/api/deploy/:id/events/token", eventsPath(tt.id)+"/token", "", tt.principal, APIDeploymentStreamToken)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("stream token = %d %s, want %d", recorder.Code, recorder.Body, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"dapp-server/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DependencyCheck is the readiness of one thing the server needs to do useful work
+type DependencyCheck struct {
+	Name   string `json:"name"`
+	Ready  bool   `json:"ready"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// APIHealthz reports that the process is alive. It never touches dependencies.
+func APIHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
+
+// APIReadyz reports whether the server can serve requests, with a breakdown per dependency
+func APIReadyz(c *gin.Context) {
+	checks := []DependencyCheck{
+		checkConfigLoaded(),
+		checkEnvContracts(),
+		checkNodesReachable(),
+		checkActivityStore(),
+	}
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.Ready
+	}
+
+	status := http.StatusOK
+	message := "ready"
+	if !ready {
+		status = http.StatusServiceUnavailable
+		message = "not ready"
+	}
+	c.JSON(status, gin.H{
+		"status":       message,
+		"dependencies": checks,
+	})
+}
+
+func checkConfigLoaded() DependencyCheck {
+	check := DependencyCheck{Name: "config"}
+	cfg, err := config.GetConfig()
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	if len(cfg.Nodes) == 0 {
+		check.Detail = "no nodes configured"
+		return check
+	}
+	check.Ready = true
+	check.Detail = fmt.Sprintf("%d nodes configured", len(cfg.Nodes))
+	return check
+}
+
+func checkEnvContracts() DependencyCheck {
+	check := DependencyCheck{Name: "contracts"}
+	cfg, err := config.GetConfig()
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	var missing []string
+	for _, branch := range config.ListBranches(cfg) {
+		prefix := ""
+		if branch.ID != "" {
+			prefix = branch.ID + " "
+		}
+		if branch.AddActivityContract == "" {
+			missing = append(missing, prefix+"add_activity_contract")
+		}
+		if branch.TransferContract == "" {
+			missing = append(missing, prefix+"transfer_contract")
+		}
+	}
+	if len(missing) > 0 {
+		check.Detail = fmt.Sprintf("unset: %v", missing)
+		return check
+	}
+	check.Ready = true
+	return check
+}
+
+func checkNodesReachable() DependencyCheck {
+	check := DependencyCheck{Name: "nodes"}
+	healthy := nodeMonitor.HealthyCount()
+	check.Detail = fmt.Sprintf("%d of %d nodes healthy", healthy, len(nodeMonitor.Status()))
+	check.Ready = healthy > 0
+	return check
+}
+
+// checkActivityStore makes sure every activity file can be written without changing its contents
+func checkActivityStore() DependencyCheck {
+	check := DependencyCheck{Name: "activity_store"}
+	cfg, err := config.GetConfig()
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	paths := config.GetActivityStorePaths(cfg)
+	if len(paths) == 0 {
+		check.Detail = "storage.activity_update_path is not set"
+		return check
+	}
+	for _, path := range paths {
+		if err := probeActivityStore(path); err != nil {
+			check.Detail = fmt.Sprintf("%s: %v", path, err)
+			return check
+		}
+	}
+	check.Ready = true
+	return check
+}
+
+func probeActivityStore(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if os.IsNotExist(err) {
+		// Not created yet, the directory has to accept new files instead
+		probe, err := os.CreateTemp(filepath.Dir(path), ".readyz-*")
+		if err != nil {
+			return err
+		}
+		probe.Close()
+		os.Remove(probe.Name())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"dapp-server/config"
+	rubix "dapp-server/rubix-interaction"
+)
+
+// backgroundJobs counts Rubix jobs and WASM calls that must finish before the server exits
+var backgroundJobs jobTracker
+
+// errShuttingDown is returned for work refused because the server is shutting down
+var errShuttingDown = errors.New("server is shutting down")
+
+// jobTracker counts in-flight jobs. Once draining it refuses new ones, since a WaitGroup
+// must not be added to while it is waited on.
+type jobTracker struct {
+	mu       sync.Mutex
+	draining bool
+	jobs     sync.WaitGroup
+}
+
+// track registers a job and returns the function marking it done, or errShuttingDown once draining
+func (t *jobTracker) track() (func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return nil, errShuttingDown
+	}
+	t.jobs.Add(1)
+	return t.jobs.Done, nil
+}
+
+// drain refuses new jobs and blocks until the tracked ones are done or ctx expires
+func (t *jobTracker) drain(ctx context.Context) error {
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.jobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("background jobs did not finish: %w", ctx.Err())
+	}
+}
+
+// trackJob registers in-flight work with shutdown and returns the function marking it done.
+// It fails once shutdown has started waiting for jobs.
+func trackJob() (func(), error) {
+	return backgroundJobs.track()
+}
+
+// streams is cancelled when shutdown starts, ending event streams that would otherwise
+// keep their connections active until the shutdown timeout
+var streams, closeStreams = context.WithCancel(context.Background())
+
+// serve runs srv until ctx is cancelled, then shuts down gracefully: new connections
+// are refused, in-flight requests and background jobs get until the shutdown timeout
+// to finish and the activity store is flushed.
+func serve(ctx context.Context, srv *http.Server, cfg *config.Config) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		var err error
+		if config.IsTLSEnabled(cfg) {
+			slog.Info("listening", "address", srv.Addr, "tls", true)
+			err = srv.ListenAndServeTLS(cfg.Server.TLSCert, cfg.Server.TLSKey)
+		} else {
+			slog.Info("listening", "address", srv.Addr, "tls", false)
+			err = srv.ListenAndServe()
+		}
+		serveErr <- err
+	}()
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("server stopped: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	timeout := config.GetShutdownTimeout(cfg)
+	slog.Info("shutting down", "timeout", timeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	srv.RegisterOnShutdown(closeStreams)
+	var shutdownErr error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		shutdownErr = fmt.Errorf("in-flight requests did not finish: %w", err)
+	}
+	if err := backgroundJobs.drain(shutdownCtx); err != nil && shutdownErr == nil {
+		shutdownErr = err
+	}
+	if err := rubix.FlushActivityStore(); err != nil {
+		slog.Error("failed to flush activity store", "error", err)
+		if shutdownErr == nil {
+			shutdownErr = err
+		}
+	}
+	if shutdownErr == nil {
+		slog.Info("shutdown complete")
+	}
+	return shutdownErr
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"dapp-server/auth"
+)
+
+func TestJobTrackerDrain(t *testing.T) {
+	var tracker jobTracker
+	done, err := tracker.track()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- tracker.drain(context.Background()) }()
+	// Jobs started once draining has begun are refused rather than added to the waited on group
+	for {
+		polled, err := tracker.track()
+		if errors.Is(err, errShuttingDown) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		polled()
+		select {
+		case <-drained:
+			t.Fatal("drain() returned before the running job was done")
+		default:
+		}
+	}
+	select {
+	case err := <-drained:
+		t.Fatalf("drain() = %v before the running job was done", err)
+	default:
+	}
+	done()
+	if err := <-drained; err != nil {
+		t.Fatalf("drain() = %v after the jobs were done", err)
+	}
+}
+
+func TestJobTrackerDrainTimeout(t *testing.T) {
+	var tracker jobTracker
+	if _, err := tracker.track(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tracker.drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("drain() = %v, want the deadline", err)
+	}
+}
+
+func TestDeploymentEventsEndOnShutdown(t *testing.T) {
+	loadTestConfig(t, "")
+	previous, previousClose := streams, closeStreams
+	streams, closeStreams = context.WithCancel(context.Background())
+	t.Cleanup(func() { streams, closeStreams = previous, previousClose })
+
+	root := &auth.Principal{Subject: "root", Method: auth.MethodJWT, Roles: []string{auth.RoleAdmin}}
+	id, d := deployments.start("root", "did:root", "")
+	d.publish(DeploymentEvent{Type: "build"})
+	ended := make(chan string, 1)
+	go func() {
+		recorder := doRequest(http.MethodGet, "/api/deploy/:id/events", eventsPath(id), "", root, APIDeploymentEvents)
+		ended <- recorder.Body.String()
+	}()
+	select {
+	case body := <-ended:
+		t.Fatalf("stream of a running deployment ended early: %s", body)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	closeStreams()
+	select {
+	case body := <-ended:
+		if !strings.Contains(body, "event:build") {
+			t.Fatalf("events = %s, want the events published before shutdown", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream of a running deployment kept going after shutdown started")
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"dapp-server/auth"
+	rubix "dapp-server/rubix-interaction"
+
+	"github.com/gin-gonic/gin"
+)
+
+// nodeMonitor tracks the health of the configured nodes; BootupServer replaces it
+// with one using the configured probe interval
+var nodeMonitor = rubix.NewNodeMonitor(30 * time.Second)
+
+// APIListNodes returns the health details of every configured node
+func APIListNodes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Node health",
+		"data":    nodeMonitor.Status(),
+	})
+}
+
+// APIGetBalance returns the fungible tokens held by a DID, read from the node hosting it
+func APIGetBalance(c *gin.Context) {
+	did := c.Param("did")
+	if principal, exists := auth.GetPrincipal(c); !exists || !accessPolicy.CanViewWallet(principal, did) {
+		auth.Forbid(c, "members may only view their own wallet")
+		return
+	}
+	balance, err := nodeMonitor.GetFTBalance(c.Request.Context(), did)
+	if errors.Is(err, rubix.ErrDIDNotHosted) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Token balance",
+		"data":    balance,
+	})
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dapp-server/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// twoNodeConfig configures a sending node hosting did:sender and another node that holds
+// the contract QmContract locally, so it would be a failover candidate for reads
+func twoNodeConfig(t *testing.T, sender, other *fakeNode) {
+	t.Helper()
+	otherPath := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(otherPath, "node2", "SmartContract", "QmContract"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	loadTestConfig(t, fmt.Sprintf(`
+[nodes.node1]
+name = "node1"
+port = "20000"
+did = "did:sender"
+dids = ["did:wallet"]
+url = %q
+
+[nodes.node2]
+name = "node2"
+port = "20001"
+did = "did:other"
+path = %q
+url = %q
+
+[contracts.activity]
+name = "activity"
+hash = "QmContract"
+`, sender.URL, otherPath, other.URL))
+}
+
+func TestAPIGetBalance(t *testing.T) {
+	sender := newFakeNode(t, map[string]string{"/api/get-ft-info-by-did": `{"status": true, "message": "ok", "result": [{"ft_name": "reward", "ft_count": 5}]}`})
+	other := newFakeNode(t, map[string]string{"/api/get-ft-info-by-did": `{"status": true, "message": "ok", "result": []}`})
+	twoNodeConfig(t, sender, other)
+
+	tests := []struct {
+		name       string
+		did        string
+		down       bool // Whether the hosting node fails the query
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "node DID", did: "did:sender", wantStatus: http.StatusOK, wantBody: "ft_count"},
+		{name: "further DID on the node", did: "did:wallet", wantStatus: http.StatusOK, wantBody: "ft_count"},
+		{name: "DID no node hosts", did: "did:unknown", wantStatus: http.StatusNotFound, wantBody: "no configured node hosts the DID"},
+		{name: "hosting node failing", did: "did:sender", down: true, wantStatus: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.down {
+				sender.mu.Lock()
+				sender.replies["/api/get-ft-info-by-did"] = ""
+				sender.mu.Unlock()
+			}
+			recorder := doRequest(http.MethodGet, "/api/balance/:did", "/api/balance/"+tt.did, "", nil, APIGetBalance)
+			if recorder.Code != tt.wantStatus || !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Fatalf("balance = %d %s, want %d with %q", recorder.Code, recorder.Body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+	if calls := other.calls("/api/get-ft-info-by-did"); len(calls) != 0 {
+		t.Fatalf("node not hosting the DIDs received %d balance queries", len(calls))
+	}
+}
+
+func TestCallbackReadsOnlyItsSender(t *testing.T) {
+	sender := newFakeNode(t, map[string]string{"/api/get-smart-contract-token-chain-data": ""})
+	other := newFakeNode(t, map[string]string{
+		"/api/get-smart-contract-token-chain-data": `{"status": true, "SCTDataReply": [{"BlockNo": 1, "BlockId": "stale", "SmartContractData": "{}"}]}`,
+	})
+	twoNodeConfig(t, sender, other)
+	cfg, _ := config.GetConfig()
+	fromSender := func(c *gin.Context) {
+		c.Set(callbackNodeKey, cfg.Nodes["node1"])
+	}
+
+	for _, handler := range []gin.HandlerFunc{APICallBackTrigger, ftDappHandler, ftContract2Handler} {
+		doRequest(http.MethodPost, "/callback", "/callback", `{"port": "20000", "smart_contract_hash": "QmContract"}`, nil, fromSender, handler)
+	}
+	if got := len(sender.calls("/api/get-smart-contract-token-chain-data")); got != 3 {
+		t.Fatalf("sending node received %d token chain reads, want 3", got)
+	}
+	if calls := other.calls("/api/get-smart-contract-token-chain-data"); len(calls) != 0 {
+		t.Fatalf("callbacks read the token chain from a node that didn't send them %d times", len(calls))
+	}
+}
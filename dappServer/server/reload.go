@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"dapp-server/audit"
+	"dapp-server/config"
+	"dapp-server/logger"
+	rubix "dapp-server/rubix-interaction"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gin-gonic/gin"
+)
+
+// Editors write a file in several steps, so changes are applied once the files settle
+const reloadDebounce = 500 * time.Millisecond
+
+// reloadConfig rebuilds the configuration and swaps it in when it is valid. config.Reload
+// serialises file triggered and API triggered reloads. Node clients are rebuilt so reloaded
+// TLS settings take effect and the node monitor picks up a new health check interval; the
+// previous configuration stays active when the new one is invalid.
+func reloadConfig(ctx context.Context) (*config.ReloadResult, error) {
+	log := logger.FromContext(ctx)
+
+	result, err := config.Reload()
+	if err != nil {
+		log.Error("configuration reload rejected, keeping the current configuration", "error", err)
+		return nil, err
+	}
+	rubix.ResetNodeClients()
+	if cfg, err := config.GetConfig(); err == nil && nodeMonitor != nil {
+		nodeMonitor.SetInterval(config.GetHealthCheckInterval(cfg))
+	}
+	if len(result.Changes) == 0 {
+		log.Info("configuration reloaded, nothing changed")
+		return result, nil
+	}
+	log.Info("configuration reloaded", "changes", result.Changes)
+	if len(result.RestartRequired) > 0 {
+		log.Warn("some changed settings only apply after a restart", "sections", result.RestartRequired)
+	}
+	return result, nil
+}
+
+// watchConfig reloads the configuration whenever one of its files changes, until ctx is cancelled
+func watchConfig(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// Directories are watched rather than the files so replacing a file by rename is noticed
+	watched := make(map[string]bool)
+	for _, path := range config.GetConfigFiles() {
+		absolute, err := filepath.Abs(path)
+		if err != nil {
+			watcher.Close()
+			return err
+		}
+		watched[absolute] = true
+		if err := watcher.Add(filepath.Dir(absolute)); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				absolute, err := filepath.Abs(event.Name)
+				if err != nil || !watched[absolute] || event.Op == fsnotify.Chmod {
+					continue
+				}
+				debounce = time.After(reloadDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("config watcher failed", "error", err)
+			case <-debounce:
+				debounce = nil
+				slog.Info("configuration files changed, reloading")
+				reloadConfig(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+// APIReloadConfig reloads the configuration and returns what changed
+func APIReloadConfig(c *gin.Context) {
+	ctx := c.Request.Context()
+	entry := startAudit(c, audit.ActionReloadConfig, "", nil)
+	defer finishAudit(ctx, entry)
+
+	result, err := reloadConfig(ctx)
+	if err != nil {
+		entry.Error = err.Error()
+		var validationErrors config.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "configuration is invalid, keeping the current configuration", "data": validationErrors})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	entry.Result = audit.ResultSuccess
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Configuration reloaded",
+		"data":    result,
+	})
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dapp-server/config"
+)
+
+func TestAPIReloadConfig(t *testing.T) {
+	const node1 = `
+[loyalty]
+add_activity_contract = "QmAdd"
+transfer_contract = "QmTransfer"
+
+[storage]
+activity_update_path = "activities.json"
+
+[contracts.add]
+name = "add"
+hash = "QmAdd"
+
+[contracts.transfer]
+name = "transfer"
+hash = "QmTransfer"
+
+[nodes.node1]
+name = "node1"
+port = "20000"
+did = "did:node1"
+path = "node-data"
+`
+	dir := loadTestConfig(t, node1)
+	tests := []struct {
+		name       string
+		content    string
+		wantStatus int
+		wantBody   string
+		wantNodes  int
+	}{
+		{name: "unchanged", content: node1, wantStatus: http.StatusOK, wantBody: `"changes":[]`, wantNodes: 1},
+		{name: "node added", content: node1 + `
+[nodes.node2]
+name = "node2"
+port = "20001"
+did = "did:node2"
+path = "node-data"
+`, wantStatus: http.StatusOK, wantBody: "node2", wantNodes: 2},
+		{name: "invalid config kept out", content: node1 + `
+[rate_limit]
+read = { requests_per_minute = -1 }
+`, wantStatus: http.StatusUnprocessableEntity, wantBody: "rate_limit.read", wantNodes: 2},
+		{name: "unparsable file kept out", content: "[nodes", wantStatus: http.StatusInternalServerError, wantNodes: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			recorder := doRequest(http.MethodPost, "/api/admin/reload", "/api/admin/reload", "", nil, APIReloadConfig)
+			if recorder.Code != tt.wantStatus || !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Fatalf("reload = %d %s, want %d with %q", recorder.Code, recorder.Body, tt.wantStatus, tt.wantBody)
+			}
+			cfg, err := config.GetConfig()
+			if err != nil || len(cfg.Nodes) != tt.wantNodes {
+				t.Fatalf("active config has %d nodes, %v, want %d", len(cfg.Nodes), err, tt.wantNodes)
+			}
+		})
+	}
+}
@@ -1,21 +1,31 @@
 package server
 
 import (
+	"context"
+	"dapp-server/audit"
+	"dapp-server/auth"
+	"dapp-server/catalogue"
 	"dapp-server/config"
+	"dapp-server/idempotency"
+	"dapp-server/logger"
+	"dapp-server/metrics"
+	"dapp-server/ratelimit"
 	rubix_interaction "dapp-server/rubix-interaction"
+	"dapp-server/tracing"
+	"dapp-server/wasmhost"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"path/filepath"
-	"strings"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	wasmbridge "github.com/rubixchain/rubix-wasm/go-wasm-bridge"
 )
 
 // /home/rubix/Rubix/adminNode
@@ -66,203 +76,419 @@ type Activity struct {
 	RewardPoints int    `json:"reward_points"`
 }
 
-func BootupServer() {
-	gin.SetMode(gin.ReleaseMode) //
-	log.Println("Current Gin Mode:", gin.Mode())
+// corsConfig builds the CORS settings from the config. Headers the API relies on are always
+// allowed and exposed so a narrowed list can't break authentication or request correlation.
+func corsConfig(cfg config.CORSConfig) cors.Config {
+	corsCfg := cors.Config{
+		AllowOrigins:     cfg.AllowOrigins,
+		AllowMethods:     cfg.AllowMethods,
+		AllowHeaders:     cfg.AllowHeaders,
+		ExposeHeaders:    cfg.ExposeHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+	}
+	if len(corsCfg.AllowOrigins) == 0 {
+		corsCfg.AllowOrigins = []string{"*"}
+	}
+	if len(corsCfg.AllowMethods) == 0 {
+		corsCfg.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	}
+	if len(corsCfg.AllowHeaders) == 0 {
+		corsCfg.AllowHeaders = []string{"Origin", "Content-Type", "Accept"}
+	}
+	corsCfg.AllowHeaders = append(corsCfg.AllowHeaders, "Authorization", auth.APIKeyHeader, logger.RequestIDHeader, idempotency.Header, BranchHeader)
+	if len(corsCfg.ExposeHeaders) == 0 {
+		corsCfg.ExposeHeaders = []string{"Content-Length"}
+	}
+	corsCfg.ExposeHeaders = append(corsCfg.ExposeHeaders, logger.RequestIDHeader, "Retry-After", idempotency.ReplayedHeader)
+	if maxAge, err := time.ParseDuration(cfg.MaxAge); err == nil {
+		corsCfg.MaxAge = maxAge
+	}
+	return corsCfg
+}
+
+// accessPolicy decides what each caller may do; BootupServer replaces it with the configured policy
+var accessPolicy, _ = auth.NewPolicy(config.AuthConfig{})
 
-	// Initialize a Gin router
-	router := gin.Default()
-	log.Println("Current Gin Mode:", gin.Mode())
+// authorizeDID refuses the request unless the caller may have a node sign with did
+func authorizeDID(c *gin.Context, did string) bool {
+	principal, exists := auth.GetPrincipal(c)
+	if !exists || !accessPolicy.CanActAs(principal, did) {
+		auth.Forbid(c, fmt.Sprintf("not allowed to act as %s", did))
+		return false
+	}
+	return true
+}
+
+// newRouter builds the API router: middleware, rate limits, authentication and routes
+func newRouter(cfg *config.Config, policy *auth.Policy, authenticators []auth.Authenticator) (*gin.Engine, error) {
+	// Initialize a Gin router, requests are logged by logger.Middleware instead of gin's logger
+	router := gin.New()
+	router.Use(gin.Recovery())
 
 	// config := GetConfig()
 
-	log.SetFlags(log.LstdFlags)
+	router.Use(tracing.Middleware(cfg.Tracing))
+	router.Use(logger.Middleware())
+	router.Use(metrics.Middleware())
+
+	// Client IPs key the rate limiter, so only listed proxies may set X-Forwarded-For
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, err
+	}
 
 	// Configure CORS middleware
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:  []string{"*"},
-		AllowMethods:  []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders:  []string{"Origin", "Content-Type", "Accept"},
-		ExposeHeaders: []string{"Content-Length"},
-	}))
+	router.Use(cors.New(corsConfig(cfg.CORS)))
+
+	var readLimiter, expensiveLimiter, clientLimiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled {
+		readLimiter = ratelimit.New("read", config.GetReadRateLimit(cfg))
+		expensiveLimiter = ratelimit.New("expensive", config.GetExpensiveRateLimit(cfg))
+		clientLimiter = ratelimit.New("client", config.GetClientRateLimit(cfg))
+	}
+	read := ratelimit.Middleware(readLimiter)
+	expensive := ratelimit.Middleware(expensiveLimiter)
+	// Runs before authentication, so it counts per client IP and limits failed credentials too
+	perClient := ratelimit.Middleware(clientLimiter)
 
 	// nftDappCallbackHandler := config.ContractsInfo["nft"].CallBackUrl
 	// ftDappCallbackHandler := config.ContractsInfo["ft"].CallBackUrl
 
 	// Define endpoints
+	// Probes, metrics and node callbacks are reachable without API credentials,
+	// callbacks are verified against the node and contract registries instead
+	router.GET("/healthz", APIHealthz)
+	router.GET("/readyz", APIReadyz)
+	router.GET("/metrics", metrics.Handler())
 	// router.POST(nftDappCallbackHandler, nftDappHandler) // NFT
-	router.POST("/api/call-back-trigger", ftDappHandler) // FT
-	// router.POST("/api/trigger-contract-2", ftContract2Handler)
-	router.POST("/api/deploy-contract", APIDeployContract)
-	router.POST("/api/execute-contract", APIExecuteContract)
-	router.POST("/api/activity/add", APIAddActivity)
-	router.POST("/api/callback/trigger", APICallBackTrigger)
-	router.POST("/api/rewards/transfer", APITransferReward)
+	// Retried POSTs carrying an Idempotency-Key get the first response instead of running again.
+	// It sits after authentication, rate limiting and permission checks so refused requests never claim a key.
+	idempotent := idempotency.Middleware(idempotency.NewStore(config.GetIdempotencyTTL(cfg)))
+	router.POST("/api/call-back-trigger", VerifyCallback(), idempotent, ftDappHandler) // FT
+	// router.POST("/api/trigger-contract-2", VerifyCallback(), idempotent, ftContract2Handler)
+	router.POST(rubix_interaction.CallbackPath, VerifyCallback(), idempotent, APICallBackTrigger)
+
+	api := router.Group("/api", perClient, auth.Middleware(cfg.Auth.Enabled, authenticators...))
+	// The event stream also takes a stream token in the URL, since EventSource can't send headers
+	streamAuth := auth.Middleware(cfg.Auth.Enabled, append([]auth.Authenticator{deployments}, authenticators...)...)
+	router.GET("/api/deploy/:id/events", perClient, streamAuth, read, auth.Require(policy, auth.PermDeploy), APIDeploymentEvents)
+	api.POST("/deploy-contract", expensive, auth.Require(policy, auth.PermDeploy), idempotent, APIDeployContract)
+	api.POST("/deploy/:id/events/token", read, auth.Require(policy, auth.PermDeploy), APIDeploymentStreamToken)
+	api.POST("/execute-contract", expensive, auth.Require(policy, auth.PermExecute), idempotent, APIExecuteContract)
+	api.POST("/contracts/:hash/simulate", expensive, auth.Require(policy, auth.PermExecute), idempotent, APISimulateContract)
+	api.GET("/contracts/:hash/verify", read, auth.Require(policy, auth.PermViewReports), APIVerifyContract)
+	api.GET("/nodes", read, auth.Require(policy, auth.PermViewReports), APIListNodes)
+	api.GET("/wallet/:did/balance", read, auth.Require(policy, auth.PermViewWallet), APIGetBalance)
+	api.GET("/audit", read, auth.Require(policy, auth.PermViewAudit), APIListAudit)
+	api.POST("/admin/reload", expensive, auth.Require(policy, auth.PermManageConfig), idempotent, APIReloadConfig)
+	api.GET("/branches", read, auth.Require(policy, auth.PermViewReports), APIListBranches)
+
+	// Loyalty routes act for one branch, named in the route or the X-Branch header
+	branch := api.Group("/branches/:branch", branchScope())
+	branch.GET("", read, auth.Require(policy, auth.PermViewReports), APIGetBranch)
+	for _, group := range []*gin.RouterGroup{api.Group("", branchScope()), branch} {
+		group.POST("/activity/add", expensive, auth.Require(policy, auth.PermAddActivity), idempotent, APIAddActivity)
+		group.POST("/rewards/transfer", expensive, auth.Require(policy, auth.PermTransferReward), idempotent, APITransferReward)
+		group.GET("/activities", read, auth.Require(policy, auth.PermViewActivities), APIListActivities)
+		group.GET("/activities/:id", read, auth.Require(policy, auth.PermViewActivities), APIGetActivity)
+		group.GET("/activities/:id/sessions", read, auth.Require(policy, auth.PermViewActivities), APIListSessions)
+		group.POST("/activities", expensive, auth.Require(policy, auth.PermAddActivity), idempotent, APICreateActivity)
+		group.PUT("/activities/:id", expensive, auth.Require(policy, auth.PermAddActivity), APIUpdateActivity)
+		group.DELETE("/activities/:id", expensive, auth.Require(policy, auth.PermAddActivity), APIDeleteActivity)
+		group.POST("/activities/:id/publish", expensive, auth.Require(policy, auth.PermAddActivity), idempotent, APIPublishActivity)
+		group.POST("/activities/:id/checkins", expensive, auth.Require(policy, auth.PermCheckIn), idempotent, APICheckIn)
+		group.GET("/checkins", read, auth.Require(policy, auth.PermCheckIn), APIListCheckIns)
+		group.GET("/checkins/:checkin", read, auth.Require(policy, auth.PermCheckIn), APIGetCheckIn)
+		group.POST("/checkins/:checkin/confirm", expensive, auth.Require(policy, auth.PermConfirmAttendance), idempotent, APIConfirmAttendance)
+		group.POST("/checkins/:checkin/reject", expensive, auth.Require(policy, auth.PermConfirmAttendance), idempotent, APIRejectAttendance)
+		group.POST("/checkins/:checkin/transfer/resolve", expensive, auth.Require(policy, auth.PermConfirmAttendance), idempotent, APIResolveTransfer)
+	}
+	return router, nil
+}
+
+// BootupServer serves the dapp API until SIGINT or SIGTERM, then shuts down gracefully
+func BootupServer() error {
+	gin.SetMode(gin.ReleaseMode) //
+	slog.Info("starting dapp server", "gin_mode", gin.Mode())
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return err
+	}
+	authenticators, err := auth.NewAuthenticators(cfg.Auth)
+	if err != nil {
+		return err
+	}
+	policy, err := auth.NewPolicy(cfg.Auth)
+	if err != nil {
+		return err
+	}
+	accessPolicy = policy
+	auditLog, err = audit.Open(config.GetAuditLogPath(cfg), config.GetAuditKey(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	activityCatalogue, err = catalogue.Open(config.GetCataloguePath(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to open activity catalogue: %w", err)
+	}
+	attendanceLog, err = catalogue.OpenAttendance(config.GetAttendancePath(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to open attendance log: %w", err)
+	}
+	if !cfg.Auth.Enabled {
+		slog.Warn("API authentication is disabled, every endpoint is open to anyone who can reach the server")
+	}
+
+	router, err := newRouter(cfg, policy, authenticators)
+	if err != nil {
+		return err
+	}
 
 	// router.GET("/request-status", getRequestStatusHandler)
 
-	// Start the server on port 9000
-	router.Run(":9000")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	nodeMonitor = rubix_interaction.NewNodeMonitor(config.GetHealthCheckInterval(cfg))
+	go nodeMonitor.Start(ctx)
+	// Confirmed attendance is paid out in the background, including transfers queued before a restart
+	recoverTransfers()
+	go rewardTransfers.run(ctx, config.GetSweepInterval(cfg))
+	// Node and contract changes apply without a restart
+	if err := watchConfig(ctx); err != nil {
+		slog.Warn("config files are not watched, use POST /api/admin/reload to apply changes", "error", err)
+	}
+
+	srv := &http.Server{
+		Addr:              config.GetListenAddress(cfg),
+		Handler:           router,
+		ReadTimeout:       config.GetReadTimeout(cfg),
+		ReadHeaderTimeout: config.GetReadTimeout(cfg),
+		WriteTimeout:      config.GetWriteTimeout(cfg),
+	}
+	return serve(ctx, srv, cfg)
 }
 func APITransferReward(c *gin.Context) {
-	fmt.Println("APITransferReward triggered")
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	var req TransferRewardRequest
 	err := json.NewDecoder(c.Request.Body).Decode(&req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
-		fmt.Printf("Error reading response body: %s\n", err)
+		log.Warn("invalid request body", "error", err)
 		return
 	}
-	fmt.Println("The request body is:", req)
-	cfg, err := config.GetConfig()
-	if err != nil {
-		fmt.Println("failed to load config: %w", err)
-	}
-	nodePort, exists := config.GetPortByDid(cfg, req.AdminDID)
-	if !exists {
-		fmt.Println("failed to get node port: not found")
-		return
-	}
-	fmt.Println("The node port is:", nodePort)
-	url := fmt.Sprintf("http://localhost:%s", nodePort)
-	fmt.Println("The url is :", url)
-	filePath := config.GetEnvConfig().ActivityUpdatePath
-	rewardPoints, err := GetRewardPoints(filePath, req.ActivityID)
-	if err != nil {
-		fmt.Println("Failed to get reward points")
+	branch := currentBranch(c)
+	log = log.With("activity_id", req.ActivityID, "admin_did", req.AdminDID, "user_did", req.UserDID, "branch", branch.ID)
+	if !authorizeDID(c, req.AdminDID) || !authorizeBranchAdmin(c, req.AdminDID) {
 		return
 	}
-	// contractMsg := fmt.Sprintf(`{"activity_id":"%s","reward_points":%d,"user_did":%s,"admin_did":%s}`, req.ActivityID, rewardPoints, req.UserDID, req.AdminDID)
-	contractMsg := fmt.Sprintf(`{"transfer_sample_ft":{"name": "rubix1", "ft_info": {"comment":"Transfer of reward via contract","ft_count":%f,"ft_name":"ytoken","sender": "%s","creatorDID": "%s", "receiver": "%s"}}}`, float64(rewardPoints), req.AdminDID, req.AdminDID, req.UserDID)
-	fmt.Println("The contract message is:", contractMsg)
-	transferContractHash := config.GetEnvConfig().TransferContract //Loading the smart contract hash from config
-	if transferContractHash == "" {
-		fmt.Println("transferContractHash is not set in the config")
-		return
+	entry := startAudit(c, audit.ActionTransferReward, req.AdminDID, req)
+	defer finishAudit(ctx, entry)
+	log.Info("reward transfer requested")
+	rewardAmount, err := transferRewardOnChain(ctx, entry, branch, req.AdminDID, req.UserDID, req.ActivityID, nil)
+	if entry.RubixRequestID != "" {
+		// The node holds the transfer from here, a retry must not pay again
+		idempotency.MarkSideEffects(c)
 	}
-	smartContractResponse, err := rubix_interaction.ExecuteSmartContract(url, transferContractHash, req.AdminDID, contractMsg)
-
-	if err != nil {
-		fmt.Println("failed to execute smart contract:", err)
+	if err != nil && entry.RubixRequestID == "" {
+		log.Error("failed to transfer reward", "error", err)
+		c.JSON(contractErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	fmt.Println("Smart contract response:", smartContractResponse)
-	response := rubix_interaction.SignatureResponse(url, smartContractResponse)
 	if err != nil {
-		fmt.Println("failed to send signature response:", err)
+		log.Error("failed to send signature response", "rubix_request_id", entry.RubixRequestID, "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":            "reward transfer is unconfirmed, the signature response failed: " + err.Error(),
+			"rubix_request_id": entry.RubixRequestID,
+		})
 		return
 	}
-	fmt.Println("Signature response sent successfully")
-	var data interface{}
-	if response == nil {
-    		data = gin.H{
-	"rewards awarded": float64(rewardPoints),
-	"activity_id":     req.ActivityID,
-    		}
-	} else {
-	    data = response
-	}
 	resultFinal := gin.H{
 		"message": "Reward Transferred succesfully",
-		"data":    data,
+		"data": gin.H{
+			"rewards awarded":  rewardAmount,
+			"activity_id":      req.ActivityID,
+			"rubix_request_id": entry.RubixRequestID,
+		},
 	}
 
 	// Return a response
 	c.JSON(http.StatusOK, resultFinal)
 
 }
-func APIAddActivity(c *gin.Context) {
-	fmt.Println("APIAddActivity triggered")
-	var req AddActivityRequest
-	err := json.NewDecoder(c.Request.Body).Decode(&req)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
-		fmt.Printf("Error reading response body: %s\n", err)
-		return
+
+var (
+	errNoAdminNode           = errors.New("no node configured for admin DID")
+	errNoTransferContract    = errors.New("no transfer contract is configured for the branch")
+	errNoAddActivityContract = errors.New("no add activity contract is configured for the branch")
+	errActivityNotFound      = errors.New("activity ID not found")
+)
+
+// contractErrorStatus maps a loyalty contract call that failed before the contract ran to a
+// status: the caller's mistakes are 4xx, the server's setup 500 and node failures 502
+func contractErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errNoAdminNode):
+		return http.StatusBadRequest
+	case errors.Is(err, errActivityNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errNoTransferContract), errors.Is(err, errNoAddActivityContract):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadGateway
 	}
-	fmt.Println("The request body is:", req)
+}
+
+// transferRewardOnChain has the admin's node execute the branch's transfer contract, paying userDID
+// the activity's reward points under the branch's reward rules, and records the outcome in entry.
+// entry.RubixRequestID is set once the contract has run, even if signing it then fails, and
+// executed, if given, is told the request ID before the transfer is signed.
+func transferRewardOnChain(ctx context.Context, entry *audit.Entry, branch config.Branch, adminDID string, userDID string, activityID string, executed func(rubixRequestID string)) (float64, error) {
+	log := logger.FromContext(ctx)
 	cfg, err := config.GetConfig()
 	if err != nil {
-		fmt.Println("failed to load config: %w", err)
+		entry.Error = err.Error()
+		return 0, err
 	}
-	nodePort, exists := config.GetPortByDid(cfg, req.AdminDID)
+	node, exists := config.GetNodeByDid(cfg, adminDID)
 	if !exists {
-		fmt.Println("failed to get node port: not found")
-		return
+		entry.Error = errNoAdminNode.Error()
+		return 0, fmt.Errorf("%w %s", errNoAdminNode, adminDID)
 	}
-	fmt.Println("The node port is:", nodePort)
-	url := fmt.Sprintf("http://localhost:%s", nodePort)
-	fmt.Println("The url is :", url)
-	contractMsg := fmt.Sprintf(`{"activity_id":"%s","reward_points":%d}`, req.ActivityID, req.RewardPoints)
-	fmt.Println("The contract message is:", contractMsg)
-	smartContractHash := config.GetEnvConfig().AddActivityContract //Loading the smart contract hash from config
-	if smartContractHash == "" {
-		fmt.Println("Smart contract hash is not set in the config")
-		return
+	url := config.GetNodeURL(node)
+	rewardPoints, err := GetRewardPoints(branch.ActivityUpdatePath, activityID)
+	if err != nil {
+		entry.Error = err.Error()
+		return 0, fmt.Errorf("failed to get reward points: %w", err)
+	}
+	rewardAmount := config.GetRewardAmount(branch.Rewards, rewardPoints)
+	// contractMsg := fmt.Sprintf(`{"activity_id":"%s","reward_points":%d,"user_did":%s,"admin_did":%s}`, activityID, rewardPoints, userDID, adminDID)
+	contractMsg := fmt.Sprintf(`{"transfer_sample_ft":{"name": "rubix1", "ft_info": {"comment":"Transfer of reward via contract","ft_count":%f,"ft_name":"ytoken","sender": "%s","creatorDID": "%s", "receiver": "%s"}}}`, rewardAmount, adminDID, adminDID, userDID)
+	log.Debug("transfer contract message", "contract_msg", contractMsg)
+	transferContractHash := branch.TransferContract //Loading the smart contract hash from config
+	if transferContractHash == "" {
+		entry.Error = errNoTransferContract.Error()
+		return 0, errNoTransferContract
 	}
-	smartContractResponse, err := rubix_interaction.ExecuteSmartContract(url, smartContractHash, req.AdminDID, contractMsg)
+	entry.Contract = transferContractHash
+	smartContractResponse, err := rubix_interaction.ExecuteSmartContract(ctx, url, transferContractHash, adminDID, contractMsg)
 	if err != nil {
-		fmt.Println("failed to execute smart contract:", err)
-		return
+		entry.Error = err.Error()
+		return 0, fmt.Errorf("failed to execute smart contract on %s: %w", url, err)
 	}
-	fmt.Println("Smart contract response:", smartContractResponse)
-	response := rubix_interaction.SignatureResponse(url, smartContractResponse)
-	if response != nil {
-		fmt.Println("failed to send signature response:", err)
-		return
+	log.Info("transfer contract executed", "rubix_request_id", smartContractResponse)
+	entry.RubixRequestID = smartContractResponse
+	if executed != nil {
+		executed(smartContractResponse)
 	}
-	fmt.Println("Signature response sent successfully")
-	addActivityContractHash := config.GetEnvConfig().AddActivityContract //Loading the smart contract hash from config
-	if addActivityContractHash == "" {
-		fmt.Println("addActivityContractHash is not set in the config")
+	if err := rubix_interaction.SignatureResponse(ctx, url, smartContractResponse); err != nil {
+		entry.Error = err.Error()
+		return 0, err
+	}
+	log.Info("reward transferred", "reward_points", rewardPoints, "reward_amount", rewardAmount)
+	entry.Result = audit.ResultSuccess
+	metrics.AddRewardPoints(branch.ID, activityID, rewardPoints, rewardAmount)
+	return rewardAmount, nil
+}
+
+// APIAddActivity publishes a catalogue activity by ID, for clients predating the catalogue.
+// The activity must be a draft in the branch's catalogue with the same reward points.
+func APIAddActivity(c *gin.Context) {
+	var req AddActivityRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		logger.FromContext(c.Request.Context()).Warn("invalid request body", "error", err)
 		return
 	}
-	block := rubix_interaction.GetSmartContractData(addActivityContractHash, url) //config.NodeAddress)
-	if block == nil {
-		fmt.Println("Unable to fetch latest smart contract data")
+	activity, err := activityCatalogue.Get(currentBranch(c).ID, req.ActivityID)
+	if err != nil {
+		catalogueError(c, err)
 		return
 	}
-	resultFinal := gin.H{
-		"message": "Activity added to smart contract tokenchain",
-		"data":    string(block),
+	if activity.RewardPoints != req.RewardPoints {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("activity %s has %d reward points in the catalogue", activity.ID, activity.RewardPoints)})
+		return
 	}
+	publishActivity(c, activity, req.AdminDID)
+}
 
-	// Return a response
-	c.JSON(http.StatusOK, resultFinal)
-
+// addActivityOnChain has the admin's node execute the branch's add-activity contract, recording
+// the outcome in entry. The latest contract data is returned once the activity is on chain; it is
+// nil when reading it back fails, which doesn't undo the activity.
+func addActivityOnChain(ctx context.Context, entry *audit.Entry, branch config.Branch, adminDID string, activityID string, rewardPoints int) ([]byte, error) {
+	log := logger.FromContext(ctx)
+	cfg, err := config.GetConfig()
+	if err != nil {
+		entry.Error = err.Error()
+		return nil, err
+	}
+	node, exists := config.GetNodeByDid(cfg, adminDID)
+	if !exists {
+		entry.Error = errNoAdminNode.Error()
+		return nil, fmt.Errorf("%w %s", errNoAdminNode, adminDID)
+	}
+	url := config.GetNodeURL(node)
+	contractMsg := fmt.Sprintf(`{"activity_id":"%s","reward_points":%d}`, activityID, rewardPoints)
+	smartContractHash := branch.AddActivityContract //Loading the smart contract hash from config
+	if smartContractHash == "" {
+		entry.Error = errNoAddActivityContract.Error()
+		return nil, errNoAddActivityContract
+	}
+	entry.Contract = smartContractHash
+	smartContractResponse, err := rubix_interaction.ExecuteSmartContract(ctx, url, smartContractHash, adminDID, contractMsg)
+	if err != nil {
+		entry.Error = err.Error()
+		return nil, fmt.Errorf("failed to execute smart contract on %s: %w", url, err)
+	}
+	log.Info("add activity contract executed", "rubix_request_id", smartContractResponse)
+	entry.RubixRequestID = smartContractResponse
+	if err := rubix_interaction.SignatureResponse(ctx, url, smartContractResponse); err != nil {
+		entry.Error = err.Error()
+		return nil, fmt.Errorf("failed to send signature response: %w", err)
+	}
+	// The activity is on chain from here, reading it back is only for the response
+	entry.Result = audit.ResultSuccess
+	return rubix_interaction.GetSmartContractData(ctx, smartContractHash, url), nil
 }
 
 func APICallBackTrigger(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	var req ContractInputRequest
 	err := json.NewDecoder(c.Request.Body).Decode(&req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
-		fmt.Printf("Error reading response body: %s\n", err)
+		log.Warn("invalid request body", "error", err)
+		return
+	}
+	node, exists := callbackNode(c)
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "callback was not matched to a configured node"})
+		log.Warn("callback from unknown node", "port", req.Port)
 		return
 	}
-	fmt.Println("The request body is:", req)
-	url := fmt.Sprintf("http://localhost:%s", req.Port)
-	fmt.Println("The url is :", url)
+	url := config.GetNodeURL(node)
 
 	// // config := GetConfig()
 	smartContractHash := req.SmartContractHash
-	fmt.Println("Received Smart Contract hash: ", smartContractHash)
+	log = log.With("contract", smartContractHash, "node_url", url)
+	log.Info("callback received")
 
-	smartContractTokenData := rubix_interaction.GetSmartContractData(smartContractHash, url) //config.NodeAddress)
+	// Only the node that sent the callback is read, another node may not have the block yet
+	smartContractTokenData := rubix_interaction.GetSmartContractData(ctx, smartContractHash, url)
 	if smartContractTokenData == nil {
-		fmt.Println("Unable to fetch latest smart contract data")
+		log.Error("unable to fetch latest smart contract data")
 		return
 	}
 
-	fmt.Println("Smart Contract Token Data :", string(smartContractTokenData))
-
 	var dataReply SmartContractDataReply
 
 	if err := json.Unmarshal(smartContractTokenData, &dataReply); err != nil {
-		fmt.Println("Error:", err)
+		log.Error("failed to parse token chain data", "error", err)
 		return
 	}
-	fmt.Println("Data reply in APICallBackTrigger", dataReply)
 	smartContractData := dataReply.SCTDataReply
 	var relevantBlock *SCTDataReply
 
@@ -270,14 +496,15 @@ func APICallBackTrigger(c *gin.Context) {
 	var blockNo uint64
 	for _, data := range smartContractData {
 		relevantBlock = &data // Assuming you want the last block
-		fmt.Println("The relevant block is :", relevantBlock)
 		// blockId = data.BlockId
 		blockNo = data.BlockNo
 	}
 	if blockNo == 0 {
-		fmt.Println("The block number is zero which is the genesis block")
+		log.Info("latest block is the genesis block, nothing to process")
 		return
 	}
+	log = log.With("block_id", relevantBlock.BlockId)
+	metrics.ObserveCallbackLag(smartContractHash, relevantBlock.Epoch)
 	var parsedData struct {
 		ActivityID   string `json:"activity_id"`
 		RewardPoints int    `json:"reward_points"`
@@ -285,37 +512,31 @@ func APICallBackTrigger(c *gin.Context) {
 
 	err = json.Unmarshal([]byte(relevantBlock.SmartContractData), &parsedData)
 	if err != nil {
-		fmt.Println("Error:", err)
+		log.Warn("failed to parse block contract data", "error", err)
 		// return
 	}
-	registry := wasmbridge.NewHostFunctionRegistry()
-
-	// Create your custom host function
-	registry.Register(rubix_interaction.NewWriteToJsonFile())
-	hostFunction := registry.GetHostFunctions()
-	fmt.Println("Host function is :", hostFunction)
-	wasmPath, err := getWasmContractPath(smartContractHash, req.Port)
+	contract, err := getRegisteredContract(smartContractHash)
+	if err != nil {
+		log.Warn("rejecting callback", "error", err)
+		return
+	}
+	wasmPath, err := rubix_interaction.GetWasmContractPath(ctx, node, contract)
 	if err != nil {
-		fmt.Println("Failed to get wasm path")
+		log.Error("failed to get wasm path", "error", err)
 	}
-	wasmModule, err := wasmbridge.NewWasmModule(
-		wasmPath,
-		registry,
-		// wasmbridge.WithRubixNodeAddress("http://localhost:20002"), //config.NodeAddress),
-		// wasmbridge.WithQuorumType(2),
-	)
+	wasmModule, err := rubix_interaction.LoadWasmModule(ctx, wasmPath, contract)
 	if err != nil {
-		log.Printf("Failed to initialize WASM module: %v", err)
+		log.Error("failed to initialize WASM module", "error", err)
 		return
 	}
 	contractInput := fmt.Sprintf(`{"add_activity": {"activity_id":"%s","reward_points":%d,"block_hash":"%s"}}`, parsedData.ActivityID, parsedData.RewardPoints, relevantBlock.BlockId)
-	fmt.Println("The contract input is :", contractInput)
-	result, err := wasmModule.CallFunction(contractInput)
+	log.Debug("calling contract", "contract_input", contractInput)
+	result, err := executeAndGetContractResult(ctx, wasmModule, smartContractHash, contractInput)
 	if err != nil {
-		log.Printf("Failed to call WASM function: %v", err)
+		log.Error("failed to call WASM function", "error", err)
 		return
 	}
-	fmt.Println("The result is :", result)
+	log.Info("callback processed", "activity_id", parsedData.ActivityID, "result", result)
 }
 
 // Function to read BlockId from a JSON file
@@ -372,7 +593,8 @@ func getNextSCTDataAfterBlockID(sctDataReplies []SCTDataReply, blockID string) *
 // Handler function for /callback/nft
 func ftDappHandler(c *gin.Context) {
 	var req ContractInputRequest
-	fmt.Println("Handler trggered")
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	// cfg, err := config.GetConfig()
 	// if err != nil {
 	// 	fmt.Println("failed to load config: %w", err)
@@ -381,42 +603,47 @@ func ftDappHandler(c *gin.Context) {
 	err := json.NewDecoder(c.Request.Body).Decode(&req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
-		fmt.Printf("Error reading response body: %s\n", err)
+		log.Warn("invalid request body", "error", err)
 		return
 	}
-	url := fmt.Sprintf("http://localhost:%s", req.Port)
-	fmt.Println("The url is :", url)
+	node, exists := callbackNode(c)
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "callback was not matched to a configured node"})
+		log.Warn("callback from unknown node", "port", req.Port)
+		return
+	}
+	url := config.GetNodeURL(node)
 
 	// // config := GetConfig()
 	smartContractHash := req.SmartContractHash
-	fmt.Println("Received Smart Contract hash: ", smartContractHash)
+	log = log.With("contract", smartContractHash, "node_url", url)
+	log.Info("callback received")
 
-	smartContractTokenData := rubix_interaction.GetSmartContractData(smartContractHash, url) //config.NodeAddress)
+	// Only the node that sent the callback is read, another node may not have the block yet
+	smartContractTokenData := rubix_interaction.GetSmartContractData(ctx, smartContractHash, url)
 	if smartContractTokenData == nil {
-		fmt.Println("Unable to fetch latest smart contract data")
+		log.Error("unable to fetch latest smart contract data")
 		return
 	}
 
-	fmt.Println("Smart Contract Token Data :", string(smartContractTokenData))
-
 	var dataReply SmartContractDataReply
 
 	if err := json.Unmarshal(smartContractTokenData, &dataReply); err != nil {
-		fmt.Println("Error:", err)
+		log.Error("failed to parse token chain data", "error", err)
 		return
 	}
-	fmt.Println("Data reply in runDappHandler", dataReply)
 	smartContractData := dataReply.SCTDataReply
 	var relevantData string
+	var relevantEpoch uint64
 	for _, reply := range smartContractData {
-		fmt.Println("SmartContractData:", reply.SmartContractData)
 		relevantData = reply.SmartContractData
+		relevantEpoch = reply.Epoch
 	}
-	fmt.Println("The relevant data is :", relevantData)
+	metrics.ObserveCallbackLag(smartContractHash, relevantEpoch)
 	var inputMap map[string]interface{}
 	err1 := json.Unmarshal([]byte(relevantData), &inputMap)
 	if err1 != nil {
-		fmt.Println("Error unmarshalling input map:", err1)
+		log.Error("failed to parse block contract data", "error", err1)
 		return
 	}
 	if len(inputMap) != 1 {
@@ -429,33 +656,35 @@ func ftDappHandler(c *gin.Context) {
 		funcName = key
 		inputStruct = value
 	}
-	fmt.Println("The function name extracted =", funcName)
-	fmt.Println("The inputStruct Value :", inputStruct)
+	log.Debug("contract function extracted", "function", funcName, "input", inputStruct)
 
-	hostFnRegistry := wasmbridge.NewHostFunctionRegistry()
-	wasmPath, err := getWasmContractPath(smartContractHash, req.Port)
+	contract, err := getRegisteredContract(smartContractHash)
 	if err != nil {
-		fmt.Println("Failed to get wasm path")
+		log.Warn("rejecting callback", "error", err)
+		return
+	}
+	wasmPath, err := rubix_interaction.GetWasmContractPath(ctx, node, contract)
+	if err != nil {
+		log.Error("failed to get wasm path", "error", err)
 	}
 	// Initialize the WASM module
 
-	wasmModule, err := wasmbridge.NewWasmModule(
+	wasmModule, err := rubix_interaction.LoadWasmModule(
+		ctx,
 		wasmPath,
-		hostFnRegistry,
-		wasmbridge.WithRubixNodeAddress(url), //config.NodeAddress),
-		wasmbridge.WithQuorumType(2),
+		contract,
 	)
 	if err != nil {
-		log.Printf("Failed to initialize WASM module: %v", err)
+		log.Error("failed to initialize WASM module", "error", err)
 		return
 	}
 
-	executionResult, errExecuteContract := executeAndGetContractResult(wasmModule, relevantData)
-	fmt.Println("----------- FT Execution Result: ", executionResult)
+	executionResult, errExecuteContract := executeAndGetContractResult(ctx, wasmModule, smartContractHash, relevantData)
 	if errExecuteContract != nil {
-		fmt.Println("The executionResult is ", executionResult)
+		log.Error("contract execution failed", "function", funcName, "error", errExecuteContract)
 		return
 	}
+	log.Info("contract executed", "function", funcName, "result", executionResult)
 
 	var response RubixResponse
 
@@ -465,7 +694,7 @@ func ftDappHandler(c *gin.Context) {
 	} else {
 		err = json.Unmarshal([]byte(executionResult), &response)
 		if err != nil {
-			log.Printf("Error parsing JSON: %v", err)
+			log.Error("failed to parse execution result", "error", err)
 			return
 		}
 	}
@@ -482,7 +711,8 @@ func ftDappHandler(c *gin.Context) {
 // Handler function for /callback/nft
 func ftContract2Handler(c *gin.Context) {
 	var req ContractInputRequest
-	fmt.Println("Handler trggered")
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	// cfg, err := config.GetConfig()
 	// if err != nil {
 	// 	fmt.Println("failed to load config: %w", err)
@@ -491,36 +721,42 @@ func ftContract2Handler(c *gin.Context) {
 	err := json.NewDecoder(c.Request.Body).Decode(&req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
-		fmt.Printf("Error reading response body: %s\n", err)
+		log.Warn("invalid request body", "error", err)
+		return
+	}
+	node, exists := callbackNode(c)
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "callback was not matched to a configured node"})
+		log.Warn("callback from unknown node", "port", req.Port)
 		return
 	}
-	url := fmt.Sprintf("http://localhost:%s", req.Port)
-	fmt.Println("The url is :", url)
+	url := config.GetNodeURL(node)
 	// // config := GetConfig()
 	smartContractHash := req.SmartContractHash
-	fmt.Println("Received Smart Contract hash: ", smartContractHash)
+	log = log.With("contract", smartContractHash, "node_url", url)
+	log.Info("callback received")
 
-	smartContractTokenData := rubix_interaction.GetSmartContractData(smartContractHash, url) //config.NodeAddress)
+	// Only the node that sent the callback is read, another node may not have the block yet
+	smartContractTokenData := rubix_interaction.GetSmartContractData(ctx, smartContractHash, url)
 	if smartContractTokenData == nil {
-		fmt.Println("Unable to fetch latest smart contract data")
+		log.Error("unable to fetch latest smart contract data")
 		return
 	}
 
-	fmt.Println("Smart Contract Token Data :", string(smartContractTokenData))
-
 	var dataReply SmartContractDataReply
 
 	if err := json.Unmarshal(smartContractTokenData, &dataReply); err != nil {
-		fmt.Println("Error:", err)
+		log.Error("failed to parse token chain data", "error", err)
 		return
 	}
-	fmt.Println("Data reply in runDappHandler", dataReply)
 	smartContractData := dataReply.SCTDataReply
 	var relevantData string
+	var relevantEpoch uint64
 	for _, reply := range smartContractData {
-		fmt.Println("SmartContractData:", reply.SmartContractData)
 		relevantData = reply.SmartContractData
+		relevantEpoch = reply.Epoch
 	}
+	metrics.ObserveCallbackLag(smartContractHash, relevantEpoch)
 	var inputMap map[string]interface{}
 	err1 := json.Unmarshal([]byte(relevantData), &inputMap)
 	if err1 != nil {
@@ -536,33 +772,35 @@ func ftContract2Handler(c *gin.Context) {
 		funcName = key
 		inputStruct = value
 	}
-	fmt.Println("The function name extracted =", funcName)
-	fmt.Println("The inputStruct Value :", inputStruct)
+	log.Debug("contract function extracted", "function", funcName, "input", inputStruct)
 
-	hostFnRegistry := wasmbridge.NewHostFunctionRegistry()
-	wasmPath, err := getWasmContractPath(smartContractHash, req.Port)
+	contract, err := getRegisteredContract(smartContractHash)
+	if err != nil {
+		log.Warn("rejecting callback", "error", err)
+		return
+	}
+	wasmPath, err := rubix_interaction.GetWasmContractPath(ctx, node, contract)
 	if err != nil {
-		fmt.Println("Failed to get wasm path")
+		log.Error("failed to get wasm path", "error", err)
 	}
 	// Initialize the WASM module
 
-	wasmModule, err := wasmbridge.NewWasmModule(
+	wasmModule, err := rubix_interaction.LoadWasmModule(
+		ctx,
 		wasmPath,
-		hostFnRegistry,
-		wasmbridge.WithRubixNodeAddress(url), //config.NodeAddress),
-		wasmbridge.WithQuorumType(2),
+		contract,
 	)
 	if err != nil {
-		log.Printf("Failed to initialize WASM module: %v", err)
+		log.Error("failed to initialize WASM module", "error", err)
 		return
 	}
 
-	executionResult, errExecuteContract := executeAndGetContractResult(wasmModule, relevantData)
-	fmt.Println("----------- FT Execution Result: ", executionResult)
+	executionResult, errExecuteContract := executeAndGetContractResult(ctx, wasmModule, smartContractHash, relevantData)
 	if errExecuteContract != nil {
-		fmt.Println("The executionResult is ", executionResult)
+		log.Error("contract execution failed", "function", funcName, "error", errExecuteContract)
 		return
 	}
+	log.Info("contract executed", "function", funcName, "result", executionResult)
 
 	var response RubixResponse
 
@@ -572,7 +810,7 @@ func ftContract2Handler(c *gin.Context) {
 	} else {
 		err = json.Unmarshal([]byte(executionResult), &response)
 		if err != nil {
-			log.Printf("Error parsing JSON: %v", err)
+			log.Error("failed to parse execution result", "error", err)
 			return
 		}
 	}
@@ -586,46 +824,27 @@ func ftContract2Handler(c *gin.Context) {
 	c.JSON(http.StatusOK, resultFinal)
 }
 
-func getWasmContractPath(contractHash, port string) (string, error) {
-	currentWorkingDir, err := os.Getwd()
-	if err != nil {
-		return "", fmt.Errorf("failed to get current working directory: %w", err)
-	}
-	fmt.Println("The current working Directory is:", currentWorkingDir)
+// getRegisteredContract returns the contract registry entry for a hash, refusing unknown contracts
+func getRegisteredContract(contractHash string) (config.Contract, error) {
 	cfg, err := config.GetConfig()
 	if err != nil {
-		fmt.Println("Failed to get config file")
-	}
-	path, exists := config.GetPathByPort(cfg, port)
-	if !exists {
-		fmt.Println("Failed to get path by port")
-		return "", fmt.Errorf("failed to get path by port: %s", port)
+		return config.Contract{}, err
 	}
-	nodeName, exists := config.GetNodeNameByPort(cfg, port)
+	contract, exists := config.GetContractByHash(cfg, contractHash)
 	if !exists {
-		fmt.Println("Failed to get node name associated with the port", port)
+		return config.Contract{}, fmt.Errorf("contract %s is not in the contract registry", contractHash)
 	}
-	// Construct the path in a cleaner way
-	contractDir := filepath.Join(path, nodeName, "SmartContract", contractHash)
-	fmt.Println("The contract directory is:", contractDir)
+	return contract, nil
+}
 
-	entries, err := os.ReadDir(contractDir)
+func executeAndGetContractResult(ctx context.Context, wasmModule *wasmhost.Contract, contractHash string, contractInput string) (string, error) {
+	done, err := trackJob()
 	if err != nil {
-		return "", fmt.Errorf("failed to read directory: %w", err)
-	}
-
-	for _, entry := range entries {
-		if strings.HasSuffix(entry.Name(), ".wasm") {
-			return filepath.Join(contractDir, entry.Name()), nil
-		}
+		return "", err
 	}
-
-	return "", fmt.Errorf("no wasm contract found in directory: %v", contractDir)
-}
-
-func executeAndGetContractResult(wasmModule *wasmbridge.WasmModule, contractInput string) (string, error) {
+	defer done()
 	// Call the function
-	contractResult, err := wasmModule.CallFunction(contractInput)
+	contractResult, err := rubix_interaction.CallWasmFunction(ctx, wasmModule, contractHash, contractInput)
 	if err != nil {
 		return "", fmt.Errorf("function call failed: %v", err)
 	}
@@ -635,15 +854,7 @@ func executeAndGetContractResult(wasmModule *wasmbridge.WasmModule, contractInpu
 
 // GetRewardPoints takes a JSON file path and an activity ID and returns the reward points for that activity.
 func GetRewardPoints(filePath string, activityID string) (int, error) {
-	// Read the JSON file
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return 0, err
-	}
-
-	// Parse the JSON into a slice of Activity structs
-	var activities []Activity
-	err = json.Unmarshal(data, &activities)
+	activities, err := readActivities(filePath)
 	if err != nil {
 		return 0, err
 	}
@@ -655,5 +866,5 @@ func GetRewardPoints(filePath string, activityID string) (int, error) {
 		}
 	}
 
-	return 0, errors.New("activity ID not found")
+	return 0, errActivityNotFound
 }
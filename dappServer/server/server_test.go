@@ -0,0 +1,306 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dapp-server/audit"
+	"dapp-server/auth"
+	"dapp-server/config"
+	"dapp-server/idempotency"
+	"dapp-server/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// loadTestConfig makes content, written to config.toml in a fresh directory, the current
+// configuration and builds the access policy from it. It returns the directory.
+func loadTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadConfig(config.LoadOptions{Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _ := config.GetConfig()
+	policy, err := auth.NewPolicy(cfg.Auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := accessPolicy
+	accessPolicy = policy
+	t.Cleanup(func() { accessPolicy = previous })
+	return dir
+}
+
+// Node replies for a request that runs through the node's whole API successfully
+var okNodeReplies = map[string]string{
+	"/api/generate-smart-contract":             `{"status": true, "result": "QmDeployed"}`,
+	"/api/deploy-smart-contract":               `{"status": true, "result": {"id": "deploy-request"}}`,
+	"/api/execute-smart-contract":              `{"status": true, "result": {"id": "execute-request"}}`,
+	"/api/signature-response":                  `{"status": true, "message": "signed"}`,
+	"/api/register-callback-url":               `{"status": true}`,
+	"/api/get-smart-contract-token-chain-data": `{"status": true, "SCTDataReply": []}`,
+}
+
+// fakeNode is a Rubix node answering each API path with a canned JSON reply
+type fakeNode struct {
+	*httptest.Server
+	mu       sync.Mutex
+	replies  map[string]string
+	requests map[string][]string
+}
+
+// newFakeNode serves okNodeReplies, overridden by replies. An empty reply makes the path fail with a 500.
+func newFakeNode(t *testing.T, replies map[string]string) *fakeNode {
+	t.Helper()
+	node := &fakeNode{replies: make(map[string]string), requests: make(map[string][]string)}
+	for path, reply := range okNodeReplies {
+		node.replies[path] = reply
+	}
+	for path, reply := range replies {
+		node.replies[path] = reply
+	}
+	node.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		node.mu.Lock()
+		node.requests[r.URL.Path] = append(node.requests[r.URL.Path], string(body))
+		reply, exists := node.replies[r.URL.Path]
+		node.mu.Unlock()
+		if !exists || reply == "" {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(node.Close)
+	return node
+}
+
+// calls returns the bodies of the requests the node received on path
+func (n *fakeNode) calls(path string) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.requests[path]
+}
+
+// principalAuthenticator authenticates every request as the same principal
+type principalAuthenticator struct {
+	principal *auth.Principal
+}
+
+func (a principalAuthenticator) Authenticate(r *http.Request) (*auth.Principal, error) {
+	return a.principal, nil
+}
+
+// doRequest sends a request through a router serving handlers on route, authenticated as
+// principal, or anonymously with auth disabled when principal is nil
+func doRequest(method, route, path, body string, principal *auth.Principal, handlers ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	router := gin.New()
+	authenticate := auth.Middleware(false)
+	if principal != nil {
+		authenticate = auth.Middleware(true, principalAuthenticator{principal})
+	}
+	router.Handle(method, route, append([]gin.HandlerFunc{authenticate}, handlers...)...)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(streamRecorder{recorder}, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return recorder
+}
+
+// streamRecorder lets gin stream Server-Sent Events into a ResponseRecorder
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (streamRecorder) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+// writeFile writes content to name under dir and returns its path
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// rejectingAuthenticator refuses every request's credentials
+type rejectingAuthenticator struct{}
+
+func (rejectingAuthenticator) Authenticate(r *http.Request) (*auth.Principal, error) {
+	return nil, errors.New("invalid API key")
+}
+
+func TestNewRouterLimitsFailedAuthentication(t *testing.T) {
+	loadTestConfig(t, `
+[auth]
+enabled = true
+
+[rate_limit]
+enabled = true
+read = { requests_per_minute = 600, burst = 60 }
+client = { requests_per_minute = 1, burst = 3 }
+`)
+	cfg, _ := config.GetConfig()
+	router, err := newRouter(cfg, accessPolicy, []auth.Authenticator{rejectingAuthenticator{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(path string) int {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code
+	}
+
+	// The stream route and the rest of the API share the client's bucket
+	for i, path := range []string{"/api/nodes", "/api/deploy/missing/events", "/api/wallet/did:alice/balance"} {
+		if got := send(path); got != http.StatusUnauthorized {
+			t.Fatalf("request %d to %s = %d, want %d", i, path, got, http.StatusUnauthorized)
+		}
+	}
+	for _, path := range []string{"/api/nodes", "/api/deploy/missing/events"} {
+		if got := send(path); got != http.StatusTooManyRequests {
+			t.Fatalf("%s with failed credentials after the burst = %d, want %d", path, got, http.StatusTooManyRequests)
+		}
+	}
+	if got := send("/healthz"); got == http.StatusTooManyRequests {
+		t.Fatal("probe limited with the API's per client limit")
+	}
+}
+
+func TestTransferRewardOnChainMetrics(t *testing.T) {
+	node := newFakeNode(t, nil)
+	dir := loadTestConfig(t, fmt.Sprintf(`
+[nodes.node1]
+name = "node1"
+port = "20000"
+did = "did:admin"
+url = %q
+`, node.URL))
+	branch := config.Branch{
+		ID:                 "north",
+		TransferContract:   "QmTransfer",
+		ActivityUpdatePath: writeFile(t, dir, "activities.json", `[{"activity_id": "cleanup", "reward_points": 10}]`),
+		Rewards:            config.RewardRules{Multiplier: 0.25},
+	}
+
+	amount, err := transferRewardOnChain(context.Background(), &audit.Entry{}, branch, "did:admin", "did:alice", "cleanup", nil)
+	if err != nil || amount != 2.5 {
+		t.Fatalf("transferRewardOnChain() = %v, %v, want 2.5 tokens", amount, err)
+	}
+	recorder := doRequest(http.MethodGet, "/metrics", "/metrics", "", nil, metrics.Handler())
+	for _, want := range []string{
+		`dapp_reward_points_issued_total{activity_id="cleanup",branch="north"} 10`,
+		`dapp_reward_tokens_issued_total{activity_id="cleanup",branch="north"} 2.5`,
+	} {
+		if !strings.Contains(recorder.Body.String(), want+"\n") {
+			t.Errorf("metrics are missing %s", want)
+		}
+	}
+}
+
+func TestAPITransferReward(t *testing.T) {
+	tests := []struct {
+		name          string
+		replies       map[string]string
+		body          string
+		noContract    bool
+		wantStatus    int
+		wantBody      string
+		wantRequestID bool
+		wantExecuted  int // Executions the node sees for the request and its retry
+	}{
+		{name: "transferred", wantStatus: http.StatusOK, wantBody: `"rewards awarded":10`, wantRequestID: true, wantExecuted: 1},
+		{name: "admin DID without a node", body: `{"activity_id": "cleanup", "user_did": "did:alice", "admin_did": "did:elsewhere"}`, wantStatus: http.StatusBadRequest, wantBody: "no node configured for admin DID did:elsewhere"},
+		{name: "unknown activity", body: `{"activity_id": "missing", "user_did": "did:alice", "admin_did": "did:admin"}`, wantStatus: http.StatusNotFound, wantBody: "activity ID not found"},
+		{name: "no transfer contract", noContract: true, wantStatus: http.StatusInternalServerError, wantBody: "no transfer contract is configured"},
+		{
+			name:         "node refuses",
+			replies:      map[string]string{"/api/execute-smart-contract": `{"status": false, "message": "insufficient balance"}`},
+			wantStatus:   http.StatusBadGateway,
+			wantBody:     "insufficient balance",
+			wantExecuted: 2,
+		},
+		{
+			name:          "signature response fails",
+			replies:       map[string]string{"/api/signature-response": ""},
+			wantStatus:    http.StatusBadGateway,
+			wantBody:      "reward transfer is unconfirmed",
+			wantRequestID: true,
+			wantExecuted:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newFakeNode(t, tt.replies)
+			dir := loadTestConfig(t, fmt.Sprintf(`
+[nodes.node1]
+name = "node1"
+port = "20000"
+did = "did:admin"
+url = %q
+`, node.URL))
+			branch := config.Branch{
+				ID:                 "north",
+				AdminDIDs:          []string{"did:admin", "did:elsewhere"},
+				TransferContract:   "QmTransfer",
+				ActivityUpdatePath: writeFile(t, dir, "activities.json", `[{"activity_id": "cleanup", "reward_points": 10}]`),
+			}
+			if tt.noContract {
+				branch.TransferContract = ""
+			}
+			router := gin.New()
+			router.POST("/api/rewards/transfer", auth.Middleware(false), func(c *gin.Context) { c.Set(branchKey, branch) },
+				idempotency.Middleware(idempotency.NewStore(time.Hour)), APITransferReward)
+			body := tt.body
+			if body == "" {
+				body = `{"activity_id": "cleanup", "user_did": "did:alice", "admin_did": "did:admin"}`
+			}
+			send := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/api/rewards/transfer", strings.NewReader(body))
+				req.Header.Set(idempotency.Header, "retry-key")
+				recorder := httptest.NewRecorder()
+				router.ServeHTTP(recorder, req)
+				return recorder
+			}
+
+			first := send()
+			if first.Code != tt.wantStatus || !strings.Contains(first.Body.String(), tt.wantBody) {
+				t.Fatalf("transfer = %d %s, want %d with %q", first.Code, first.Body, tt.wantStatus, tt.wantBody)
+			}
+			if got := strings.Contains(first.Body.String(), `"rubix_request_id":"execute-request"`); got != tt.wantRequestID {
+				t.Fatalf("transfer = %s, want the Rubix request ID: %v", first.Body, tt.wantRequestID)
+			}
+			// A retry pays again only when the node never took the transfer
+			if retry := send(); retry.Code != tt.wantStatus {
+				t.Fatalf("retry = %d %s, want %d", retry.Code, retry.Body, tt.wantStatus)
+			}
+			if got := len(node.calls("/api/execute-smart-contract")); got != tt.wantExecuted {
+				t.Fatalf("node executed the transfer %d times, want %d", got, tt.wantExecuted)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package wasmhost
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/bytecodealliance/wasmtime-go"
+)
+
+// Host functions take (input_ptr, input_len, output_ptr_ptr, output_len_ptr) and return an i32
+// status, the same shape as the contract functions themselves
+
+// Params are the pointers a host function is called with
+type Params struct {
+	InputPtr     int32
+	InputLen     int32
+	OutputPtrPtr int32
+	OutputLenPtr int32
+}
+
+// ParseParams reads a host function's arguments
+func ParseParams(args []wasmtime.Val) (Params, error) {
+	if len(args) != 4 {
+		return Params{}, fmt.Errorf("host function called with %d arguments, want 4", len(args))
+	}
+	return Params{
+		InputPtr:     args[0].I32(),
+		InputLen:     args[1].I32(),
+		OutputPtrPtr: args[2].I32(),
+		OutputLenPtr: args[3].I32(),
+	}, nil
+}
+
+// ReadInput copies the input a contract passed to a host function
+func ReadInput(caller *wasmtime.Caller, memory *wasmtime.Memory, params Params) ([]byte, error) {
+	data, err := slice(memory.UnsafeData(caller), params.InputPtr, params.InputLen)
+	if err != nil {
+		return nil, fmt.Errorf("host function input out of bounds: %w", err)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// WriteOutput hands a host function's response back to the contract, in memory the contract allocates
+func WriteOutput(caller *wasmtime.Caller, allocFunc *wasmtime.Func, memory *wasmtime.Memory, params Params, response string) error {
+	ptr, err := allocFunc.Call(caller, int32(len(response)))
+	if err != nil {
+		return fmt.Errorf("failed to allocate contract memory: %w", err)
+	}
+	address, _ := ptr.(int32)
+	// alloc may have grown the memory, so only look at it afterwards
+	data := memory.UnsafeData(caller)
+	target, err := slice(data, address, int32(len(response)))
+	if err != nil {
+		return fmt.Errorf("contract allocated memory out of bounds: %w", err)
+	}
+	copy(target, response)
+	for _, out := range []struct{ address, value int32 }{{params.OutputPtrPtr, address}, {params.OutputLenPtr, int32(len(response))}} {
+		slot, err := slice(data, out.address, 4)
+		if err != nil {
+			return fmt.Errorf("host function output pointer out of bounds: %w", err)
+		}
+		binary.LittleEndian.PutUint32(slot, uint32(out.value))
+	}
+	return nil
+}
+
+// Ok is the status a host function returns on success
+func Ok() ([]wasmtime.Val, *wasmtime.Trap) {
+	return []wasmtime.Val{wasmtime.ValI32(0)}, nil
+}
+
+// Fail is the status a host function returns on failure; the contract turns it into an error
+func Fail() ([]wasmtime.Val, *wasmtime.Trap) {
+	return []wasmtime.Val{wasmtime.ValI32(1)}, nil
+}
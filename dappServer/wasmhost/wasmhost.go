@@ -0,0 +1,188 @@
+// Package wasmhost runs Rubix smart contracts compiled to wasm. A contract exports each
+// of its functions as "<name>_" taking (input_ptr, input_len, output_ptr_ptr, output_len_ptr)
+// and returning 0 on success, and reaches the outside world only through the host
+// functions it imports from the "env" module.
+package wasmhost
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bytecodealliance/wasmtime-go"
+)
+
+// ImportModule is the import namespace contracts find host functions in
+const ImportModule = "env"
+
+// Callback implements a host function
+type Callback func(caller *wasmtime.Caller, args []wasmtime.Val) ([]wasmtime.Val, *wasmtime.Trap)
+
+// HostFunction is a function the host makes available to contracts
+type HostFunction interface {
+	Name() string
+	FuncType() *wasmtime.FuncType
+	// Initialize hands the host function the contract's allocator and memory once it is instantiated
+	Initialize(allocFunc, deallocFunc *wasmtime.Func, memory *wasmtime.Memory)
+	Callback() Callback
+}
+
+// Registry holds the host functions a contract is linked against
+type Registry struct {
+	hostFunctions []HostFunction
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(hostFunction HostFunction) {
+	r.hostFunctions = append(r.hostFunctions, hostFunction)
+}
+
+func (r *Registry) HostFunctions() []HostFunction {
+	return r.hostFunctions
+}
+
+// Contract is an instantiated contract. It is not safe for concurrent use.
+type Contract struct {
+	store     *wasmtime.Store
+	instance  *wasmtime.Instance
+	allocFunc *wasmtime.Func
+	memory    *wasmtime.Memory
+}
+
+// Load compiles and instantiates the contract at wasmPath against the registry's host functions.
+// Instantiation fails when the contract imports anything the registry doesn't provide.
+func Load(wasmPath string, registry *Registry) (*Contract, error) {
+	engine := wasmtime.NewEngine()
+	module, err := wasmtime.NewModuleFromFile(engine, wasmPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile wasm module: %w", err)
+	}
+	store := wasmtime.NewStore(engine)
+	linker := wasmtime.NewLinker(engine)
+	for _, hostFunction := range registry.HostFunctions() {
+		if err := linker.FuncNew(ImportModule, hostFunction.Name(), hostFunction.FuncType(), hostFunction.Callback()); err != nil {
+			return nil, fmt.Errorf("failed to link host function %s: %w", hostFunction.Name(), err)
+		}
+	}
+	instance, err := linker.Instantiate(store, module)
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate wasm module: %w", err)
+	}
+
+	contract := &Contract{store: store, instance: instance}
+	contract.allocFunc = instance.GetFunc(store, "alloc")
+	deallocFunc := instance.GetFunc(store, "dealloc")
+	if memory := instance.GetExport(store, "memory"); memory != nil {
+		contract.memory = memory.Memory()
+	}
+	if contract.allocFunc == nil || contract.memory == nil {
+		return nil, fmt.Errorf("wasm module does not export alloc and memory")
+	}
+	for _, hostFunction := range registry.HostFunctions() {
+		hostFunction.Initialize(contract.allocFunc, deallocFunc, contract.memory)
+	}
+	return contract, nil
+}
+
+// Call runs a contract function. input is a JSON object with a single key naming the
+// function, holding the function's argument: {"add_activity": {...}}.
+func (c *Contract) Call(input string) (string, error) {
+	var call map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(input), &call); err != nil {
+		return "", fmt.Errorf("invalid contract input: %w", err)
+	}
+	if len(call) != 1 {
+		return "", fmt.Errorf("contract input must name exactly one function, got %d", len(call))
+	}
+	var name string
+	var arg json.RawMessage
+	for name, arg = range call {
+		break
+	}
+
+	function := c.instance.GetFunc(c.store, name+"_")
+	if function == nil {
+		return "", fmt.Errorf("contract does not export function %s", name)
+	}
+	inputPtr, err := c.write(arg)
+	if err != nil {
+		return "", err
+	}
+	outputPtrPtr, err := c.write(make([]byte, 4))
+	if err != nil {
+		return "", err
+	}
+	outputLenPtr, err := c.write(make([]byte, 4))
+	if err != nil {
+		return "", err
+	}
+
+	result, err := function.Call(c.store, inputPtr, int32(len(arg)), outputPtrPtr, outputLenPtr)
+	if err != nil {
+		return "", fmt.Errorf("contract function %s trapped: %w", name, err)
+	}
+	output, err := c.readOutput(outputPtrPtr, outputLenPtr)
+	if err != nil {
+		return "", err
+	}
+	if code, _ := result.(int32); code != 0 {
+		if output == "" {
+			return "", fmt.Errorf("contract function %s returned error code %d", name, code)
+		}
+		return "", fmt.Errorf("contract function %s failed: %s", name, output)
+	}
+	return output, nil
+}
+
+// write copies data into memory allocated by the contract and returns its address
+func (c *Contract) write(data []byte) (int32, error) {
+	ptr, err := c.allocFunc.Call(c.store, int32(len(data)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate contract memory: %w", err)
+	}
+	address, _ := ptr.(int32)
+	target, err := slice(c.memory.UnsafeData(c.store), address, int32(len(data)))
+	if err != nil {
+		return 0, fmt.Errorf("contract allocated memory out of bounds: %w", err)
+	}
+	copy(target, data)
+	return address, nil
+}
+
+// readOutput follows the output pointer and length the contract stored
+func (c *Contract) readOutput(outputPtrPtr, outputLenPtr int32) (string, error) {
+	memory := c.memory.UnsafeData(c.store)
+	ptr, err := readUint32(memory, outputPtrPtr)
+	if err != nil {
+		return "", err
+	}
+	length, err := readUint32(memory, outputLenPtr)
+	if err != nil {
+		return "", err
+	}
+	data, err := slice(memory, int32(ptr), int32(length))
+	if err != nil {
+		return "", fmt.Errorf("contract output out of bounds: %w", err)
+	}
+	return string(data), nil
+}
+
+func readUint32(memory []byte, address int32) (uint32, error) {
+	data, err := slice(memory, address, 4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(data), nil
+}
+
+// slice returns memory[ptr:ptr+length], checking the range against the memory's size
+func slice(memory []byte, ptr, length int32) ([]byte, error) {
+	start, end := int64(uint32(ptr)), int64(uint32(ptr))+int64(uint32(length))
+	if end > int64(len(memory)) {
+		return nil, fmt.Errorf("range %d-%d exceeds memory size %d", start, end, len(memory))
+	}
+	return memory[start:end], nil
+}
@@ -0,0 +1,127 @@
+package wasmhost
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bytecodealliance/wasmtime-go"
+)
+
+// testContract follows the contract ABI with a bump allocator. echo_ hands its input to
+// the shout host function and returns the host's response, fail_ always fails.
+const testContract = `
+(module
+  (import "env" "shout" (func $shout (param i32 i32 i32 i32) (result i32)))
+  (memory (export "memory") 1)
+  (global $next (mut i32) (i32.const 1024))
+  (func (export "alloc") (param $size i32) (result i32)
+    (local $ptr i32)
+    (local.set $ptr (global.get $next))
+    (global.set $next (i32.add (global.get $next) (local.get $size)))
+    (local.get $ptr))
+  (func (export "dealloc") (param i32 i32))
+  (func (export "echo_") (param $in i32) (param $len i32) (param $out i32) (param $out_len i32) (result i32)
+    (call $shout (local.get $in) (local.get $len) (local.get $out) (local.get $out_len)))
+  (data (i32.const 16) "bad input")
+  (func (export "fail_") (param i32 i32) (param $out i32) (param $out_len i32) (result i32)
+    (i32.store (local.get $out) (i32.const 16))
+    (i32.store (local.get $out_len) (i32.const 9))
+    (i32.const 1)))
+`
+
+// shout upper-cases its input, and fails on "quiet"
+type shout struct {
+	allocFunc *wasmtime.Func
+	memory    *wasmtime.Memory
+}
+
+func (h *shout) Name() string {
+	return "shout"
+}
+
+func (h *shout) FuncType() *wasmtime.FuncType {
+	i32 := wasmtime.NewValType(wasmtime.KindI32)
+	return wasmtime.NewFuncType([]*wasmtime.ValType{i32, i32, i32, i32}, []*wasmtime.ValType{i32})
+}
+
+func (h *shout) Initialize(allocFunc, deallocFunc *wasmtime.Func, memory *wasmtime.Memory) {
+	h.allocFunc = allocFunc
+	h.memory = memory
+}
+
+func (h *shout) Callback() Callback {
+	return func(caller *wasmtime.Caller, args []wasmtime.Val) ([]wasmtime.Val, *wasmtime.Trap) {
+		params, err := ParseParams(args)
+		if err != nil {
+			return Fail()
+		}
+		input, err := ReadInput(caller, h.memory, params)
+		if err != nil || string(input) == `"quiet"` {
+			return Fail()
+		}
+		if err := WriteOutput(caller, h.allocFunc, h.memory, params, strings.ToUpper(string(input))); err != nil {
+			return Fail()
+		}
+		return Ok()
+	}
+}
+
+func writeTestContract(t *testing.T) string {
+	t.Helper()
+	wasm, err := wasmtime.Wat2Wasm(testContract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "contract.wasm")
+	if err := os.WriteFile(path, wasm, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestContractCall(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&shout{})
+	contract, err := Load(writeTestContract(t), registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr string
+	}{
+		{name: "host function response", input: `{"echo": "hello"}`, want: `"HELLO"`},
+		{name: "object argument", input: `{"echo": {"id": 1}}`, want: `{"ID": 1}`},
+		{name: "host function failure", input: `{"echo": "quiet"}`, wantErr: "contract function echo returned error code 1"},
+		{name: "contract error", input: `{"fail": {}}`, wantErr: "contract function fail failed: bad input"},
+		{name: "unknown function", input: `{"missing": {}}`, wantErr: "contract does not export function missing"},
+		{name: "no function", input: `{}`, wantErr: "must name exactly one function"},
+		{name: "two functions", input: `{"echo": 1, "fail": 2}`, wantErr: "must name exactly one function"},
+		{name: "not json", input: `echo`, wantErr: "invalid contract input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := contract.Call(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Call(%s) error = %v, want %q", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Call(%s) = %q, %v, want %q", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMissingHostFunction(t *testing.T) {
+	if _, err := Load(writeTestContract(t), NewRegistry()); err == nil {
+		t.Fatal("Load() linked a contract whose import isn't registered")
+	}
+}